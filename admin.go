@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kuboschek/translate-server/cache"
+	"github.com/kuboschek/translate-server/glossary"
+	"github.com/kuboschek/translate-server/tmx"
+	"github.com/kuboschek/translate-server/upstream"
+	"golang.org/x/text/language"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AdminOnly is an HTTP handler allowing only requests authenticated by a token with the admin claim set to true.
+// Admin endpoints change the translations of every user, so a token to translate is not enough.
+type AdminOnly struct {
+	Handler http.Handler
+}
+
+func (a AdminOnly) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	// The token middleware stores the validated token as "user"
+	if token, ok := request.Context().Value("user").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok && claims["admin"] == true {
+			a.Handler.ServeHTTP(response, request)
+			return
+		}
+	}
+
+	http.Error(response, "Admin token required", http.StatusForbidden)
+}
+
+// TMXHandler is an HTTP handler importing and exporting translations as TMX.
+// GET requests export, POST requests import the request body. The store query parameter selects
+// the translation memory ("memory") or the cache ("cache"), by default the memory if one is enabled.
+type TMXHandler struct {
+	Cache  cache.Cache
+	Memory *upstream.TranslationMemory
+
+	// MemoryPath is the file the memory is saved to after imports, so they survive restarts
+	MemoryPath string
+}
+
+// memoryFileLock keeps imports running at the same time from writing the memory file at once
+var memoryFileLock sync.Mutex
+
+func (h TMXHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	store := request.URL.Query().Get("store")
+	if store == "" {
+		store = "cache"
+		if h.Memory != nil {
+			store = "memory"
+		}
+	}
+
+	if store != "memory" && store != "cache" {
+		http.Error(response, fmt.Sprintf("Unknown store %q", store), http.StatusBadRequest)
+		return
+	}
+
+	if (store == "memory" && h.Memory == nil) || (store == "cache" && h.Cache == nil) {
+		http.Error(response, fmt.Sprintf("No %v enabled", store), http.StatusNotFound)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		h.exportTMX(response, request, store)
+	case http.MethodPost:
+		h.importTMX(response, request, store)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(response, "Only GET and POST requests are allowed")
+	}
+}
+
+// exportTMX writes the contents of a store as TMX
+func (h TMXHandler) exportTMX(response http.ResponseWriter, request *http.Request, store string) {
+	var document *tmx.Document
+
+	if store == "memory" {
+		document = tmx.ExportMemory(h.Memory)
+	} else {
+		// The cache does not know which language phrases were translated from
+		sourceLang, err := language.Parse(request.URL.Query().Get("srclang"))
+		if err != nil {
+			http.Error(response, "Exporting the cache requires a srclang parameter", http.StatusBadRequest)
+			return
+		}
+
+		document, err = tmx.ExportCache(h.Cache, sourceLang)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusNotImplemented)
+			return
+		}
+	}
+
+	response.Header().Set("Content-Type", "application/x-tmx+xml")
+	response.WriteHeader(http.StatusOK)
+	tmx.Write(response, document)
+}
+
+// importTMX adds the translations of a TMX request body to a store
+func (h TMXHandler) importTMX(response http.ResponseWriter, request *http.Request, store string) {
+	document, err := tmx.Read(request.Body)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if store == "memory" {
+		count = tmx.ImportMemory(document, h.Memory)
+		if err := h.saveMemory(); err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		count, err = tmx.ImportCache(document, h.Cache)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response.Header().Set("Content-Type", "text/plain")
+	response.WriteHeader(http.StatusOK)
+	fmt.Fprintf(response, "Imported %d translations\n", count)
+}
+
+// saveMemory writes the memory to its file, if it has one
+func (h TMXHandler) saveMemory() error {
+	if h.MemoryPath == "" {
+		return nil
+	}
+
+	memoryFileLock.Lock()
+	defer memoryFileLock.Unlock()
+
+	return h.Memory.Save(h.MemoryPath)
+}
+
+// GlossaryHandler is an HTTP handler managing glossary terms as JSON.
+// The collection lists terms (GET, filtered by the source and target parameters) and adds them (POST).
+// Single terms, addressed by appending their ID to the path, are returned (GET), replaced (PUT) or deleted (DELETE).
+// Responses carry the current glossary version in the X-Glossary-Version header.
+type GlossaryHandler struct {
+	Glossary *glossary.Glossary
+
+	// Prefix is the path of the collection, e.g. /admin/glossary
+	Prefix string
+}
+
+// writeJSON sets appropriate headers, then writes value as JSON to the ResponseWriter
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeGlossaryError maps glossary errors to HTTP status codes
+func writeGlossaryError(w http.ResponseWriter, err error) {
+	switch err {
+	case glossary.ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case glossary.ErrInvalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeTerms writes a response with the current glossary version
+func (h GlossaryHandler) writeTerms(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("X-Glossary-Version", strconv.Itoa(h.Glossary.Version()))
+	if value == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	writeJSON(w, status, value)
+}
+
+func (h GlossaryHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, h.Prefix), "/")
+	if path == "" {
+		h.serveCollection(response, request)
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Invalid term ID %q", path), http.StatusNotFound)
+		return
+	}
+
+	h.serveTerm(response, request, id)
+}
+
+// readTerm decodes a term from a request body
+func readTerm(request *http.Request) (glossary.Term, error) {
+	var term glossary.Term
+	err := json.NewDecoder(request.Body).Decode(&term)
+	return term, err
+}
+
+func (h GlossaryHandler) serveCollection(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		query := request.URL.Query()
+		sourceLang, targetLang := language.Und, language.Und
+
+		for _, filter := range []struct {
+			name string
+			tag  *language.Tag
+		}{{"source", &sourceLang}, {"target", &targetLang}} {
+			if query.Get(filter.name) == "" {
+				continue
+			}
+
+			tag, err := language.Parse(query.Get(filter.name))
+			if err != nil {
+				http.Error(response, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*filter.tag = tag
+		}
+
+		h.writeTerms(response, http.StatusOK, h.Glossary.List(sourceLang, targetLang))
+
+	case http.MethodPost:
+		term, err := readTerm(request)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		term, err = h.Glossary.Add(term)
+		if err != nil {
+			writeGlossaryError(response, err)
+			return
+		}
+
+		response.Header().Set("Location", fmt.Sprintf("%v/%d", strings.TrimSuffix(h.Prefix, "/"), term.ID))
+		h.writeTerms(response, http.StatusCreated, term)
+
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(response, "Only GET and POST requests are allowed")
+	}
+}
+
+func (h GlossaryHandler) serveTerm(response http.ResponseWriter, request *http.Request, id int) {
+	switch request.Method {
+	case http.MethodGet:
+		term, err := h.Glossary.Get(id)
+		if err != nil {
+			writeGlossaryError(response, err)
+			return
+		}
+
+		h.writeTerms(response, http.StatusOK, term)
+
+	case http.MethodPut:
+		term, err := readTerm(request)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		term, err = h.Glossary.Update(id, term)
+		if err != nil {
+			writeGlossaryError(response, err)
+			return
+		}
+
+		h.writeTerms(response, http.StatusOK, term)
+
+	case http.MethodDelete:
+		if err := h.Glossary.Delete(id); err != nil {
+			writeGlossaryError(response, err)
+			return
+		}
+
+		h.writeTerms(response, http.StatusNoContent, nil)
+
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(response, "Only GET, PUT and DELETE requests are allowed")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kuboschek/translate-server/cache"
+	"github.com/kuboschek/translate-server/glossary"
+	"github.com/kuboschek/translate-server/upstream"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTMX = `<tmx version="1.4"><header srclang="en"/><body>
+<tu><tuv xml:lang="en"><seg>Cancel</seg></tuv><tuv xml:lang="de"><seg>Abbrechen</seg></tuv></tu>
+</body></tmx>`
+
+// TestTMXImportExport checks that translations can be imported and exported through the admin endpoint
+func TestTMXImportExport(t *testing.T) {
+	memory := &upstream.TranslationMemory{}
+	handler := TMXHandler{Cache: cache.Memory, Memory: memory}
+
+	for _, store := range []string{"memory", "cache"} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/tmx?store="+store, bytes.NewBufferString(testTMX))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected OK status importing into %v: got %v %v", store, rr.Code, rr.Body.String())
+		}
+	}
+
+	if _, _, ok := memory.Lookup("Cancel", language.English, language.German); !ok {
+		t.Error("import should add translations to the memory")
+	}
+
+	if translation, _ := cache.Memory.Get("Cancel", language.German); translation != "Abbrechen" {
+		t.Errorf("import should add translations to the cache: got %q", translation)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/tmx", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "<seg>Abbrechen</seg>") {
+		t.Errorf("export should write the memory as TMX: got %v %v", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/tmx?store=cache", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("exporting the cache should require a source language: got %v", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/tmx?store=cache&srclang=en", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "<seg>Abbrechen</seg>") {
+		t.Errorf("export should write the cache as TMX: got %v %v", rr.Code, rr.Body.String())
+	}
+}
+
+// TestTMXImportSaves checks that imports into the memory are written to its file, and fail if it cannot be written
+func TestTMXImportSaves(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "memory.json")
+	handler := TMXHandler{Memory: &upstream.TranslationMemory{}, MemoryPath: path}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/tmx?store=memory", bytes.NewBufferString(testTMX))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected OK status importing into the memory: got %v %v", rr.Code, rr.Body.String())
+	}
+
+	reloaded := &upstream.TranslationMemory{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("import should save the memory: %v", err)
+	}
+
+	if entry, _, ok := reloaded.Lookup("Cancel", language.English, language.German); !ok || entry.Target != "Abbrechen" {
+		t.Error("saved memory should contain the imported translations")
+	}
+
+	handler.MemoryPath = filepath.Join(dir, "missing", "memory.json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/tmx?store=memory", bytes.NewBufferString(testTMX)))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("import should fail if the memory cannot be saved: got %v", rr.Code)
+	}
+}
+
+// TestGlossaryAPI checks that terms can be managed through the admin endpoint
+func TestGlossaryAPI(t *testing.T) {
+	handler := GlossaryHandler{Glossary: &glossary.Glossary{}, Prefix: "/admin/glossary"}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "/admin/glossary", `{"source": "Acme", "sourceLang": "en", "target": "ACME", "targetLang": "de"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "/admin/glossary/1" {
+		t.Fatalf("expected Created status and location: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr.Header().Get("X-Glossary-Version") != "1" {
+		t.Errorf("responses should carry the glossary version: got %q", rr.Header().Get("X-Glossary-Version"))
+	}
+
+	rr = serve(http.MethodPost, "/admin/glossary", `{"source": "Acme"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("adding incomplete terms should fail: got %v", rr.Code)
+	}
+
+	rr = serve(http.MethodPut, "/admin/glossary/1", `{"source": "Acme", "sourceLang": "en", "target": "Acme AG", "targetLang": "de"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Acme AG") {
+		t.Errorf("expected the replaced term: got %v %v", rr.Code, rr.Body.String())
+	}
+
+	rr = serve(http.MethodGet, "/admin/glossary?source=en&target=de", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Acme AG") {
+		t.Errorf("expected the list of terms: got %v %v", rr.Code, rr.Body.String())
+	}
+
+	rr = serve(http.MethodDelete, "/admin/glossary/1", "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected No Content status: got %v", rr.Code)
+	}
+
+	rr = serve(http.MethodGet, "/admin/glossary/1", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("deleted terms should not be found: got %v", rr.Code)
+	}
+}
+
+// TestAdminOnly checks that admin endpoints require the admin claim
+func TestAdminOnly(t *testing.T) {
+	handler := AdminOnly{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+
+	cases := []struct {
+		claims jwt.MapClaims
+		code   int
+	}{
+		{nil, http.StatusForbidden},
+		{jwt.MapClaims{}, http.StatusForbidden},
+		{jwt.MapClaims{"admin": "yes"}, http.StatusForbidden},
+		{jwt.MapClaims{"admin": true}, http.StatusNoContent},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/admin/tmx", nil)
+		if c.claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), "user", jwt.NewWithClaims(jwt.SigningMethodHS256, c.claims)))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("admin endpoints should respond to claims %v with %v: got %v", c.claims, c.code, rr.Code)
+		}
+	}
+}
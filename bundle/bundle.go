@@ -0,0 +1,201 @@
+// Package bundle translates nested i18n bundles of keys and strings, like the JSON files of i18next and vue-i18n or
+// the YAML files of Rails. Bundles are read into a tree of YAML nodes, so keys keep their order, and YAML keeps its
+// comments.
+package bundle
+
+import (
+	"bytes"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strings"
+)
+
+// interpolation matches the placeholders of common i18n libraries: {{name}} and $t(key) of i18next, %{name} and
+// %<name>s of Rails, {name} and @:key of vue-i18n, and the separators of vue-i18n plural forms
+var interpolation = regexp.MustCompile(`\{\{[^{}]*\}\}|\$t\([^)]*\)|%\{[^{}]*\}|%<\w+>[a-z]|\{\w+\}|@\.?\w*:[\w.]+|\s\|\s`)
+
+// Bundle is a parsed JSON or YAML bundle.
+type Bundle struct {
+	// document is the YAML document node, and root its content
+	document *yaml.Node
+	root     *yaml.Node
+
+	json bool
+
+	// indent is the indentation of JSON bundles
+	indent string
+}
+
+// String returns the bundle in its format. YAML is written with an indentation of two spaces, as Rails does.
+func (b *Bundle) String() string {
+	var buffer bytes.Buffer
+
+	if b.json {
+		b.writeJSON(&buffer, b.root, 0)
+		buffer.WriteString("\n")
+		return buffer.String()
+	}
+
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	encoder.Encode(b.document)
+	encoder.Close()
+
+	return buffer.String()
+}
+
+// SyntaxError describes a bundle that cannot be parsed.
+type SyntaxError struct {
+	Format  string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return "bundle: invalid " + e.Format + ": " + e.Message
+}
+
+// Translate translates the strings of a source bundle. If there is a target bundle, strings it has already are taken
+// from it and only missing ones are translated. Bundles whose only key is their language, as in Rails, get the target
+// language as key. It returns a bundle in the format of the source, and the number of translated strings.
+func Translate(source, target *Bundle, givenLang, targetLang language.Tag, translate func(string) (string, error)) (*Bundle, int, error) {
+	t := &translator{translate: translate}
+
+	sourceRoot := languageRoot(source.root, givenLang)
+	var targetRoot *yaml.Node
+	if target != nil {
+		targetRoot = languageRoot(target.root, targetLang)
+	}
+
+	translated, err := t.node(sourceRoot, targetRoot)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if sourceRoot != source.root {
+		key := *source.root.Content[0]
+		key.Value = targetLang.String()
+		translated = &yaml.Node{
+			Kind:        yaml.MappingNode,
+			Tag:         source.root.Tag,
+			Style:       source.root.Style,
+			HeadComment: source.root.HeadComment,
+			Content:     []*yaml.Node{&key, translated},
+		}
+	}
+
+	result := *source
+	result.root = translated
+	if source.document != nil {
+		document := *source.document
+		document.Content = []*yaml.Node{translated}
+		result.document = &document
+	}
+
+	return &result, t.count, nil
+}
+
+// languageRoot returns the content of a mapping whose only key is a language, or else the node itself
+func languageRoot(node *yaml.Node, lang language.Tag) *yaml.Node {
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 || node.Content[1].Kind != yaml.MappingNode {
+		return node
+	}
+
+	key, err := language.Parse(node.Content[0].Value)
+	if err != nil {
+		return node
+	}
+
+	keyBase, _ := key.Base()
+	base, _ := lang.Base()
+	if keyBase != base {
+		return node
+	}
+
+	return node.Content[1]
+}
+
+// translator holds the state of translating one bundle
+type translator struct {
+	translate func(string) (string, error)
+	count     int
+}
+
+// lookup returns the value of a key in a mapping, or nil
+func lookup(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// node returns a translated copy of a node. Strings the target has already are taken from it.
+func (t *translator) node(source, target *yaml.Node) (*yaml.Node, error) {
+	result := *source
+
+	switch source.Kind {
+	case yaml.MappingNode:
+		result.Content = make([]*yaml.Node, len(source.Content))
+		for i := 0; i+1 < len(source.Content); i += 2 {
+			value, err := t.node(source.Content[i+1], lookup(target, source.Content[i].Value))
+			if err != nil {
+				return nil, err
+			}
+			result.Content[i], result.Content[i+1] = source.Content[i], value
+		}
+
+	case yaml.SequenceNode:
+		result.Content = make([]*yaml.Node, len(source.Content))
+		for i, item := range source.Content {
+			var targetItem *yaml.Node
+			if target != nil && target.Kind == yaml.SequenceNode && i < len(target.Content) {
+				targetItem = target.Content[i]
+			}
+
+			value, err := t.node(item, targetItem)
+			if err != nil {
+				return nil, err
+			}
+			result.Content[i] = value
+		}
+
+	case yaml.ScalarNode:
+		if source.ShortTag() != "!!str" || strings.TrimSpace(source.Value) == "" {
+			break
+		}
+
+		if target != nil && target.Kind == yaml.ScalarNode && target.ShortTag() == "!!str" && target.Value != "" {
+			result.Value = target.Value
+			break
+		}
+
+		translated, err := t.value(source.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Value = translated
+		t.count++
+	}
+
+	return &result, nil
+}
+
+// value translates a string, keeping its placeholders
+func (t *translator) value(text string) (string, error) {
+	translated, err := placeholder.Translate(placeholder.Split(text, interpolation), t.translate)
+	if err != nil {
+		return "", err
+	}
+
+	var value strings.Builder
+	for _, piece := range translated {
+		value.WriteString(piece.Text)
+	}
+	return value.String(), nil
+}
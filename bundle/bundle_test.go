@@ -0,0 +1,134 @@
+package bundle
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestTranslateJSON(t *testing.T) {
+	source, err := ParseJSON(readFile(t, "testdata/en.json"))
+	if err != nil {
+		t.Fatalf("ParseJSON returned error when it shouldn't have: %v", err)
+	}
+
+	translated, count, err := Translate(source, nil, language.English, language.German, upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	want := `{
+    "title": "WELCOME TO {{appName}}",
+    "nav": {
+        "home": "HOME",
+        "profile": "YOUR PROFILE"
+    },
+    "cart": "YOU HAVE {count} ITEM | YOU HAVE {count} ITEMS",
+    "more": "$t(nav.home) AND MORE",
+    "pages": [
+        "FIRST PAGE",
+        "LAST PAGE"
+    ],
+    "limit": 10,
+    "beta": true,
+    "empty": ""
+}
+`
+	if translated.String() != want {
+		t.Errorf("Translate should translate all strings, keeping keys and placeholders: got\n%v\nwant\n%v", translated, want)
+	}
+	if count != 7 {
+		t.Errorf("Translate should count translated strings: got %d want 7", count)
+	}
+}
+
+func TestTranslateJSON_Target(t *testing.T) {
+	source, err := ParseJSON(readFile(t, "testdata/en.json"))
+	if err != nil {
+		t.Fatalf("ParseJSON returned error when it shouldn't have: %v", err)
+	}
+	target, err := ParseJSON(readFile(t, "testdata/de.json"))
+	if err != nil {
+		t.Fatalf("ParseJSON returned error when it shouldn't have: %v", err)
+	}
+
+	translated, count, err := Translate(source, target, language.English, language.German, upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	for _, want := range []string{`"home": "Startseite",`, `"profile": "YOUR PROFILE"`, "\"Erste Seite\",\n        \"LAST PAGE\""} {
+		if !strings.Contains(translated.String(), want) {
+			t.Errorf("Translate should keep translations of the target: want %q in\n%v", want, translated)
+		}
+	}
+	if count != 5 {
+		t.Errorf("Translate should only translate missing strings: got %d want 5", count)
+	}
+}
+
+func TestTranslateYAML(t *testing.T) {
+	source, err := ParseYAML(readFile(t, "testdata/en.yml"))
+	if err != nil {
+		t.Fatalf("ParseYAML returned error when it shouldn't have: %v", err)
+	}
+
+	translated, _, err := Translate(source, nil, language.English, language.MustParse("pt-BR"), upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	want := `# Shared strings
+pt-BR:
+  greeting: "HELLO %{name}"
+  errors:
+    # Shown when saving fails
+    save: COULD NOT SAVE
+    blank: "YES"
+  count: 3
+`
+	if translated.String() != want {
+		t.Errorf("Translate should translate YAML under the target language: got\n%v\nwant\n%v", translated, want)
+	}
+
+	// Only missing keys are translated, from under the target language
+	target, err := ParseYAML("pt-BR:\n  errors:\n    save: Não foi possível salvar\n")
+	if err != nil {
+		t.Fatalf("ParseYAML returned error when it shouldn't have: %v", err)
+	}
+	translated, count, err := Translate(source, target, language.English, language.MustParse("pt-BR"), upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+	if !strings.Contains(translated.String(), "save: Não foi possível salvar\n") || count != 2 {
+		t.Errorf("Translate should keep translations of the target: got %d translated in\n%v", count, translated)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, document := range []string{`[]`, `{"a": }`, `{"a": "b"} {}`, `{"a": "b"`} {
+		if _, err := ParseJSON(document); err == nil {
+			t.Errorf("ParseJSON should fail for %q", document)
+		}
+	}
+
+	for _, document := range []string{"- a\n- b\n", "a: [b\n", ""} {
+		if _, err := ParseYAML(document); err == nil {
+			t.Errorf("ParseYAML should fail for %q", document)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strings"
+)
+
+// ParseJSON reads a JSON bundle. Its indentation is kept for writing it.
+func ParseJSON(document string) (*Bundle, error) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+
+	root, err := readJSON(decoder)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = &SyntaxError{Format: "JSON", Message: "data after the bundle"}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, &SyntaxError{Format: "JSON", Message: "not an object"}
+	}
+
+	return &Bundle{root: root, json: true, indent: jsonIndentation(document)}, nil
+}
+
+// jsonIndentation returns the indentation of the first indented line of a document, or two spaces
+func jsonIndentation(document string) string {
+	for _, line := range strings.Split(document, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != line && trimmed != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// readJSON reads the next value of a decoder as a node
+func readJSON(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, &SyntaxError{Format: "JSON", Message: err.Error()}
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if token == '[' {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, &SyntaxError{Format: "JSON", Message: err.Error()}
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+
+			value, err := readJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+
+		// The closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, &SyntaxError{Format: "JSON", Message: err.Error()}
+		}
+		return node, nil
+
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}, nil
+	case json.Number:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: token.String()}, nil
+	case bool:
+		value := "false"
+		if token {
+			value = "true"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: value}, nil
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+// writeJSON writes a node as JSON, indented at the given level
+func (b *Bundle) writeJSON(w *bytes.Buffer, node *yaml.Node, level int) {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "{", "}", 2
+		if node.Kind == yaml.SequenceNode {
+			open, close, step = "[", "]", 1
+		}
+
+		w.WriteString(open)
+		if len(node.Content) == 0 {
+			w.WriteString(close)
+			return
+		}
+
+		indentation := "\n" + strings.Repeat(b.indent, level+1)
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString(indentation)
+			if step == 2 {
+				writeJSONString(w, node.Content[i].Value)
+				w.WriteString(": ")
+			}
+			b.writeJSON(w, node.Content[i+step-1], level+1)
+		}
+		w.WriteString("\n" + strings.Repeat(b.indent, level) + close)
+
+	default:
+		if node.ShortTag() == "!!str" {
+			writeJSONString(w, node.Value)
+		} else {
+			w.WriteString(node.Value)
+		}
+	}
+}
+
+// writeJSONString writes a JSON string, without escaping HTML characters
+func writeJSONString(w *bytes.Buffer, value string) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	w.Truncate(w.Len() - 1)
+}
@@ -0,0 +1,17 @@
+package bundle
+
+import "gopkg.in/yaml.v3"
+
+// ParseYAML reads a YAML bundle, with its comments.
+func ParseYAML(document string) (*Bundle, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(document), &node); err != nil {
+		return nil, &SyntaxError{Format: "YAML", Message: err.Error()}
+	}
+
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return nil, &SyntaxError{Format: "YAML", Message: "not a mapping"}
+	}
+
+	return &Bundle{document: &node, root: node.Content[0]}, nil
+}
@@ -15,3 +15,22 @@ type Cache interface {
 	// or is not present in cache.
 	Get(sourcePhrase string, targetLang language.Tag) (targetPhrase string, err error)
 }
+
+// Entry is a single cached translation.
+type Entry struct {
+	SourcePhrase string
+	TargetLang   language.Tag
+	TargetPhrase string
+}
+
+// Lister is implemented by caches that can enumerate their contents, e.g. for exporting them.
+type Lister interface {
+	// Entries returns all cached translations
+	Entries() []Entry
+}
+
+// Purger is implemented by caches that can invalidate translations, e.g. after the glossary changed.
+type Purger interface {
+	// Purge removes all translations into a language, including its regional variants
+	Purge(targetLang language.Tag) error
+}
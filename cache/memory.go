@@ -3,6 +3,7 @@ package cache
 import (
 	"github.com/pkg/errors"
 	"golang.org/x/text/language"
+	"sort"
 	"sync"
 )
 
@@ -57,3 +58,48 @@ func (p memoryCache) Get(sourcePhrase string, targetLang language.Tag) (targetPh
 
 	return phrase, nil
 }
+
+// Entries returns all cached translations, ordered by source phrase and target language.
+func (p memoryCache) Entries() []Entry {
+	memoryLock.RLock()
+	defer memoryLock.RUnlock()
+
+	var entries []Entry
+	for sourcePhrase, phrases := range p {
+		for targetLang, targetPhrase := range phrases {
+			entries = append(entries, Entry{sourcePhrase, targetLang, targetPhrase})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].SourcePhrase != entries[j].SourcePhrase {
+			return entries[i].SourcePhrase < entries[j].SourcePhrase
+		}
+		return entries[i].TargetLang.String() < entries[j].TargetLang.String()
+	})
+
+	return entries
+}
+
+// Purge removes all translations into targetLang or one of its regional variants.
+func (p memoryCache) Purge(targetLang language.Tag) error {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	for sourcePhrase, phrases := range p {
+		for tag := range phrases {
+			for parent := tag; parent != language.Und; parent = parent.Parent() {
+				if parent == targetLang {
+					delete(phrases, tag)
+					break
+				}
+			}
+		}
+
+		if len(phrases) == 0 {
+			delete(p, sourcePhrase)
+		}
+	}
+
+	return nil
+}
@@ -62,3 +62,37 @@ func TestGetTranslation(t *testing.T) {
 		t.Error("Translate should return an error when no translation is present.")
 	}
 }
+
+// TestListTranslations tests the Entries method of the memory cache
+func TestListTranslations(t *testing.T) {
+	Memory.Put(testSe, de, testDe)
+
+	found := false
+	for _, entry := range Memory.Entries() {
+		if entry == (Entry{testSe, de, testDe}) {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Error("Entries should list every cached translation.")
+	}
+}
+
+// TestPurgeTranslations tests the Purge method of the memory cache
+func TestPurgeTranslations(t *testing.T) {
+	swiss := language.MustParse("de-CH")
+	Memory.Put(testEn, de, testDe)
+	Memory.Put(testSe, swiss, testDe)
+	Memory.Put(testFr, en, testEn)
+
+	Memory.Purge(de)
+
+	if Memory.Has(testEn, de) || Memory.Has(testSe, swiss) {
+		t.Error("Purge should remove translations into the language and its variants.")
+	}
+
+	if !Memory.Has(testFr, en) {
+		t.Error("Purge should keep translations into other languages.")
+	}
+}
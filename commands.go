@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kuboschek/translate-server/po"
+	"github.com/kuboschek/translate-server/tmx"
+	"github.com/kuboschek/translate-server/upstream"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io"
+	"os"
+)
+
+const usage = `usage:
+  translate-server                                      run the server
+  translate-server tmx-import <file.tmx> <memory.json>  add the translations of a TMX file to a translation memory
+  translate-server tmx-export <memory.json> <file.tmx>  write a translation memory as TMX
+  translate-server po-translate <from> <to> <in.po> <out.po>
+                                                        translate the untranslated messages of a PO or POT file
+
+Use - for standard input or output instead of a TMX or PO file.`
+
+// runCommand runs the subcommand given on the command line
+func runCommand(args []string) error {
+	switch args[0] {
+	case "tmx-import":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		return importTMX(args[1], args[2])
+	case "tmx-export":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		return exportTMX(args[1], args[2])
+	case "po-translate":
+		if len(args) != 5 {
+			return errors.New(usage)
+		}
+		return translatePOFile(args[1], args[2], args[3], args[4])
+	default:
+		return errors.New(usage)
+	}
+}
+
+// loadMemory reads a translation memory file. Files that do not exist yet result in an empty memory.
+func loadMemory(path string) (*upstream.TranslationMemory, error) {
+	memory := &upstream.TranslationMemory{}
+
+	err := memory.Load(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return memory, nil
+}
+
+func importTMX(tmxPath, memoryPath string) error {
+	var input io.Reader = os.Stdin
+	if tmxPath != "-" {
+		file, err := os.Open(tmxPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	document, err := tmx.Read(input)
+	if err != nil {
+		return err
+	}
+
+	memory, err := loadMemory(memoryPath)
+	if err != nil {
+		return err
+	}
+
+	count := tmx.ImportMemory(document, memory)
+	if err := memory.Save(memoryPath); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d translations\n", count)
+	return nil
+}
+
+func exportTMX(memoryPath, tmxPath string) error {
+	memory := &upstream.TranslationMemory{}
+	if err := memory.Load(memoryPath); err != nil {
+		return err
+	}
+
+	if tmxPath == "-" {
+		return tmx.Write(os.Stdout, tmx.ExportMemory(memory))
+	}
+
+	file, err := os.Create(tmxPath)
+	if err != nil {
+		return err
+	}
+
+	if err := tmx.Write(file, tmx.ExportMemory(memory)); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// translatePOFile translates a PO file with the configured services and cache
+func translatePOFile(from, to, inputPath, outputPath string) error {
+	givenLang, err := language.Parse(from)
+	if err != nil {
+		return err
+	}
+
+	targetLang, err := language.Parse(to)
+	if err != nil {
+		return err
+	}
+
+	if len(translateHandler.Services) == 0 {
+		return errors.New("no translation backends active")
+	}
+
+	var input io.Reader = os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	catalog, err := po.Parse(input)
+	if err != nil {
+		return err
+	}
+
+	translator := Translator{GivenLang: givenLang, TargetLang: targetLang, handler: translateHandler}
+	count, err := po.Translate(catalog, targetLang, translator.Text)
+	if err != nil {
+		return err
+	}
+
+	if outputPath == "-" {
+		err = catalog.Write(os.Stdout)
+	} else {
+		err = writePOFile(catalog, outputPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Translated %d messages\n", count)
+	return nil
+}
+
+func writePOFile(catalog *po.File, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := catalog.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kuboschek/translate-server/bundle"
+	"github.com/kuboschek/translate-server/markup"
+	"github.com/kuboschek/translate-server/messageformat"
+	"github.com/kuboschek/translate-server/po"
+	"github.com/kuboschek/translate-server/resources"
+	"github.com/kuboschek/translate-server/subtitle"
+	"github.com/kuboschek/translate-server/upstream"
+	"github.com/kuboschek/translate-server/xliff"
+	"golang.org/x/text/language"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Format translates documents of one content type. Text is translated through the Translator, markup is kept.
+type Format func(document string, t Translator) (string, error)
+
+// Translator translates the parts of a document, through the cache and services of a handler.
+type Translator struct {
+	GivenLang, TargetLang language.Tag
+
+	// Options are the query parameters of the request, for formats that take options
+	Options url.Values
+
+	handler TranslateHandler
+
+	// progress is called after every phrase translated, for jobs reporting their progress
+	progress func()
+}
+
+// Text translates a phrase of plain text.
+func (t Translator) Text(phrase string) (string, error) {
+	result, err := t.handler.translate(phrase, t.GivenLang, t.TargetLang)
+	if err == nil && t.progress != nil {
+		t.progress()
+	}
+	return result.TranslatedPhrase, err
+}
+
+// HTML translates an HTML document with the first service that supports HTML, and keeps its structure.
+// Documents are not cached, as they are rarely translated twice. Documents with text the translation memory has
+// translations for are translated a block at a time instead, so the human translations are used.
+func (t Translator) HTML(document string) (string, error) {
+	if t.memoryMatches(document) {
+		return "", errNoHTMLService
+	}
+
+	services, _ := t.handler.services()
+	for _, svc := range services {
+		native, ok := svc.(upstream.HTMLService)
+		if !ok {
+			continue
+		}
+
+		htmlService, ok := native.WithHTML()
+		if !ok {
+			continue
+		}
+
+		result := callService(htmlService, document, t.GivenLang, t.TargetLang)
+		if result.Error != nil {
+			log.Printf("failed to translate HTML: %v", result.Error)
+			continue
+		}
+
+		if !markup.SameStructure(document, result.TranslatedPhrase) {
+			log.Printf("failed to translate HTML: translation changed the structure of the document")
+			continue
+		}
+
+		return result.TranslatedPhrase, nil
+	}
+
+	return "", errNoHTMLService
+}
+
+// memoryMatches reports whether the translation memory has a translation of a block of text of an HTML document
+func (t Translator) memoryMatches(document string) bool {
+	if t.handler.Memory == nil {
+		return false
+	}
+
+	_, err := markup.TranslateHTML(document, func(phrase string) (string, error) {
+		if _, _, ok := t.handler.Memory.Lookup(phrase, t.GivenLang, t.TargetLang); ok {
+			return "", errMemoryMatch
+		}
+		return phrase, nil
+	})
+	return err == errMemoryMatch
+}
+
+// invalidDocument is returned by formats for documents that cannot be parsed
+type invalidDocument struct {
+	error
+}
+
+var (
+	errNoHTMLService = errors.New("no service translated the HTML document")
+
+	// errMemoryMatch stops looking for translations in the memory at the first one found
+	errMemoryMatch = errors.New("translation memory matches the document")
+)
+
+// formats are the document formats the handler translates, by content type
+var formats = map[string]Format{
+	"text/x-icu-messageformat": translateMessageFormat,
+	"text/html":                translateHTML,
+	"text/markdown":            translateMarkdown,
+
+	// PO files have no registered type, these are the ones gettext and most tools use
+	"text/x-gettext-translation":          translatePO,
+	"text/x-gettext-translation-template": translatePO,
+	"text/x-po":                           translatePO,
+	"application/xliff+xml":               translateXLIFF,
+	"application/x-xliff+xml":             translateXLIFF,
+
+	// Resource files of mobile apps have no registered types either
+	"application/x-android-resources+xml": translateAndroid,
+	"text/x-apple-strings":                translateStrings,
+	"application/x-apple-stringsdict+xml": translateStringsdict,
+	"application/x-arb+json":              translateARB,
+
+	// i18n bundles of nested keys, as of i18next, vue-i18n or Rails
+	"application/json":   translateJSONBundle,
+	"application/yaml":   translateYAMLBundle,
+	"application/x-yaml": translateYAMLBundle,
+	"text/yaml":          translateYAMLBundle,
+	"text/x-yaml":        translateYAMLBundle,
+
+	"application/x-subrip": translateSRT,
+	"text/vtt":             translateVTT,
+}
+
+// isDocument reports whether a body of the given type is translated by its format. All other bodies are translated as
+// plain text, as every body was before documents were supported. JSON is only a bundle if it is an object.
+func isDocument(mediaType, body string) bool {
+	if _, ok := formats[mediaType]; !ok {
+		return false
+	}
+
+	if mediaType == "application/json" {
+		return strings.HasPrefix(strings.TrimSpace(body), "{")
+	}
+	return true
+}
+
+// serveDocument translates a document in one of the supported formats
+func (h TranslateHandler) serveDocument(response http.ResponseWriter, mediaType, document string, options url.Values, givenLang, targetLang language.Tag) {
+	format, ok := formats[mediaType]
+	if !ok {
+		http.Error(response, "Unsupported content type "+mediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	translated, err := format(document, Translator{GivenLang: givenLang, TargetLang: targetLang, Options: options, handler: h})
+	writeDocument(response, mediaType, translated, err, givenLang, targetLang)
+}
+
+// writeDocument writes a translated document, or the error of translating it
+func writeDocument(response http.ResponseWriter, mediaType, translated string, err error, givenLang, targetLang language.Tag) {
+	if _, ok := err.(invalidDocument); ok {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("failed to translate %v document (%v -> %v): %v", mediaType, givenLang, targetLang, err)
+		response.WriteHeader(http.StatusBadGateway)
+		io.WriteString(response, "Upstream services failed to translate the document.")
+		return
+	}
+
+	headers := response.Header()
+	headers.Set("Content-Type", mediaType)
+	headers.Set("Content-Language", targetLang.String())
+	response.WriteHeader(http.StatusOK)
+	io.WriteString(response, translated)
+}
+
+// translateMessageFormat translates the text of an ICU message, and adapts its plural cases to the target language
+func translateMessageFormat(document string, t Translator) (string, error) {
+	message, err := messageformat.Parse(document)
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+
+	return messageformat.TranslateTo(message, t.TargetLang, t.Text)
+}
+
+// translateHTML translates an HTML document with a service supporting HTML, or else a block of text at a time
+func translateHTML(document string, t Translator) (string, error) {
+	translated, err := t.HTML(document)
+	if err == nil {
+		return translated, nil
+	}
+
+	return markup.TranslateHTML(document, t.Text)
+}
+
+// translateMarkdown translates the prose of a Markdown document
+func translateMarkdown(document string, t Translator) (string, error) {
+	return markup.TranslateMarkdown(document, t.Text)
+}
+
+// translatePO translates the untranslated messages of a gettext PO or POT file, and marks them fuzzy for review
+func translatePO(document string, t Translator) (string, error) {
+	file, err := po.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+
+	_, err = po.Translate(file, t.TargetLang, t.Text)
+	if err == po.ErrNoPluralForms {
+		return "", invalidDocument{err}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var translated strings.Builder
+	if err := file.Write(&translated); err != nil {
+		return "", err
+	}
+
+	return translated.String(), nil
+}
+
+// translateXLIFF fills the targets of untranslated units of an XLIFF 1.2 or 2.0 document
+func translateXLIFF(document string, t Translator) (string, error) {
+	// Errors other than those of translating are caused by the document
+	var translateErr error
+	translate := func(phrase string) (string, error) {
+		translated, err := t.Text(phrase)
+		if err != nil {
+			translateErr = err
+		}
+		return translated, err
+	}
+
+	translated, _, err := xliff.Translate(document, t.TargetLang, translate)
+	if err != nil && translateErr == nil {
+		return "", invalidDocument{err}
+	}
+
+	return translated, err
+}
+
+// resourceError returns errors of files that cannot be parsed as invalid documents
+func resourceError(err error) error {
+	if _, ok := err.(*resources.SyntaxError); ok {
+		return invalidDocument{err}
+	}
+	return err
+}
+
+// translateAndroid translates the resources of an Android strings.xml file
+func translateAndroid(document string, t Translator) (string, error) {
+	translated, err := resources.TranslateAndroid(document, t.TargetLang, t.Text)
+	return translated, resourceError(err)
+}
+
+// translateStrings translates the values of an iOS .strings file
+func translateStrings(document string, t Translator) (string, error) {
+	translated, err := resources.TranslateStrings(document, t.Text)
+	return translated, resourceError(err)
+}
+
+// translateStringsdict translates the plural rules of an iOS .stringsdict file
+func translateStringsdict(document string, t Translator) (string, error) {
+	translated, err := resources.TranslateStringsdict(document, t.TargetLang, t.Text)
+	return translated, resourceError(err)
+}
+
+// translateARB translates the messages of a Flutter ARB file
+func translateARB(document string, t Translator) (string, error) {
+	translated, err := resources.TranslateARB(document, t.TargetLang, t.Text)
+	return translated, resourceError(err)
+}
+
+// translateBundle translates the strings of a bundle, and only those missing from the target bundle if there is one
+func translateBundle(source, target *bundle.Bundle, t Translator) (string, error) {
+	translated, _, err := bundle.Translate(source, target, t.GivenLang, t.TargetLang, t.Text)
+	if err != nil {
+		return "", err
+	}
+	return translated.String(), nil
+}
+
+// translateJSONBundle translates the strings of a JSON bundle
+func translateJSONBundle(document string, t Translator) (string, error) {
+	source, err := bundle.ParseJSON(document)
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+	return translateBundle(source, nil, t)
+}
+
+// translateYAMLBundle translates the strings of a YAML bundle
+func translateYAMLBundle(document string, t Translator) (string, error) {
+	source, err := bundle.ParseYAML(document)
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+	return translateBundle(source, nil, t)
+}
+
+// parseBundle reads a JSON or YAML bundle, and returns it with its content type
+func parseBundle(document string) (*bundle.Bundle, string, error) {
+	if strings.HasPrefix(strings.TrimSpace(document), "{") {
+		parsed, err := bundle.ParseJSON(document)
+		return parsed, "application/json", err
+	}
+
+	parsed, err := bundle.ParseYAML(document)
+	return parsed, "application/x-yaml", err
+}
+
+// serveBundleUpdate translates a bundle sent as the source part of a form, keeping the translations of the bundle in
+// its target part. Only strings missing from the target are translated.
+func (h TranslateHandler) serveBundleUpdate(response http.ResponseWriter, boundary, body string, givenLang, targetLang language.Tag) {
+	parts := make(map[string]string)
+
+	reader := multipart.NewReader(strings.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts[part.FormName()] = string(content)
+	}
+
+	if _, ok := parts["source"]; !ok {
+		http.Error(response, "No source bundle in the form", http.StatusBadRequest)
+		return
+	}
+
+	source, mediaType, err := parseBundle(parts["source"])
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var target *bundle.Bundle
+	if document, ok := parts["target"]; ok && strings.TrimSpace(document) != "" {
+		if target, _, err = parseBundle(document); err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	translated, err := translateBundle(source, target, Translator{GivenLang: givenLang, TargetLang: targetLang, handler: h})
+	writeDocument(response, mediaType, translated, err, givenLang, targetLang)
+}
+
+// subtitleOptions reads the options of subtitles: linelength, the largest number of characters of a line
+func subtitleOptions(t Translator) (subtitle.Options, error) {
+	var options subtitle.Options
+
+	if value := t.Options.Get("linelength"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 {
+			return options, invalidDocument{fmt.Errorf("invalid linelength %q", value)}
+		}
+		options.LineLength = length
+	}
+
+	return options, nil
+}
+
+// translateSubtitles translates the cues of a subtitle file
+func translateSubtitles(f *subtitle.File, t Translator) (string, error) {
+	options, err := subtitleOptions(t)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := subtitle.Translate(f, t.TargetLang, options, t.Text); err != nil {
+		return "", err
+	}
+
+	return f.String(), nil
+}
+
+// translateSRT translates the cues of a SubRip file
+func translateSRT(document string, t Translator) (string, error) {
+	f, err := subtitle.ParseSRT(document)
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+	return translateSubtitles(f, t)
+}
+
+// translateVTT translates the cues of a WebVTT file
+func translateVTT(document string, t Translator) (string, error) {
+	f, err := subtitle.ParseVTT(document)
+	if err != nil {
+		return "", invalidDocument{err}
+	}
+	return translateSubtitles(f, t)
+}
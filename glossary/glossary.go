@@ -0,0 +1,313 @@
+// Package glossary manages company-specific terminology, i.e. approved translations of terms per language pair.
+package glossary
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNotFound is returned for operations on terms that do not exist.
+	ErrNotFound = errors.New("term not found")
+
+	// ErrInvalid is returned when adding terms without a source, target, or languages.
+	ErrInvalid = errors.New("terms require a source, a target and both languages")
+)
+
+// Term is the approved translation of a term from one language to another.
+// Terms for a language, e.g. de, also apply to its regional variants, e.g. de-CH.
+type Term struct {
+	ID            int          `json:"id"`
+	Source        string       `json:"source"`
+	SourceLang    language.Tag `json:"sourceLang"`
+	Target        string       `json:"target"`
+	TargetLang    language.Tag `json:"targetLang"`
+	CaseSensitive bool         `json:"caseSensitive,omitempty"`
+}
+
+// Match is an occurrence of a term in a text, from byte offset Start up to End.
+type Match struct {
+	Start, End int
+	Term       Term
+}
+
+// Glossary is a set of terms, safe for concurrent use. The zero value is an empty glossary kept in memory.
+type Glossary struct {
+	// Path is the JSON file changes are saved to, if set.
+	Path string
+
+	// OnChange is called with every term that was added, changed or deleted, e.g. to invalidate cached translations.
+	// Changed terms are passed both before and after the change. It is called with the glossary locked.
+	OnChange func(term Term)
+
+	lock     sync.RWMutex
+	terms    map[int]Term
+	patterns map[int]*regexp.Regexp
+	nextID   int
+	version  int
+}
+
+type glossaryFile struct {
+	Version int    `json:"version"`
+	Terms   []Term `json:"terms"`
+}
+
+// Open returns a glossary saved to the JSON file at path, with the terms stored there if it exists.
+func Open(path string) (*Glossary, error) {
+	g := &Glossary{Path: path}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file glossaryFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse glossary %v", path)
+	}
+
+	for _, term := range file.Terms {
+		if err := validate(term); err != nil {
+			return nil, errors.Wrapf(err, "term %d in %v", term.ID, path)
+		}
+		g.store(term)
+	}
+	g.version = file.Version
+
+	return g, nil
+}
+
+// validate checks that a term can be applied
+func validate(term Term) error {
+	if term.Source == "" || term.Target == "" || term.SourceLang == language.Und || term.TargetLang == language.Und {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+// covers returns true if terms for lang apply to tag, i.e. lang is tag or one of its parents
+func covers(lang, tag language.Tag) bool {
+	for ; tag != language.Und; tag = tag.Parent() {
+		if tag == lang {
+			return true
+		}
+	}
+
+	return false
+}
+
+// store adds or replaces a term. The caller must hold the lock.
+func (g *Glossary) store(term Term) {
+	if g.terms == nil {
+		g.terms = make(map[int]Term)
+		g.patterns = make(map[int]*regexp.Regexp)
+	}
+
+	pattern := regexp.QuoteMeta(term.Source)
+	if !term.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+
+	g.terms[term.ID] = term
+	g.patterns[term.ID] = regexp.MustCompile(pattern)
+
+	if term.ID >= g.nextID {
+		g.nextID = term.ID + 1
+	}
+}
+
+// save writes the glossary to its file, if it has one. The caller must hold the lock.
+func (g *Glossary) save() error {
+	if g.Path == "" {
+		return nil
+	}
+
+	file := glossaryFile{Version: g.version, Terms: g.list(language.Und, language.Und)}
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(g.Path, content, 0644)
+}
+
+// changed records a change and notifies OnChange. The caller must hold the lock.
+func (g *Glossary) changed(terms ...Term) error {
+	g.version++
+
+	if g.OnChange != nil {
+		for _, term := range terms {
+			g.OnChange(term)
+		}
+	}
+
+	return g.save()
+}
+
+// Version returns a number that increases whenever the glossary changes.
+func (g *Glossary) Version() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.version
+}
+
+// list returns the terms for a language pair, ordered by ID. The caller must hold the lock.
+func (g *Glossary) list(sourceLang, targetLang language.Tag) []Term {
+	terms := make([]Term, 0, len(g.terms))
+	for _, term := range g.terms {
+		if (sourceLang == language.Und || term.SourceLang == sourceLang) &&
+			(targetLang == language.Und || term.TargetLang == targetLang) {
+			terms = append(terms, term)
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].ID < terms[j].ID
+	})
+
+	return terms
+}
+
+// List returns the terms defined for a language pair. language.Und matches any language.
+func (g *Glossary) List(sourceLang, targetLang language.Tag) []Term {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.list(sourceLang, targetLang)
+}
+
+// Get returns the term with the given ID.
+func (g *Glossary) Get(id int) (Term, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	term, ok := g.terms[id]
+	if !ok {
+		return Term{}, ErrNotFound
+	}
+
+	return term, nil
+}
+
+// Add stores a new term, and returns it with its assigned ID.
+func (g *Glossary) Add(term Term) (Term, error) {
+	if err := validate(term); err != nil {
+		return Term{}, err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	term.ID = g.nextID
+	if term.ID == 0 {
+		term.ID = 1
+	}
+	g.store(term)
+
+	return term, g.changed(term)
+}
+
+// Update replaces the term with the given ID.
+func (g *Glossary) Update(id int, term Term) (Term, error) {
+	if err := validate(term); err != nil {
+		return Term{}, err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	previous, ok := g.terms[id]
+	if !ok {
+		return Term{}, ErrNotFound
+	}
+
+	term.ID = id
+	g.store(term)
+
+	return term, g.changed(previous, term)
+}
+
+// Delete removes the term with the given ID.
+func (g *Glossary) Delete(id int) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	term, ok := g.terms[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(g.terms, id)
+	delete(g.patterns, id)
+
+	return g.changed(term)
+}
+
+// wordBoundary returns true if the text has no letter or digit directly before start and at end,
+// so terms do not match in the middle of other words
+func wordBoundary(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (unicode.IsLetter(before) || unicode.IsDigit(before)) {
+		return false
+	}
+
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && (unicode.IsLetter(after) || unicode.IsDigit(after)) {
+		return false
+	}
+
+	return true
+}
+
+// Find returns the occurrences of terms applying to a language pair in text, ordered by their position.
+// Where terms overlap, the longer one is preferred.
+func (g *Glossary) Find(text string, sourceLang, targetLang language.Tag) []Match {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	var matches []Match
+	for id, term := range g.terms {
+		if !covers(term.SourceLang, sourceLang) || !covers(term.TargetLang, targetLang) {
+			continue
+		}
+
+		for _, location := range g.patterns[id].FindAllStringIndex(text, -1) {
+			if wordBoundary(text, location[0], location[1]) {
+				matches = append(matches, Match{location[0], location[1], term})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		if matches[i].End != matches[j].End {
+			return matches[i].End > matches[j].End
+		}
+		return matches[i].Term.ID < matches[j].Term.ID
+	})
+
+	// Drop matches overlapping a previous, longer one
+	kept := matches[:0]
+	end := 0
+	for _, match := range matches {
+		if match.Start >= end {
+			kept = append(kept, match)
+			end = match.End
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,98 @@
+package glossary
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlossary_CRUD(t *testing.T) {
+	var changed []Term
+	g := &Glossary{OnChange: func(term Term) { changed = append(changed, term) }}
+
+	term, err := g.Add(Term{Source: "cloud", SourceLang: language.English, Target: "Cloud", TargetLang: language.German})
+	if err != nil || term.ID == 0 {
+		t.Fatalf("Add should assign an ID: got %v (%v)", term.ID, err)
+	}
+
+	if _, err := g.Add(Term{Source: "cloud", SourceLang: language.English}); err != ErrInvalid {
+		t.Errorf("Add should reject incomplete terms: got %v", err)
+	}
+
+	term.Target = "Wolke"
+	if _, err := g.Update(term.ID, term); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := g.Get(term.ID); got.Target != "Wolke" {
+		t.Errorf("Update should replace the term: got %q", got.Target)
+	}
+
+	if len(g.List(language.English, language.French)) != 0 || len(g.List(language.Und, language.German)) != 1 {
+		t.Error("List should filter by language pair")
+	}
+
+	if err := g.Delete(term.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.Get(term.ID); err != ErrNotFound {
+		t.Errorf("Get should return ErrNotFound for deleted terms: got %v", err)
+	}
+
+	if g.Version() != 3 || len(changed) != 4 {
+		t.Errorf("every change should increase the version and notify: got version %v, %v notifications", g.Version(), len(changed))
+	}
+}
+
+func TestGlossary_Find(t *testing.T) {
+	g := &Glossary{}
+	g.Add(Term{Source: "Acme", SourceLang: language.English, Target: "Acme", TargetLang: language.German})
+	g.Add(Term{Source: "Acme Cloud", SourceLang: language.English, Target: "Acme-Cloud", TargetLang: language.German})
+	g.Add(Term{Source: "über", SourceLang: language.English, Target: "ueber", TargetLang: language.German, CaseSensitive: true})
+	g.Add(Term{Source: "Acme", SourceLang: language.English, Target: "Acmé", TargetLang: language.French})
+
+	matches := g.Find("Try acme cloud, Acmeware and Acme über ÜBER", language.English, language.MustParse("de-CH"))
+	if len(matches) != 3 {
+		t.Fatalf("Find should match whole words of the language pair: got %v", matches)
+	}
+
+	if matches[0].Start != 4 || matches[0].End != 14 || matches[0].Term.Target != "Acme-Cloud" {
+		t.Errorf("Find should prefer the longest overlapping term: got %v", matches[0])
+	}
+
+	if matches[1].Term.Source != "Acme" || matches[2].Term.Source != "über" {
+		t.Errorf("Find should match case-sensitive terms exactly: got %v", matches[1:])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glossary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "glossary.json")
+
+	g, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Add(Term{Source: "sign in", SourceLang: language.English, Target: "anmelden", TargetLang: language.German})
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reopened.List(language.Und, language.Und)) != 1 || reopened.Version() != 1 {
+		t.Error("Open should restore the saved terms and version")
+	}
+
+	term, _ := reopened.Add(Term{Source: "sign out", SourceLang: language.English, Target: "abmelden", TargetLang: language.German})
+	if term.ID != 2 {
+		t.Errorf("Open should continue assigning IDs after the saved ones: got %v", term.ID)
+	}
+}
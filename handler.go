@@ -2,22 +2,46 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"github.com/kuboschek/translate-server/cache"
+	"github.com/kuboschek/translate-server/segment"
 	"github.com/kuboschek/translate-server/upstream"
 	"golang.org/x/text/language"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
-const timeout = time.Second * 5
+const (
+	timeout = time.Second * 5
+
+	// maxParallelSegments limits how many sentences of one text are translated at the same time
+	maxParallelSegments = 8
+)
+
+var (
+	errAllFailed = errors.New("all upstream services failed to translate")
+	errTimeout   = errors.New("upstream service timed out")
+
+	// servicesLock guards the order of services, which translations running at the same time change
+	servicesLock sync.Mutex
+
+	// servicesOrder counts the changes to the order of services
+	servicesOrder int
+)
 
 // TranslateHandler is an HTTP handler that proxies translation requests to upstream providers.
 //
 type TranslateHandler struct {
 	Services []upstream.Service
 	Cache    cache.Cache
+
+	// Memory holds human translations, which are served before cached or new machine translations
+	Memory *upstream.TranslationMemory
 }
 
 // writeSuccess sets appropriate headers, then writes the translated string to the ResponseWriter
@@ -47,19 +71,75 @@ func (h TranslateHandler) ServeHTTP(response http.ResponseWriter, request *http.
 		return
 	}
 
+	contentLanguage, targetLanguage, ok := readLanguages(response, request)
+	if !ok {
+		return
+	}
+
+	// Get phrase to be translated
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(request.Body)
+	givenPhrase := buf.String()
+
+	// Documents with markup are translated by their format
+	contentType := request.Header.Get("Content-Type")
+	if contentType != "" {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Forms hold a bundle with the existing translations to update
+		if mediaType == "multipart/form-data" {
+			h.serveBundleUpdate(response, params["boundary"], givenPhrase, contentLanguage, targetLanguage)
+			return
+		}
+
+		// Other bodies, like form encoding that clients like cURL send by default, are treated as plain text
+		if isDocument(mediaType, givenPhrase) {
+			h.serveDocument(response, mediaType, givenPhrase, request.URL.Query(), contentLanguage, targetLanguage)
+			return
+		}
+	}
+
+	result, err := h.translateText(givenPhrase, contentLanguage, targetLanguage)
+	if err != nil {
+		// At this point, we've run out of services to try - so we fail hard, and respond with an error
+		response.WriteHeader(http.StatusBadGateway)
+		io.WriteString(response, "All upstream services failed to translate.")
+		return
+	}
+
+	// Mark translations that went through an intermediate language
+	if result.Pivot != language.Und {
+		response.Header().Set("X-Translation-Pivot", result.Pivot.String())
+	}
+
+	// Report how closely a stored human translation matched
+	if result.MatchScore > 0 {
+		response.Header().Set("X-Translation-Match", strconv.FormatFloat(result.MatchScore, 'f', 2, 64))
+	}
+
+	writeSuccess(response, result.TargetLang, result.TranslatedPhrase)
+}
+
+// readLanguages reads the given language from the Content-Language header, and the target language from the
+// Accept-Language header. If either is missing or invalid, it responds with an error.
+func readLanguages(response http.ResponseWriter, request *http.Request) (language.Tag, language.Tag, bool) {
 	// Get and parse target language (Accept-Language header)
 	tags, _, err := language.ParseAcceptLanguage(request.Header.Get("Accept-Language"))
 
 	if err != nil {
 		http.Error(response, err.Error(), http.StatusBadRequest)
-		return
+		return language.Und, language.Und, false
 	}
 
 	// Check that a target language has been sent in the request
 	if len(tags) < 1 {
 		response.WriteHeader(http.StatusBadRequest)
 		response.Write([]byte("No Accept-Language header specified\n"))
-		return
+		return language.Und, language.Und, false
 	}
 	targetLanguage := tags[0]
 
@@ -69,65 +149,289 @@ func (h TranslateHandler) ServeHTTP(response http.ResponseWriter, request *http.
 	if err != nil {
 		response.WriteHeader(http.StatusBadRequest)
 		response.Write([]byte("No Content-Language header specified\n"))
+		return language.Und, language.Und, false
+	}
+
+	return contentLanguage, targetLanguage, true
+}
+
+// callService runs a service, and waits for its result for a specified time
+func callService(svc upstream.Service, givenPhrase string, contentLanguage, targetLanguage language.Tag) upstream.Result {
+	// Services may close the channel when done, so every call needs its own
+	serviceResponse := make(chan upstream.Result)
+	go svc.Translate(givenPhrase, contentLanguage, targetLanguage, &serviceResponse)
+
+	select {
+	case result, ok := <-serviceResponse:
+		if !ok {
+			return upstream.Result{Error: errors.New("service returned no result")}
+		}
+		return result
+
+	case <-time.After(timeout):
+		return upstream.Result{Error: errTimeout}
+	}
+}
+
+// callBatch runs a service translating a batch of phrases, and waits for its result for a specified time
+func callBatch(svc upstream.BatchService, phrases []string, contentLanguage, targetLanguage language.Tag) ([]string, error) {
+	type batchResult struct {
+		translated []string
+		err        error
+	}
+
+	// Buffered, so the service can finish after the call timed out
+	done := make(chan batchResult, 1)
+	go func() {
+		translated, err := svc.TranslateBatch(phrases, contentLanguage, targetLanguage)
+		done <- batchResult{translated, err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err == nil && len(result.translated) != len(phrases) {
+			return nil, errors.New("service returned wrong number of translations")
+		}
+		return result.translated, result.err
+
+	case <-time.After(timeout):
+		return nil, errTimeout
+	}
+}
+
+// services returns a copy of the services in their current order, and the number of changes to the order so far
+func (h TranslateHandler) services() ([]upstream.Service, int) {
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+
+	return append([]upstream.Service(nil), h.Services...), servicesOrder
+}
+
+// demote moves a failing service to the back of the list. If other translations changed the order since it was
+// copied, the service is left where it is, as its index is no longer known.
+func (h TranslateHandler) demote(index int, order *int) {
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+
+	if *order != servicesOrder {
 		return
 	}
 
-	// Get phrase to be translated
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(request.Body)
-	givenPhrase := buf.String()
+	h.moveToBack(index)
+	servicesOrder++
+	*order = servicesOrder
+}
 
-	// Check for a cached response, if a cache is available
-	if h.Cache != nil {
-		cached, err := h.Cache.Get(givenPhrase, targetLanguage)
-		if err == nil {
-			writeSuccess(response, targetLanguage, cached)
-			return
+// translateText translates a text a sentence at a time, so sentences are cached on their own, and services are not
+// sent long texts. Sentences are translated concurrently, and joined with the whitespace between them.
+func (h TranslateHandler) translateText(givenPhrase string, contentLanguage, targetLanguage language.Tag) (upstream.Result, error) {
+	segments := segment.Split(givenPhrase, contentLanguage)
+
+	sentences := 0
+	for _, s := range segments {
+		if s.Text != "" {
+			sentences++
 		}
 	}
+	if sentences <= 1 {
+		return h.translate(givenPhrase, contentLanguage, targetLanguage)
+	}
 
-	serviceResponse := make(chan upstream.Result)
+	results := make([]upstream.Result, len(segments))
+	errs := make([]error, len(segments))
+	limit := make(chan struct{}, maxParallelSegments)
+
+	batched := h.translateBatch(segments, contentLanguage, targetLanguage)
+
+	var wg sync.WaitGroup
+	for i, s := range segments {
+		if s.Text == "" {
+			continue
+		}
+		if result, ok := batched[s.Text]; ok {
+			results[i] = result
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, sentence string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			results[i], errs[i] = h.translate(sentence, contentLanguage, targetLanguage)
+		}(i, s.Text)
+	}
+	wg.Wait()
+
+	combined := upstream.Result{
+		GivenLang:   contentLanguage,
+		GivenPhrase: givenPhrase,
+		TargetLang:  targetLanguage,
+		Pivot:       language.Und,
+		MatchScore:  1,
+	}
+
+	for i, s := range segments {
+		if s.Text == "" {
+			continue
+		}
+		if errs[i] != nil {
+			return upstream.Result{}, errs[i]
+		}
+
+		segments[i].Text = results[i].TranslatedPhrase
+		if combined.Pivot == language.Und {
+			combined.Pivot = results[i].Pivot
+		}
+
+		// The text only matched stored translations as well as its worst sentence
+		if results[i].MatchScore < combined.MatchScore {
+			combined.MatchScore = results[i].MatchScore
+		}
+	}
+
+	segment.Respace(segments, targetLanguage)
+	combined.TranslatedPhrase = segment.Join(segments)
+	return combined, nil
+}
+
+// translateBatch translates the sentences without stored or cached translations with one request, if the first
+// service translates batches. It returns the translations by sentence, or nil if the sentences are to be translated
+// one at a time, as they are when the batch fails.
+func (h TranslateHandler) translateBatch(segments []segment.Segment, contentLanguage, targetLanguage language.Tag) map[string]upstream.Result {
+	services, _ := h.services()
+	if len(services) == 0 {
+		return nil
+	}
+
+	batcher, ok := services[0].(upstream.BatchService)
+	if !ok {
+		return nil
+	}
+
+	var phrases []string
+	seen := map[string]bool{}
+	for _, s := range segments {
+		if s.Text == "" || seen[s.Text] {
+			continue
+		}
+		seen[s.Text] = true
+
+		if _, ok := h.stored(s.Text, contentLanguage, targetLanguage); !ok {
+			phrases = append(phrases, s.Text)
+		}
+	}
+	if len(phrases) <= 1 {
+		return nil
+	}
+
+	translated, err := callBatch(batcher, phrases, contentLanguage, targetLanguage)
+	if err != nil {
+		if err != upstream.ErrNoBatch {
+			log.Printf("failed to translate %v sentences at once: %v", len(phrases), err)
+		}
+		return nil
+	}
+
+	results := make(map[string]upstream.Result, len(phrases))
+	for i, phrase := range phrases {
+		result := upstream.Result{
+			GivenLang:        contentLanguage,
+			GivenPhrase:      phrase,
+			TargetLang:       targetLanguage,
+			TranslatedPhrase: translated[i],
+		}
+		h.store(result)
+		results[phrase] = result
+	}
+
+	return results
+}
+
+// translate returns a stored human translation, a cached translation, or the result of the first service to translate
+// the phrase
+func (h TranslateHandler) translate(givenPhrase string, contentLanguage, targetLanguage language.Tag) (upstream.Result, error) {
+	if result, ok := h.stored(givenPhrase, contentLanguage, targetLanguage); ok {
+		return result, nil
+	}
+
+	// Failing services are moved back while iterating, so iterate over a copy
+	services, order := h.services()
+	moved := 0
 
 	// Go through all the services in order - return the first successful result
-	for index, svc := range h.Services {
-		go svc.Translate(givenPhrase, contentLanguage, targetLanguage, &serviceResponse)
-
-		// Wait for the response from the service for a specified time
-		select {
-		case result := <-serviceResponse:
-			if result.Error == nil {
-
-				// Store translation in cache asynchronously
-				if h.Cache != nil {
-					go func() {
-						err := h.Cache.Put(result.GivenPhrase, result.TargetLang, result.TranslatedPhrase)
-						if err != nil {
-							log.Printf("failed to store translation in cache: %v", err)
-						}
-					}()
-				}
-
-				writeSuccess(response, result.TargetLang, result.TranslatedPhrase)
-				return
-			}
+	for index, svc := range services {
+		result := callService(svc, givenPhrase, contentLanguage, targetLanguage)
 
-			// Move the failing service to the end of the list
-			h.moveToBack(index)
-			log.Printf("failed to fetch translations: %v", result.Error)
+		switch result.Error {
+		case nil:
+			h.store(result)
+			return result, nil
 
-			break
+		case upstream.ErrNoMatch:
+			// Services without a translation for this phrase have not failed
 
-		case <-time.After(timeout):
+		case errTimeout:
 			// Also move a service back in the list if it times out
-			h.moveToBack(index)
+			h.demote(index-moved, &order)
+			moved++
 			log.Printf("upstream service timed out after: %v", timeout)
-			break
+
+		default:
+			// Move the failing service to the end of the list
+			h.demote(index-moved, &order)
+			moved++
+			log.Printf("failed to fetch translations: %v", result.Error)
 		}
 	}
 
 	log.Printf("all services failed to translate \"%v\" (%v -> %v)", givenPhrase, contentLanguage, targetLanguage)
+	return upstream.Result{}, errAllFailed
+}
+
+// stored returns a stored human translation or a cached translation of a phrase, if there is one
+func (h TranslateHandler) stored(givenPhrase string, contentLanguage, targetLanguage language.Tag) (upstream.Result, bool) {
+	// Human translations win over machine translations, even those cached before they were stored
+	if h.Memory != nil {
+		entry, score, ok := h.Memory.Lookup(givenPhrase, contentLanguage, targetLanguage)
+		if ok {
+			return upstream.Result{
+				GivenLang:        contentLanguage,
+				GivenPhrase:      givenPhrase,
+				TargetLang:       targetLanguage,
+				TranslatedPhrase: entry.Target,
+				Pivot:            language.Und,
+				MatchScore:       score,
+			}, true
+		}
+	}
+
+	// Check for a cached response, if a cache is available
+	if h.Cache != nil {
+		cached, err := h.Cache.Get(givenPhrase, targetLanguage)
+		if err == nil {
+			return upstream.Result{
+				GivenLang:        contentLanguage,
+				GivenPhrase:      givenPhrase,
+				TargetLang:       targetLanguage,
+				TranslatedPhrase: cached,
+			}, true
+		}
+	}
 
-	// At this point, we've run out of services to try - so we fail hard, and respond with an error
-	response.WriteHeader(http.StatusBadGateway)
-	io.WriteString(response, "All upstream services failed to translate.")
+	return upstream.Result{}, false
+}
+
+// store caches a translation asynchronously. Stored human translations need no caching, and translations through an
+// intermediate language are not cached, as cached translations are not marked as pivoted.
+func (h TranslateHandler) store(result upstream.Result) {
+	if h.Cache != nil && result.MatchScore == 0 && result.Pivot == language.Und {
+		go func() {
+			err := h.Cache.Put(result.GivenPhrase, result.TargetLang, result.TranslatedPhrase)
+			if err != nil {
+				log.Printf("failed to store translation in cache: %v", err)
+			}
+		}()
+	}
 }
@@ -7,9 +7,11 @@ import (
 	"github.com/kuboschek/translate-server/upstream"
 	"golang.org/x/text/language"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -106,6 +108,7 @@ func TestSuccessResponse(t *testing.T) {
 			upstream.Mock{},
 		},
 		nil,
+		nil,
 	}
 	translateHandler.ServeHTTP(rr, req)
 
@@ -177,6 +180,7 @@ func TestCachedResponseCorrect(t *testing.T) {
 			},
 		},
 		cache.Memory,
+		nil,
 	}
 	handler.ServeHTTP(rr, req)
 
@@ -218,6 +222,7 @@ func TestMoveToBack(t *testing.T) {
 			},
 		},
 		nil,
+		nil,
 	}
 
 	handler.moveToBack(0)
@@ -250,6 +255,7 @@ func TestTimeOut(t *testing.T) {
 			},
 		},
 		nil,
+		nil,
 	}
 
 	handler.ServeHTTP(rr, req)
@@ -258,3 +264,520 @@ func TestTimeOut(t *testing.T) {
 		t.Error("handler should return a 502 when upstream services time out")
 	}
 }
+
+// TestReplayedResponses runs recorded upstream payloads through the handler and the Azure client end-to-end
+func TestReplayedResponses(t *testing.T) {
+	replay := &http.Client{Transport: &upstream.Replay{Path: "testdata/replay.jsonl"}}
+
+	cases := []struct {
+		phrase, from, to string
+		code             int
+		want             string
+	}{
+		{"Wo ist der nächste Bahnhof?", "de", "en", http.StatusOK, "Where is the nearest train station?"},
+		{"Danke für deine Nachricht! 😊 Ich melde mich morgen.", "de", "ja", http.StatusOK, "メッセージをありがとう！😊 明日連絡します。"},
+		{"Unübersetzbar", "de", "en", http.StatusBadGateway, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.phrase))
+		req.Header.Set("Accept-Language", c.to)
+		req.Header.Set("Content-Language", c.from)
+		rr := httptest.NewRecorder()
+
+		handler := TranslateHandler{
+			Services: []upstream.Service{
+				upstream.Azure{ServiceKey: "any", Client: replay},
+			},
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("unexpected status for %q: got %v want %v", c.phrase, rr.Code, c.code)
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler should return the recorded translation: got %v want %v", rr.Body.String(), c.want)
+		}
+
+		if c.code == http.StatusOK && rr.Header().Get("Content-Language") != c.to {
+			t.Errorf("handler should set Content-Language to the target: got %v want %v", rr.Header().Get("Content-Language"), c.to)
+		}
+	}
+}
+
+// TestPivotHeader checks that translations through an intermediate language are marked
+func TestPivotHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("Guten Morgen."))
+	req.Header.Set("Accept-Language", "fr")
+	req.Header.Set("Content-Language", "de")
+	rr := httptest.NewRecorder()
+
+	handler := TranslateHandler{
+		Services: []upstream.Service{
+			upstream.Pivot{
+				Direct:  unsupportedService{},
+				Handler: upstream.Mock{},
+			},
+		},
+		Cache: cache.Memory,
+	}
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected OK status: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if rr.Header().Get("X-Translation-Pivot") != "en" {
+		t.Errorf("handler should mark pivoted translations: got %q", rr.Header().Get("X-Translation-Pivot"))
+	}
+
+	// Pivoted translations are not cached, so they are marked every time
+	time.Sleep(10 * time.Millisecond)
+	if _, err := handler.Cache.Get("Guten Morgen.", language.French); err == nil {
+		t.Error("handler should not cache pivoted translations")
+	}
+}
+
+// unsupportedService supports no language pair
+type unsupportedService struct{}
+
+func (unsupportedService) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan upstream.Result) {
+	defer close(*out)
+	*out <- upstream.Result{Error: &upstream.UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang}}
+}
+
+// TestTranslationMemoryFallthrough checks that phrases missing from a translation memory are passed on, and that
+// stored translations win over cached ones
+func TestTranslationMemoryFallthrough(t *testing.T) {
+	memory := &upstream.TranslationMemory{}
+	memory.Add(upstream.MemoryEntry{Source: "Save changes", SourceLang: language.English, Target: "Änderungen speichern", TargetLang: language.German})
+
+	handler := TranslateHandler{
+		Services: []upstream.Service{upstream.Mock{}},
+		Cache:    cache.Memory,
+		Memory:   memory,
+	}
+	cache.Memory.Put("Save changes", language.German, "Speichere Änderungen")
+
+	cases := []struct {
+		phrase, want, match string
+	}{
+		{"Save changes", "Änderungen speichern", "1.00"},
+		{"Open file", "Open file", ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.phrase))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK || rr.Body.String() != c.want {
+			t.Errorf("handler should translate %q: got %v %q", c.phrase, rr.Code, rr.Body.String())
+		}
+
+		if rr.Header().Get("X-Translation-Match") != c.match {
+			t.Errorf("handler should report the match score of %q: got %q want %q", c.phrase, rr.Header().Get("X-Translation-Match"), c.match)
+		}
+	}
+}
+
+// TestMessageFormat checks that ICU messages are translated without breaking their syntax
+func TestMessageFormat(t *testing.T) {
+	handler := TranslateHandler{
+		Services: []upstream.Service{upstream.Mock{}},
+	}
+
+	cases := []struct {
+		contentType, body string
+		code              int
+		want              string
+	}{
+		{"text/x-icu-messageformat", "{count, plural, one {# file} other {# files}} in {folder}", http.StatusOK,
+			"{count, plural, one {# file} few {# files} many {# files} other {# files}} in {folder}"},
+		{"text/x-icu-messageformat; charset=utf-8", "{count, plural, one {# file}}", http.StatusBadRequest, ""},
+		{"application/x-unknown", "Hello", http.StatusOK, "Hello"},
+		{"application/json", `"Hello"`, http.StatusOK, `"Hello"`},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.body))
+		req.Header.Set("Accept-Language", "ru")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", c.contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("handler should respond to %v with %v: got %v %v", c.contentType, c.code, rr.Code, rr.Body.String())
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler should translate the message: got %q want %q", rr.Body.String(), c.want)
+		}
+	}
+}
+
+// htmlService translates HTML by replacing a word, or text by upper-casing it
+type htmlService struct {
+	html        bool
+	replacement string
+}
+
+func (s htmlService) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan upstream.Result) {
+	defer close(*out)
+
+	translated := strings.ToUpper(givenPhrase)
+	if s.html {
+		translated = strings.Replace(givenPhrase, "Hello", s.replacement, -1)
+	}
+
+	*out <- upstream.Result{GivenPhrase: givenPhrase, TranslatedPhrase: translated, GivenLang: givenLang, TargetLang: targetLang}
+}
+
+func (s htmlService) WithHTML() (upstream.Service, bool) {
+	s.html = true
+	return s, true
+}
+
+// TestHTMLDocument checks that HTML is translated by services supporting it, unless they break the markup
+func TestHTMLDocument(t *testing.T) {
+	cases := []struct {
+		service upstream.Service
+		want    string
+	}{
+		{htmlService{replacement: "Hallo"}, "<p>Hallo <b>world</b></p>"},
+		{htmlService{replacement: "<i>Hallo</i>"}, "<p>HELLO <b>WORLD</b></p>"},
+		{upstream.Mock{}, "<p>Hello <b>world</b></p>"},
+	}
+
+	for _, c := range cases {
+		handler := TranslateHandler{Services: []upstream.Service{c.service}}
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("<p>Hello <b>world</b></p>"))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", "text/html; charset=utf-8")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("handler should translate HTML with %#v: got %v %v", c.service, rr.Code, rr.Body.String())
+		}
+
+		if rr.Body.String() != c.want {
+			t.Errorf("handler translated HTML incorrectly with %#v: got %q want %q", c.service, rr.Body.String(), c.want)
+		}
+	}
+}
+
+// TestHTMLDocumentMemory checks that human translations of sentences win over services translating whole documents
+func TestHTMLDocumentMemory(t *testing.T) {
+	memory := &upstream.TranslationMemory{}
+	memory.Add(upstream.MemoryEntry{Source: "Hello", SourceLang: language.English, Target: "Servus", TargetLang: language.German})
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{replacement: "Hallo"}}, Memory: memory}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("<p>Hello</p>"))
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", "text/html")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "<p>Servus</p>" {
+		t.Errorf("handler should translate HTML from the translation memory: got %v %q", rr.Code, rr.Body.String())
+	}
+
+	// Services still translate documents the memory has nothing for as a whole
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("<p>Hello world</p><p>Hello there</p>"))
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", "text/html")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "<p>Hallo world</p><p>Hallo there</p>" {
+		t.Errorf("handler should translate HTML with the service if the memory has no match: got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+// TestMarkdownDocument checks that only the prose of Markdown documents is translated
+func TestMarkdownDocument(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("# Hello\n\nRun `make` [now](/run)."))
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", "text/markdown")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	want := "# HELLO\n\nRUN `make` [NOW](/run)."
+	if rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("handler should translate Markdown: got %v %q want %q", rr.Code, rr.Body.String(), want)
+	}
+}
+
+// TestSegmentedText checks that long texts are translated and cached a sentence at a time
+func TestSegmentedText(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}, Cache: cache.Memory}
+
+	body := "First sentence. Second one!\n\n  Third paragraph."
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Accept-Language", "fr")
+	req.Header.Set("Content-Language", "en")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	want := "FIRST SENTENCE. SECOND ONE!\n\n  THIRD PARAGRAPH."
+	if rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("handler should translate each sentence, keeping whitespace: got %v %q want %q", rr.Code, rr.Body.String(), want)
+	}
+
+	// Wait here to allow the async cache writes to finish
+	time.Sleep(100 * time.Millisecond)
+
+	for _, sentence := range []string{"First sentence.", "Second one!", "Third paragraph."} {
+		if !cache.Memory.Has(sentence, language.French) {
+			t.Errorf("handler should cache sentence %q on its own", sentence)
+		}
+	}
+
+	if cache.Memory.Has(body, language.French) {
+		t.Error("handler should not cache the whole text")
+	}
+}
+
+// batchService upper-cases phrases, and records the batches it translates
+type batchService struct {
+	batches *[][]string
+}
+
+func (s batchService) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan upstream.Result) {
+	defer close(*out)
+	*out <- upstream.Result{GivenPhrase: givenPhrase, TranslatedPhrase: strings.ToUpper(givenPhrase), GivenLang: givenLang, TargetLang: targetLang}
+}
+
+func (s batchService) TranslateBatch(phrases []string, givenLang, targetLang language.Tag) ([]string, error) {
+	*s.batches = append(*s.batches, phrases)
+
+	translated := make([]string, len(phrases))
+	for i, phrase := range phrases {
+		translated[i] = strings.ToUpper(phrase)
+	}
+	return translated, nil
+}
+
+// TestBatchedText checks that the sentences of a text are translated with one request by services supporting it
+func TestBatchedText(t *testing.T) {
+	var batches [][]string
+	memory := &upstream.TranslationMemory{}
+	memory.Add(upstream.MemoryEntry{Source: "Second one!", SourceLang: language.English, Target: "Zweiter!", TargetLang: language.German})
+	handler := TranslateHandler{Services: []upstream.Service{batchService{&batches}}, Memory: memory}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("First sentence. Second one! Third sentence."))
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Content-Language", "en")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	want := "FIRST SENTENCE. Zweiter! THIRD SENTENCE."
+	if rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("handler should translate batched sentences: got %v %q want %q", rr.Code, rr.Body.String(), want)
+	}
+
+	if len(batches) != 1 || strings.Join(batches[0], "|") != "First sentence.|Third sentence." {
+		t.Errorf("handler should batch the sentences without stored translations: got %q", batches)
+	}
+}
+
+// TestPODocument checks that untranslated messages of PO files are translated and marked fuzzy
+func TestPODocument(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	body := "msgid \"\"\nmsgstr \"\"\n\"Language: \\n\"\n\n#, c-format\nmsgid \"%d file\"\nmsgid_plural \"%d files\"\nmsgstr[0] \"\"\nmsgstr[1] \"\"\n"
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Accept-Language", "fr")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", "text/x-gettext-translation-template")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	want := "msgid \"\"\nmsgstr \"\"\n\"Language: fr\\n\"\n\"Plural-Forms: nplurals=2; plural=(n > 1);\\n\"\n\n" +
+		"#, c-format, fuzzy\nmsgid \"%d file\"\nmsgid_plural \"%d files\"\nmsgstr[0] \"%d FILE\"\nmsgstr[1] \"%d FILES\"\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("handler should translate PO files: got %v %q want %q", rr.Code, rr.Body.String(), want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Accept-Language", "tlh")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", "text/x-po")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler should reject plural messages for languages without known plural forms: got %v", rr.Code)
+	}
+}
+
+// TestXLIFFDocument checks that untranslated XLIFF units get a target, and invalid documents are rejected
+func TestXLIFFDocument(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	cases := []struct {
+		body string
+		code int
+		want string
+	}{
+		{`<xliff version="2.0" srcLang="en" trgLang="de"><file id="f"><unit id="u"><segment><source>Hi</source></segment></unit></file></xliff>`,
+			http.StatusOK,
+			`<xliff version="2.0" srcLang="en" trgLang="de"><file id="f"><unit id="u"><segment state="translated" subState="mt:machine-translation"><source>Hi</source><target>HI</target></segment></unit></file></xliff>`},
+		{`<xliff version="2.0"><file>`, http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.body))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", "application/xliff+xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("handler should respond to %q with %v: got %v %v", c.body, c.code, rr.Code, rr.Body.String())
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler translated XLIFF incorrectly: got %q want %q", rr.Body.String(), c.want)
+		}
+	}
+}
+
+func TestResourceDocuments(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	cases := []struct {
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{"application/x-android-resources+xml",
+			`<resources><string name="hi">Hi %1$s</string><string name="id" translatable="false">x</string></resources>`,
+			http.StatusOK,
+			`<resources><string name="hi">HI %1$s</string></resources>`},
+		{"text/x-apple-strings", `"hi" = "Hi %@";`, http.StatusOK, `"hi" = "HI %@";`},
+		{"application/x-arb+json", `{"hi": "Hi {name}"}`, http.StatusOK, `{"@@locale": "de","hi": "HI {name}"}`},
+		{"application/x-apple-stringsdict+xml", `<plist><dict>`, http.StatusBadRequest, ""},
+		{"text/x-apple-strings", `"hi" = `, http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.body))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", c.contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("handler should respond to %q with %v: got %v %v", c.body, c.code, rr.Code, rr.Body.String())
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler translated %v incorrectly: got %q want %q", c.contentType, rr.Body.String(), c.want)
+		}
+	}
+}
+
+func TestBundleDocuments(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	cases := []struct {
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{"application/json", `{"nav": {"home": "Home {{count}}"}}`, http.StatusOK, "{\n  \"nav\": {\n    \"home\": \"HOME {{count}}\"\n  }\n}\n"},
+		{"application/x-yaml", "en:\n  hello: \"Hi %{name}\"\n", http.StatusOK, "de:\n  hello: \"HI %{name}\"\n"},
+		{"application/json", `{"nav": `, http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(c.body))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", c.contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("handler should respond to %q with %v: got %v %v", c.body, c.code, rr.Code, rr.Body.String())
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler translated %v incorrectly: got %q want %q", c.contentType, rr.Body.String(), c.want)
+		}
+	}
+
+	// Strings of a target bundle are kept
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	form.WriteField("source", `{"a": "One", "b": "Two"}`)
+	form.WriteField("target", `{"a": "Eins"}`)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Content-Language", "en")
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if want := "{\n  \"a\": \"Eins\",\n  \"b\": \"TWO\"\n}\n"; rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("handler should translate strings missing from the target: got %v %q want %q", rr.Code, rr.Body.String(), want)
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("handler should respond with the format of the source: got %q", rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestSubtitleDocuments(t *testing.T) {
+	handler := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+
+	cases := []struct {
+		contentType string
+		query       string
+		body        string
+		code        int
+		want        string
+	}{
+		{"application/x-subrip", "", "1\n00:00:01,000 --> 00:00:02,000\n<i>Hello</i> there\n",
+			http.StatusOK, "1\n00:00:01,000 --> 00:00:02,000\n<i>HELLO</i> THERE\n"},
+		{"text/vtt", "?linelength=8", "WEBVTT\n\n00:01.000 --> 00:02.000\nHello there\n",
+			http.StatusOK, "WEBVTT\n\n00:01.000 --> 00:02.000\nHELLO\nTHERE\n"},
+		{"text/vtt", "", "00:01.000 --> 00:02.000\nHello\n", http.StatusBadRequest, ""},
+		{"text/vtt", "?linelength=wide", "WEBVTT\n", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/"+c.query, bytes.NewBufferString(c.body))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", c.contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.code {
+			t.Errorf("handler should respond to %q with %v: got %v %v", c.body, c.code, rr.Code, rr.Body.String())
+		}
+
+		if c.code == http.StatusOK && rr.Body.String() != c.want {
+			t.Errorf("handler translated %v incorrectly: got %q want %q", c.contentType, rr.Body.String(), c.want)
+		}
+	}
+}
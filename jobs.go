@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/kuboschek/translate-server/jobs"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var errJobFailed = errors.New("upstream services failed to translate the document")
+
+// JobsHandler is an HTTP handler running translations in the background, for documents too large to translate
+// within a request. POST requests to the collection take the same headers and body as the translation endpoint, and
+// return the job. Jobs, addressed by appending their ID to the path, report their state and result (GET). The
+// translated document alone is returned by appending /result.
+type JobsHandler struct {
+	Queue *jobs.Queue
+
+	// Prefix is the path of the collection, e.g. /v1/jobs
+	Prefix string
+}
+
+// jobStatus is a job as reported to clients, without the document to translate
+type jobStatus struct {
+	ID          string    `json:"id"`
+	State       string    `json:"state"`
+	SourceLang  string    `json:"sourceLang"`
+	TargetLang  string    `json:"targetLang"`
+	ContentType string    `json:"contentType"`
+	Translated  int       `json:"translated"`
+	Result      string    `json:"result,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+func newJobStatus(job jobs.Job) jobStatus {
+	return jobStatus{
+		ID:          job.ID,
+		State:       string(job.State),
+		SourceLang:  job.SourceLang.String(),
+		TargetLang:  job.TargetLang.String(),
+		ContentType: job.ContentType,
+		Translated:  job.Translated,
+		Result:      job.Result,
+		Error:       job.Error,
+		Created:     job.Created,
+		Updated:     job.Updated,
+	}
+}
+
+func (h JobsHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, h.Prefix), "/")
+	if path == "" {
+		if request.Method != http.MethodPost {
+			response.WriteHeader(http.StatusMethodNotAllowed)
+			io.WriteString(response, "Only POST requests are allowed")
+			return
+		}
+
+		h.submitJob(response, request)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(response, "Only GET requests are allowed")
+		return
+	}
+
+	id := strings.TrimSuffix(path, "/result")
+	job, err := h.Queue.Get(id)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if id == path {
+		writeJSON(response, http.StatusOK, newJobStatus(job))
+		return
+	}
+
+	if job.State != jobs.Done {
+		http.Error(response, fmt.Sprintf("Job is %v", job.State), http.StatusConflict)
+		return
+	}
+
+	headers := response.Header()
+	headers.Set("Content-Type", job.ContentType)
+	headers.Set("Content-Language", job.TargetLang.String())
+	response.WriteHeader(http.StatusOK)
+	io.WriteString(response, job.Result)
+}
+
+// submitJob queues the document of a request for translation
+func (h JobsHandler) submitJob(response http.ResponseWriter, request *http.Request) {
+	contentLanguage, targetLanguage, ok := readLanguages(response, request)
+	if !ok {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(request.Body)
+
+	// Bodies are translated as by the translation endpoint, except for bundle updates, which have a form of their own
+	mediaType := "text/plain"
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if parsed == "multipart/form-data" {
+			http.Error(response, "Bundle updates cannot run as jobs", http.StatusUnsupportedMediaType)
+			return
+		}
+		if isDocument(parsed, buf.String()) {
+			mediaType = parsed
+		}
+	}
+
+	job, err := h.Queue.Submit(jobs.Job{
+		SourceLang:  contentLanguage,
+		TargetLang:  targetLanguage,
+		ContentType: mediaType,
+		Options:     request.URL.Query(),
+		Document:    buf.String(),
+	})
+	switch err {
+	case nil:
+	case jobs.ErrQueueFull:
+		http.Error(response, err.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Location", strings.TrimSuffix(h.Prefix, "/")+"/"+job.ID)
+	writeJSON(response, http.StatusAccepted, newJobStatus(job))
+}
+
+// runJob translates the document of a job, as the translation endpoint would
+func (h TranslateHandler) runJob(job jobs.Job, progress func()) (string, error) {
+	if job.ContentType == "text/plain" {
+		result, err := h.translateText(job.Document, job.SourceLang, job.TargetLang)
+		if err != nil {
+			return "", errJobFailed
+		}
+		progress()
+		return result.TranslatedPhrase, nil
+	}
+
+	format, ok := formats[job.ContentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported content type %v", job.ContentType)
+	}
+
+	translated, err := format(job.Document, Translator{
+		GivenLang:  job.SourceLang,
+		TargetLang: job.TargetLang,
+		Options:    url.Values(job.Options),
+		handler:    h,
+		progress:   progress,
+	})
+	if _, ok := err.(invalidDocument); ok {
+		return "", err
+	}
+	if err != nil {
+		log.Printf("failed to translate %v document of job %v (%v -> %v): %v", job.ContentType, job.ID, job.SourceLang, job.TargetLang, err)
+		return "", errJobFailed
+	}
+
+	return translated, nil
+}
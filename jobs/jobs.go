@@ -0,0 +1,386 @@
+// Package jobs runs translations in the background, for documents that take longer than a request may. Jobs are
+// processed by a pool of workers, and saved to a directory, so unfinished jobs are resumed after a restart.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State is the state of a job.
+type State string
+
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+// Retention is how long finished jobs are kept for their results to be fetched.
+const Retention = 24 * time.Hour
+
+// maxQueued is the largest number of jobs waiting for a worker
+const maxQueued = 1000
+
+// maxAttempts is how often a job is started. Jobs that were running when the server stopped are started again, but
+// not forever, in case they were what stopped it.
+const maxAttempts = 3
+
+// expireInterval is the time between removals of expired jobs
+const expireInterval = time.Hour
+
+var (
+	// ErrNotFound is returned for jobs that do not exist, or were removed after the retention period.
+	ErrNotFound = errors.New("job not found")
+
+	// ErrQueueFull is returned when submitting jobs while too many are waiting.
+	ErrQueueFull = errors.New("too many jobs waiting")
+
+	// ErrCrashed is the error of jobs that failed unexpectedly, or were running whenever the server stopped.
+	ErrCrashed = errors.New("translating the document failed unexpectedly")
+)
+
+// Job is a document to translate, with the state of its translation.
+type Job struct {
+	ID    string `json:"id"`
+	State State  `json:"state"`
+
+	SourceLang  language.Tag        `json:"sourceLang"`
+	TargetLang  language.Tag        `json:"targetLang"`
+	ContentType string              `json:"contentType"`
+	Options     map[string][]string `json:"options,omitempty"`
+	Document    string              `json:"document"`
+
+	// Translated is the number of phrases translated so far, as progress of a running job
+	Translated int `json:"translated"`
+
+	// Attempts is the number of times the job was started
+	Attempts int `json:"attempts"`
+
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Process translates the document of a job, and returns the result. It calls progress for every phrase translated.
+type Process func(job Job, progress func()) (string, error)
+
+// Queue holds jobs and runs them with a pool of workers. It is safe for concurrent use.
+type Queue struct {
+	// Dir is the directory jobs are saved to, if set
+	Dir string
+
+	process Process
+	pending chan string
+
+	lock sync.Mutex
+	jobs map[string]*Job
+
+	// versions counts the changes of each job, so older versions are never written over newer ones
+	versions map[string]int
+
+	// files is held while writing jobs to the directory, which happens outside lock, so reading jobs never waits for
+	// the disk. written holds the version of each job last written.
+	files   sync.Mutex
+	written map[string]int
+}
+
+// saved is a version of a job, to be written to the directory
+type saved struct {
+	id      string
+	version int
+	content []byte
+}
+
+// Open returns a queue processing jobs with the given number of workers. If dir is set, jobs are saved there, and jobs
+// saved before are loaded. Those that had not finished are run again.
+func Open(dir string, workers int, process Process) (*Queue, error) {
+	q := &Queue{
+		Dir:      dir,
+		process:  process,
+		pending:  make(chan string, maxQueued),
+		jobs:     make(map[string]*Job),
+		versions: make(map[string]int),
+		written:  make(map[string]int),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	go q.expire()
+
+	return q, nil
+}
+
+// load reads the jobs saved in the directory, and queues those that had not finished
+func (q *Queue) load() error {
+	if q.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(q.Dir, 0755); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(q.Dir)
+	if err != nil {
+		return err
+	}
+
+	var unfinished []*Job
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(q.Dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		job := &Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			return errors.Wrapf(err, "failed to parse job %v", file.Name())
+		}
+		q.jobs[job.ID] = job
+
+		if job.State == Queued || job.State == Running {
+			unfinished = append(unfinished, job)
+		}
+	}
+
+	// Jobs are run again in the order they were submitted
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].Created.Before(unfinished[j].Created)
+	})
+	for _, job := range unfinished {
+		if job.Attempts >= maxAttempts {
+			q.write(q.finish(job, "", ErrCrashed))
+			continue
+		}
+
+		job.State, job.Translated = Queued, 0
+		if !q.enqueue(job) {
+			q.write(q.finish(job, "", ErrQueueFull))
+		}
+	}
+
+	return nil
+}
+
+// enqueue adds a job to the pending jobs. It returns false if too many are waiting.
+func (q *Queue) enqueue(job *Job) bool {
+	select {
+	case q.pending <- job.ID:
+		return true
+	default:
+		return false
+	}
+}
+
+// save returns the current version of a job, for write. The caller must hold the lock.
+func (q *Queue) save(job *Job) saved {
+	job.Updated = time.Now().UTC()
+	q.versions[job.ID]++
+
+	version := saved{id: job.ID, version: q.versions[job.ID]}
+	if q.Dir == "" {
+		return version
+	}
+
+	content, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("failed to save job %v: %v", job.ID, err)
+		return version
+	}
+	version.content = content
+
+	return version
+}
+
+// write writes a version of a job to the directory, unless a newer one was written already. The caller must not
+// hold the lock.
+func (q *Queue) write(version saved) {
+	if version.content == nil {
+		return
+	}
+
+	q.files.Lock()
+	defer q.files.Unlock()
+
+	if q.written[version.id] >= version.version {
+		return
+	}
+
+	// Jobs are written to a temporary file first, so a crash cannot leave a job half written
+	path := filepath.Join(q.Dir, version.id+".json")
+	err := ioutil.WriteFile(path+".tmp", version.content, 0644)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Printf("failed to save job %v: %v", version.id, err)
+		return
+	}
+
+	q.written[version.id] = version.version
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Submit adds a job to the queue, and returns it with its ID and state.
+func (q *Queue) Submit(job Job) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job.ID, job.State, job.Translated, job.Attempts = id, Queued, 0, 0
+	job.Result, job.Error = "", ""
+	job.Created = time.Now().UTC()
+
+	q.lock.Lock()
+
+	// Other submissions wait for the lock, so the job is sure to fit once there is room for it
+	if len(q.pending) == cap(q.pending) {
+		q.lock.Unlock()
+		return Job{}, ErrQueueFull
+	}
+
+	q.jobs[id] = &job
+	version := q.save(&job)
+	submitted := job
+	q.enqueue(&job)
+	q.lock.Unlock()
+
+	q.write(version)
+	return submitted, nil
+}
+
+// Get returns a job by its ID.
+func (q *Queue) Get(id string) (Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// expire removes expired jobs periodically
+func (q *Queue) expire() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		q.removeExpired()
+	}
+}
+
+// removeExpired removes jobs that finished longer ago than the retention period
+func (q *Queue) removeExpired() {
+	var expired []string
+
+	q.lock.Lock()
+	for id, job := range q.jobs {
+		if (job.State == Done || job.State == Failed) && time.Since(job.Updated) > Retention {
+			delete(q.jobs, id)
+			delete(q.versions, id)
+			expired = append(expired, id)
+		}
+	}
+	q.lock.Unlock()
+
+	if q.Dir == "" {
+		return
+	}
+
+	q.files.Lock()
+	defer q.files.Unlock()
+
+	for _, id := range expired {
+		delete(q.written, id)
+		os.Remove(filepath.Join(q.Dir, id+".json"))
+	}
+}
+
+// work runs pending jobs, one at a time
+func (q *Queue) work() {
+	for id := range q.pending {
+		q.lock.Lock()
+		job, ok := q.jobs[id]
+		if !ok || job.State != Queued {
+			q.lock.Unlock()
+			continue
+		}
+		job.State = Running
+		job.Attempts++
+		version := q.save(job)
+		running := *job
+		q.lock.Unlock()
+		q.write(version)
+
+		progress := func() {
+			q.lock.Lock()
+			job.Translated++
+			q.lock.Unlock()
+		}
+
+		result, err := q.run(running, progress)
+
+		q.lock.Lock()
+		version = q.finish(job, result, err)
+		q.lock.Unlock()
+		q.write(version)
+	}
+}
+
+// run processes a job. Panics fail the job rather than the server.
+func (q *Queue) run(job Job, progress func()) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %v panicked: %v\n%s", job.ID, r, debug.Stack())
+			result, err = "", ErrCrashed
+		}
+	}()
+
+	return q.process(job, progress)
+}
+
+// finish records the result of a job, and returns its version for write. The caller must hold the lock.
+func (q *Queue) finish(job *Job, result string, err error) saved {
+	if err != nil {
+		job.State, job.Error = Failed, err.Error()
+	} else {
+		job.State, job.Result = Done, result
+	}
+	return q.save(job)
+}
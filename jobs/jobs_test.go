@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"errors"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upper translates a job by upper-casing it, a word at a time
+func upper(job Job, progress func()) (string, error) {
+	if job.Document == "fail" {
+		return "", errors.New("failed")
+	}
+
+	for range strings.Fields(job.Document) {
+		progress()
+	}
+	return strings.ToUpper(job.Document), nil
+}
+
+// wait returns a job once it has finished
+func wait(t *testing.T, q *Queue, id string) Job {
+	for i := 0; i < 100; i++ {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get returned error when it shouldn't have: %v", err)
+		}
+		if job.State == Done || job.State == Failed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("job %v should have finished", id)
+	return Job{}
+}
+
+func TestQueue(t *testing.T) {
+	q, err := Open("", 2, upper)
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+
+	job, err := q.Submit(Job{SourceLang: language.English, TargetLang: language.German, Document: "hello big world"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+	if job.ID == "" || job.State != Queued {
+		t.Errorf("Submit should return the queued job with an ID: got %#v", job)
+	}
+
+	job = wait(t, q, job.ID)
+	if job.State != Done || job.Result != "HELLO BIG WORLD" || job.Translated != 3 {
+		t.Errorf("jobs should be translated, counting progress: got %#v", job)
+	}
+
+	failed, err := q.Submit(Job{Document: "fail"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+	failed = wait(t, q, failed.ID)
+	if failed.State != Failed || failed.Error != "failed" {
+		t.Errorf("jobs should fail with the error of translating them: got %#v", failed)
+	}
+
+	if _, err := q.Get("missing"); err != ErrNotFound {
+		t.Errorf("Get should fail for unknown jobs: got %v", err)
+	}
+}
+
+func TestQueue_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A queue without workers keeps its jobs queued, as if the server stopped before running them
+	q, err := Open(dir, 0, upper)
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+	job, err := q.Submit(Job{Document: "hello"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+
+	q, err = Open(dir, 1, upper)
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+
+	job = wait(t, q, job.ID)
+	if job.State != Done || job.Result != "HELLO" {
+		t.Errorf("unfinished jobs should run again after opening the queue: got %#v", job)
+	}
+
+	// The finished job is saved, and not run again
+	q, err = Open(dir, 1, func(job Job, progress func()) (string, error) {
+		t.Error("finished jobs should not run again")
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+	if saved, err := q.Get(job.ID); err != nil || saved.Result != "HELLO" {
+		t.Errorf("finished jobs should be loaded: got %#v, %v", saved, err)
+	}
+}
+
+func TestQueue_Expire(t *testing.T) {
+	q, err := Open("", 1, upper)
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+
+	job, err := q.Submit(Job{Document: "hello"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+	wait(t, q, job.ID)
+
+	q.lock.Lock()
+	q.jobs[job.ID].Updated = time.Now().Add(-Retention - time.Minute)
+	q.lock.Unlock()
+
+	q.removeExpired()
+	if _, err := q.Get(job.ID); err != ErrNotFound {
+		t.Errorf("jobs finished before the retention period should be removed: got %v", err)
+	}
+}
+
+func TestQueue_Panic(t *testing.T) {
+	q, err := Open("", 1, func(job Job, progress func()) (string, error) {
+		var forms []string
+		return forms[len(job.Document)], nil
+	})
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+
+	job, err := q.Submit(Job{Document: "hello"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+
+	job = wait(t, q, job.ID)
+	if job.State != Failed || job.Error != ErrCrashed.Error() || job.Attempts != 1 {
+		t.Errorf("jobs that panic should fail: got %#v", job)
+	}
+}
+
+func TestQueue_Crashed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 0, upper)
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+	job, err := q.Submit(Job{Document: "hello"})
+	if err != nil {
+		t.Fatalf("Submit returned error when it shouldn't have: %v", err)
+	}
+
+	// The job was running each time the server stopped
+	q.lock.Lock()
+	running := q.jobs[job.ID]
+	running.State, running.Attempts = Running, maxAttempts
+	version := q.save(running)
+	q.lock.Unlock()
+	q.write(version)
+
+	q, err = Open(dir, 1, func(job Job, progress func()) (string, error) {
+		t.Error("jobs should not be started more than maxAttempts times")
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("Open returned error when it shouldn't have: %v", err)
+	}
+
+	if job, err = q.Get(job.ID); err != nil || job.State != Failed || job.Error != ErrCrashed.Error() {
+		t.Errorf("jobs running at too many crashes should fail: got %#v, %v", job, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kuboschek/translate-server/jobs"
+	"github.com/kuboschek/translate-server/upstream"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestJobsAPI checks that documents can be translated in the background, and their state polled
+func TestJobsAPI(t *testing.T) {
+	translator := TranslateHandler{Services: []upstream.Service{htmlService{}}}
+	queue, err := jobs.Open("", 1, translator.runJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := JobsHandler{Queue: queue, Prefix: "/v1/jobs"}
+
+	serve := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Accept-Language", "de")
+		req.Header.Set("Content-Language", "en")
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "/v1/jobs", "text/x-apple-strings", "\"hello\" = \"Hello\";\n\"world\" = \"World\";\n")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected Accepted status: got %v %v", rr.Code, rr.Body.String())
+	}
+
+	var status jobStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Location") != "/v1/jobs/"+status.ID {
+		t.Errorf("responses should carry the location of the job: got %q", rr.Header().Get("Location"))
+	}
+
+	for i := 0; i < 100 && status.State != "done" && status.State != "failed"; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		rr = serve(http.MethodGet, "/v1/jobs/"+status.ID, "", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected the state of the job: got %v %v", rr.Code, rr.Body.String())
+		}
+		status = jobStatus{}
+		json.NewDecoder(rr.Body).Decode(&status)
+	}
+
+	want := "\"hello\" = \"HELLO\";\n\"world\" = \"WORLD\";\n"
+	if status.State != "done" || status.Result != want || status.Translated != 2 {
+		t.Errorf("jobs should translate documents, counting progress: got %#v", status)
+	}
+
+	rr = serve(http.MethodGet, "/v1/jobs/"+status.ID+"/result", "", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != want || rr.Header().Get("Content-Type") != "text/x-apple-strings" {
+		t.Errorf("expected the translated document: got %v %q", rr.Code, rr.Body.String())
+	}
+
+	rr = serve(http.MethodPost, "/v1/jobs", "multipart/form-data; boundary=x", "")
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("bundle updates should be rejected: got %v", rr.Code)
+	}
+
+	rr = serve(http.MethodGet, "/v1/jobs/missing", "", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown jobs should not be found: got %v", rr.Code)
+	}
+}
@@ -9,18 +9,30 @@ import (
 	"github.com/auth0/go-jwt-middleware"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/kuboschek/translate-server/cache"
+	"github.com/kuboschek/translate-server/glossary"
+	"github.com/kuboschek/translate-server/jobs"
 	"github.com/kuboschek/translate-server/upstream"
 	"github.com/rubyist/circuitbreaker"
+	"golang.org/x/text/language"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	translateHandler TranslateHandler
-	tokenKey         string
+	translateHandler  TranslateHandler
+	translationMemory *upstream.TranslationMemory
+	memoryFile        string
+	termGlossary      *glossary.Glossary
+	tokenKey          string
+
+	// jobsDir is where background jobs are saved, and jobWorkers how many run at the same time
+	jobsDir    = "data/jobs"
+	jobWorkers = 2
 )
 
 // init adds translation handlers based on the environment variables present
@@ -29,13 +41,41 @@ func init() {
 		Cache: cache.Memory,
 	}
 
+	// Record the HTTP requests of backends, or serve them from a recording instead of calling the real APIs, e.g. for
+	// integration tests without access to real upstreams. Backends are configured as usual, with any keys.
+	var client *http.Client
+	if recordFile := os.Getenv("RECORD_FIXTURES"); recordFile != "" {
+		client = &http.Client{Transport: &upstream.Recorder{Path: recordFile}}
+	}
+	if replayFile := os.Getenv("REPLAY_FIXTURES"); replayFile != "" {
+		client = &http.Client{Transport: &upstream.Replay{Path: replayFile}}
+	}
+
 	// Enable the Google backend if a key is given
 	googleKey := os.Getenv("GOOGLE_API_KEY")
 	if googleKey != "" {
 		cb := upstream.CircuitBreaker{
 			Breaker: circuit.NewRateBreaker(0.95, 100),
 			Handler: upstream.Google{
-				Key: googleKey,
+				Key:    googleKey,
+				Client: client,
+			},
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Enable the Google Cloud Translation v3 backend if a project is given.
+	// Credentials are read from GOOGLE_APPLICATION_CREDENTIALS or the environment.
+	googleProject := os.Getenv("GOOGLE_PROJECT_ID")
+	if googleProject != "" {
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 100),
+			Handler: &upstream.GoogleAdvanced{
+				ProjectID: googleProject,
+				Location:  os.Getenv("GOOGLE_LOCATION"),
+				Model:     os.Getenv("GOOGLE_MODEL"),
+				Glossary:  os.Getenv("GOOGLE_GLOSSARY"),
 			},
 		}
 
@@ -49,6 +89,107 @@ func init() {
 			Breaker: circuit.NewRateBreaker(0.95, 100),
 			Handler: upstream.Azure{
 				ServiceKey: bingKey,
+				Region:     os.Getenv("BING_REGION"),
+				Client:     client,
+			},
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Enable a self-hosted LibreTranslate backend if its address is given
+	libreURL := os.Getenv("LIBRETRANSLATE_URL")
+	if libreURL != "" {
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 100),
+			Handler: upstream.LibreTranslate{
+				BaseURL: libreURL,
+				APIKey:  os.Getenv("LIBRETRANSLATE_API_KEY"),
+				Client:  client,
+			},
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Enable the Amazon Translate backend if AWS credentials and a region are given
+	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	awsRegion := os.Getenv("AWS_REGION")
+	if awsKeyID != "" && awsRegion != "" {
+		amazon := upstream.Amazon{
+			Region: awsRegion,
+			Credentials: upstream.AWSCredentials{
+				AccessKeyID:     awsKeyID,
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			Endpoint: os.Getenv("AMAZON_TRANSLATE_ENDPOINT"),
+			Client:   client,
+		}
+
+		terminologies := os.Getenv("AMAZON_TRANSLATE_TERMINOLOGIES")
+		if terminologies != "" {
+			amazon.TerminologyNames = strings.Split(terminologies, ",")
+		}
+
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 100),
+			Handler: amazon,
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Enable an LLM backend if an OpenAI-compatible endpoint and model are given
+	llmURL := os.Getenv("LLM_BASE_URL")
+	llmModel := os.Getenv("LLM_MODEL")
+	if llmURL != "" && llmModel != "" {
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 100),
+			Handler: upstream.LLM{
+				BaseURL: llmURL,
+				APIKey:  os.Getenv("LLM_API_KEY"),
+				Model:   llmModel,
+				Style:   os.Getenv("LLM_STYLE"),
+				Client:  client,
+			},
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Enable declaratively configured HTTP backends, if a configuration file is given
+	templatesFile := os.Getenv("HTTP_TEMPLATES")
+	if templatesFile != "" {
+		templates, err := upstream.LoadHTTPTemplates(templatesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, tmpl := range templates {
+			tmpl.Client = client
+			cb := upstream.CircuitBreaker{
+				Breaker: circuit.NewRateBreaker(0.95, 100),
+				Handler: tmpl,
+			}
+
+			translateHandler.Services = append(translateHandler.Services, &cb)
+		}
+	}
+
+	// Enable external plugin backends, one per command line
+	plugins := os.Getenv("PLUGINS")
+	for _, command := range strings.Split(plugins, ";") {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 100),
+			Handler: &upstream.Plugin{
+				Command: fields[0],
+				Args:    fields[1:],
 			},
 		}
 
@@ -68,24 +209,187 @@ func init() {
 		translateHandler.Services = append(translateHandler.Services, &cb)
 	}
 
+	// Enables a programmable mock backend, for resilience testing
+	mockFaults := os.Getenv("MOCK_FAULTS")
+	if mockFaults != "" {
+		faults, err := upstream.ParseFaults(mockFaults)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cb := upstream.CircuitBreaker{
+			Breaker: circuit.NewRateBreaker(0.95, 10),
+			Handler: faults,
+		}
+
+		translateHandler.Services = append(translateHandler.Services, &cb)
+	}
+
+	// Translate through an intermediate language where a service fails to translate a pair directly
+	pivotLanguage := os.Getenv("PIVOT_LANGUAGE")
+	if pivotLanguage != "" {
+		via, err := language.Parse(pivotLanguage)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for i, svc := range translateHandler.Services {
+			translateHandler.Services[i] = upstream.Pivot{
+				Direct:  svc,
+				Handler: svc,
+				Via:     via,
+			}
+		}
+	}
+
+	// Enforce company-specific terminology, managed through the glossary API
+	glossaryFile := os.Getenv("GLOSSARY")
+	if glossaryFile != "" {
+		g, err := glossary.Open(glossaryFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Cached translations may use terms that changed
+		if purger, ok := translateHandler.Cache.(cache.Purger); ok {
+			g.OnChange = func(term glossary.Term) {
+				if err := purger.Purge(term.TargetLang); err != nil {
+					log.Printf("failed to purge cache after glossary change: %v", err)
+				}
+			}
+		}
+
+		termGlossary = g
+		for i, svc := range translateHandler.Services {
+			translateHandler.Services[i] = upstream.Terminology{
+				Handler:  svc,
+				Glossary: g,
+			}
+		}
+	}
+
+	// Keep tokens like URLs, usernames or brand names unchanged. This wraps the glossary, so terms are not
+	// replaced inside protected tokens.
+	protection, err := upstream.ParseProtection(os.Getenv("PROTECT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	protectFile := os.Getenv("PROTECT_PATTERNS")
+	if protectFile != "" {
+		patterns, err := upstream.LoadProtectedPatterns(protectFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		protection = append(protection, patterns...)
+	}
+
+	var protectedTerms []string
+	for _, term := range strings.Split(os.Getenv("PROTECT_TERMS"), ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			protectedTerms = append(protectedTerms, term)
+		}
+	}
+
+	if len(protection) > 0 || len(protectedTerms) > 0 {
+		for i, svc := range translateHandler.Services {
+			translateHandler.Services[i] = upstream.Protect{
+				Handler:  svc,
+				Patterns: protection,
+				Terms:    protectedTerms,
+			}
+		}
+	}
+
+	// Enables pseudo-translations, e.g. for testing user interfaces in staging
+	enablePseudo := os.Getenv("ENABLE_PSEUDO")
+	if enablePseudo != "" {
+		translateHandler.Services = append(translateHandler.Services, upstream.Pseudo{})
+	}
+
+	// Serve stored human translations before asking any other backend
+	memoryFile = os.Getenv("TRANSLATION_MEMORY")
+	if memoryFile != "" {
+		memory := &upstream.TranslationMemory{}
+
+		threshold := os.Getenv("TRANSLATION_MEMORY_THRESHOLD")
+		if threshold != "" {
+			value, err := strconv.ParseFloat(threshold, 64)
+			if err != nil {
+				log.Fatal(err)
+			}
+			memory.Threshold = value
+		}
+
+		if err := memory.Load(memoryFile); err != nil {
+			log.Fatal(err)
+		}
+
+		translationMemory = memory
+		translateHandler.Memory = memory
+	}
+
+	// Save background jobs, so they survive restarts
+	if dir := os.Getenv("JOBS_DIR"); dir != "" {
+		jobsDir = dir
+	}
+
+	workers := os.Getenv("JOBS_WORKERS")
+	if workers != "" {
+		value, err := strconv.Atoi(workers)
+		if err != nil || value < 1 {
+			log.Fatalf("invalid JOBS_WORKERS %q", workers)
+		}
+		jobWorkers = value
+	}
+
 	// This is the secret key used to sign JSON Web Tokens
 	tokenKey = os.Getenv("SECRET_KEY")
 	if tokenKey == "" {
 		// TODO Replace by generated character string
 		tokenKey = "uihesrioesjrjoiseros"
 	}
+}
+
+func main() {
+	// Subcommands run once and exit, instead of starting the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	// If nothing is enabled, all requests would immediately fail
 	// Shutting down immediately makes the configuration error more
 	// observable
-	if len(translateHandler.Services) == 0 {
+	if len(translateHandler.Services) == 0 && translateHandler.Memory == nil {
 		err := errors.New("no translation backends active, exiting")
 		log.Fatal(err)
 	}
-}
 
-func main() {
 	http.Handle("/", translateHandler)
+	http.Handle("/admin/tmx", AdminOnly{TMXHandler{
+		Cache:      translateHandler.Cache,
+		Memory:     translationMemory,
+		MemoryPath: memoryFile,
+	}})
+
+	if termGlossary != nil {
+		glossaryHandler := AdminOnly{GlossaryHandler{Glossary: termGlossary, Prefix: "/admin/glossary"}}
+		http.Handle("/admin/glossary", glossaryHandler)
+		http.Handle("/admin/glossary/", glossaryHandler)
+	}
+
+	// Documents that take longer to translate than a request may are translated in the background
+	queue, err := jobs.Open(jobsDir, jobWorkers, translateHandler.runJob)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jobsHandler := JobsHandler{Queue: queue, Prefix: "/v1/jobs"}
+	http.Handle("/v1/jobs", jobsHandler)
+	http.Handle("/v1/jobs/", jobsHandler)
 
 	// This adds simple authentication to the service.
 	// Any bearer of a valid token may translate as much as they desire.
@@ -123,7 +427,7 @@ func main() {
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
 	defer cancel()
-	err := srv.Shutdown(ctx)
+	err = srv.Shutdown(ctx)
 
 	if err != nil {
 		log.Printf("error shutting down: %v", err)
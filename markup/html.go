@@ -0,0 +1,332 @@
+// Package markup translates the text of HTML and Markdown documents, keeping their markup intact.
+package markup
+
+import (
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/net/html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// inlineElements are part of the sentence around them, so they are translated together with it
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "br": true, "cite": true, "code": true,
+	"data": true, "del": true, "dfn": true, "em": true, "font": true, "i": true, "img": true, "ins": true,
+	"kbd": true, "label": true, "mark": true, "q": true, "s": true, "samp": true, "small": true, "span": true,
+	"strong": true, "sub": true, "sup": true, "time": true, "u": true, "var": true, "wbr": true,
+}
+
+// untranslatedElements contain code or data rather than prose
+var untranslatedElements = map[string]bool{
+	"code": true, "kbd": true, "samp": true, "var": true, "script": true, "style": true, "pre": true,
+	"textarea": true, "template": true, "svg": true, "math": true,
+}
+
+// voidElements have no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// translatedAttributes hold prose shown to users
+var translatedAttributes = map[string]bool{
+	"alt": true, "title": true, "placeholder": true, "aria-label": true, "label": true,
+}
+
+// segment is a run of text and inline markup, translated as one sentence
+type segment struct {
+	pieces []placeholder.Piece
+
+	// raw holds the pieces as they were written, to keep text that needs no translation unchanged
+	raw []string
+}
+
+// htmlTranslator holds the state of translating one document
+type htmlTranslator struct {
+	tokenizer *html.Tokenizer
+	translate func(string) (string, error)
+	output    strings.Builder
+	current   segment
+}
+
+// untranslated returns true if the content of an element must be kept as it is
+func untranslated(token html.Token) bool {
+	if untranslatedElements[token.Data] {
+		return true
+	}
+
+	for _, attribute := range token.Attr {
+		switch {
+		case attribute.Key == "translate" && attribute.Val == "no":
+			return true
+		case attribute.Key == "class" && strings.Contains(" "+attribute.Val+" ", " notranslate "):
+			return true
+		}
+	}
+
+	return false
+}
+
+// textEscaper escapes translated text for HTML. Quotes need no escaping outside attributes, and non-breaking spaces
+// are written as entities, as they usually were.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;")
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// characterReference matches entities like &copy; or &#169;
+var characterReference = regexp.MustCompile(`&(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+
+// letters returns true if text consists of letters and the marks combined with them
+func letters(text string) bool {
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// addText adds raw text to the segment. Entities for letters are part of the words around them, and those written
+// back by escapeText are kept in the text. All others, like &copy; or &#8212;, are opaque, so they are written as
+// they were.
+func (s *segment) addText(raw string) {
+	offset := 0
+	for _, location := range characterReference.FindAllStringIndex(raw, -1) {
+		reference := raw[location[0]:location[1]]
+		decoded := html.UnescapeString(reference)
+		if letters(decoded) || escapeText(decoded) == reference {
+			continue
+		}
+
+		if location[0] > offset {
+			s.add(placeholder.Piece{Text: html.UnescapeString(raw[offset:location[0]])}, raw[offset:location[0]])
+		}
+		s.add(placeholder.Piece{Text: reference, Opaque: true}, reference)
+		offset = location[1]
+	}
+
+	if offset < len(raw) {
+		s.add(placeholder.Piece{Text: html.UnescapeString(raw[offset:])}, raw[offset:])
+	}
+}
+
+// TranslateHTML translates the text of an HTML document or fragment, and its user-visible attributes.
+// Text is translated a block at a time, with inline elements replaced by placeholders, so sentences keep their
+// context. Scripts, styles, code and elements marked translate="no" are kept as they are.
+func TranslateHTML(document string, translate func(string) (string, error)) (string, error) {
+	t := &htmlTranslator{
+		tokenizer: html.NewTokenizer(strings.NewReader(document)),
+		translate: translate,
+	}
+
+	for {
+		tokenType := t.tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if t.tokenizer.Err() != io.EOF {
+				return "", t.tokenizer.Err()
+			}
+			break
+		}
+
+		raw := string(t.tokenizer.Raw())
+		token := t.tokenizer.Token()
+
+		switch tokenType {
+		case html.TextToken:
+			t.current.addText(raw)
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// Attributes of elements kept as they are are not translated either
+			tag := raw
+			if !untranslated(token) {
+				var err error
+				if tag, err = t.translateAttributes(raw, token); err != nil {
+					return "", err
+				}
+			}
+
+			enclosing := tokenType == html.StartTagToken && !voidElements[token.Data]
+			if enclosing && untranslated(token) {
+				tag += t.skipElement(token.Data)
+			}
+
+			if inlineElements[token.Data] {
+				if enclosing && !untranslated(token) {
+					t.addTag(tag, 1)
+				} else {
+					t.current.add(placeholder.Piece{Text: tag, Opaque: true}, tag)
+				}
+				continue
+			}
+
+			if err := t.flush(); err != nil {
+				return "", err
+			}
+			t.output.WriteString(tag)
+
+		case html.EndTagToken:
+			if inlineElements[token.Data] {
+				t.addTag(raw, -1)
+				continue
+			}
+
+			if err := t.flush(); err != nil {
+				return "", err
+			}
+			t.output.WriteString(raw)
+
+		default:
+			// Comments and doctypes end sentences
+			if err := t.flush(); err != nil {
+				return "", err
+			}
+			t.output.WriteString(raw)
+		}
+	}
+
+	if err := t.flush(); err != nil {
+		return "", err
+	}
+
+	return t.output.String(), nil
+}
+
+// add appends a piece to the segment
+func (s *segment) add(piece placeholder.Piece, raw string) {
+	s.pieces = append(s.pieces, piece)
+	s.raw = append(s.raw, raw)
+}
+
+// words returns true if the segment has any text to translate
+func (s segment) words() bool {
+	for _, piece := range s.pieces {
+		if !piece.Opaque && strings.IndexFunc(piece.Text, unicode.IsLetter) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// addTag adds the start (1) or end (-1) of an inline element to the current segment
+func (t *htmlTranslator) addTag(raw string, edge int) {
+	t.current.add(placeholder.Piece{Text: raw, Opaque: true, Edge: edge}, raw)
+}
+
+// skipElement returns the raw content of an element up to and including its end tag
+func (t *htmlTranslator) skipElement(name string) string {
+	var content strings.Builder
+
+	depth := 1
+	for depth > 0 {
+		tokenType := t.tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		content.Write(t.tokenizer.Raw())
+		tagName, _ := t.tokenizer.TagName()
+		if string(tagName) != name {
+			continue
+		}
+
+		switch tokenType {
+		case html.StartTagToken:
+			depth++
+		case html.EndTagToken:
+			depth--
+		}
+	}
+
+	return content.String()
+}
+
+// translateAttributes returns a tag with its user-visible attributes translated
+func (t *htmlTranslator) translateAttributes(raw string, token html.Token) (string, error) {
+	changed := false
+
+	for i, attribute := range token.Attr {
+		if !translatedAttributes[attribute.Key] || strings.TrimSpace(attribute.Val) == "" {
+			continue
+		}
+
+		translated, err := t.translate(attribute.Val)
+		if err != nil {
+			return "", err
+		}
+
+		token.Attr[i].Val = translated
+		changed = true
+	}
+
+	if !changed {
+		return raw, nil
+	}
+
+	return token.String(), nil
+}
+
+// flush translates the current segment, and writes it to the output
+func (t *htmlTranslator) flush() error {
+	current := t.current
+	t.current = segment{}
+
+	if !current.words() {
+		t.output.WriteString(strings.Join(current.raw, ""))
+		return nil
+	}
+
+	translated, err := placeholder.TranslatePaired(current.pieces, t.translate)
+	if err != nil {
+		return err
+	}
+
+	for _, piece := range translated {
+		if piece.Opaque {
+			t.output.WriteString(piece.Text)
+		} else {
+			t.output.WriteString(escapeText(piece.Text))
+		}
+	}
+
+	return nil
+}
+
+// structure returns the sequence of elements in a document, e.g. "<p", "<b", "</b", "</p"
+func structure(document string) []string {
+	var elements []string
+
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return elements
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			elements = append(elements, "<"+string(name))
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			elements = append(elements, "</"+string(name))
+		}
+	}
+}
+
+// SameStructure returns true if two documents have the same elements in the same order, e.g. to check that a
+// translation did not break the markup.
+func SameStructure(a, b string) bool {
+	structureA, structureB := structure(a), structure(b)
+	if len(structureA) != len(structureB) {
+		return false
+	}
+
+	for i := range structureA {
+		if structureA[i] != structureB[i] {
+			return false
+		}
+	}
+
+	return true
+}
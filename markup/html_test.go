@@ -0,0 +1,93 @@
+package markup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func TestTranslateHTML(t *testing.T) {
+	cases := []struct {
+		document, want string
+	}{
+		{"<p>Hello <b>world</b>!</p>", "<p>HELLO <b>WORLD</b>!</p>"},
+		{`<a href="/home" title="Go home">home</a>`, `<a href="/home" title="GO HOME">HOME</a>`},
+		{`<img src="cat.png" alt="A cat">`, `<img src="cat.png" alt="A CAT">`},
+		{"<p>Run <code>ls -la</code> now</p>", "<p>RUN <code>ls -la</code> NOW</p>"},
+		{"<pre>keep this</pre><p>but not this</p>", "<pre>keep this</pre><p>BUT NOT THIS</p>"},
+		{`<span translate="no">Acme</span> rocks`, `<span translate="no">Acme</span> ROCKS`},
+		{`<div class="box notranslate">Acme</div>`, `<div class="box notranslate">Acme</div>`},
+		{"<script>var a = 'b';</script>", "<script>var a = 'b';</script>"},
+		{"<p>Fish &amp; chips&nbsp;</p>", "<p>FISH &amp; CHIPS&nbsp;</p>"},
+		{"<!-- note --><p>12 &gt; 3</p>", "<!-- note --><p>12 &gt; 3</p>"},
+		{"<p>&copy; Acme &eacute;t&eacute;&#8212;ok</p>", "<p>&copy; ACME ÉTÉ&#8212;OK</p>"},
+		{`<span translate="no" title="Acme Corp">Acme</span>`, `<span translate="no" title="Acme Corp">Acme</span>`},
+		{`<img class="notranslate" alt="Acme logo">`, `<img class="notranslate" alt="Acme logo">`},
+		{"<ul>\n  <li>One</li>\n  <li>Two</li>\n</ul>", "<ul>\n  <li>ONE</li>\n  <li>TWO</li>\n</ul>"},
+	}
+
+	for _, c := range cases {
+		got, err := TranslateHTML(c.document, upper)
+		if err != nil {
+			t.Errorf("TranslateHTML should translate %q: %v", c.document, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("TranslateHTML translated %q incorrectly: got %q want %q", c.document, got, c.want)
+		}
+	}
+}
+
+// TestTranslateHTMLReordered checks that translations may move inline elements, but not break their nesting
+func TestTranslateHTMLReordered(t *testing.T) {
+	swap := func(phrase string) (string, error) {
+		if phrase == "the ⟦0⟧red⟦1⟧ car" {
+			return "l'auto ⟦0⟧rossa⟦1⟧", nil
+		}
+		if phrase == "the ⟦1⟧red⟦0⟧ car" {
+			return "", errors.New("unexpected phrase")
+		}
+		// Broken translations close the element before opening it
+		return strings.Replace(phrase, "⟦0⟧x⟦1⟧", "⟦1⟧x⟦0⟧", -1), nil
+	}
+
+	got, err := TranslateHTML("<p>the <b>red</b> car</p>", swap)
+	if err != nil || got != "<p>l'auto <b>rossa</b></p>" {
+		t.Errorf("TranslateHTML should keep moved inline elements: got %q, %v", got, err)
+	}
+
+	got, err = TranslateHTML("<p><i>x</i></p>", swap)
+	if err != nil || got != "<p><i>x</i></p>" {
+		t.Errorf("TranslateHTML should translate texts separately when nesting breaks: got %q, %v", got, err)
+	}
+}
+
+func TestTranslateHTMLError(t *testing.T) {
+	failing := func(string) (string, error) {
+		return "", errors.New("unavailable")
+	}
+
+	if _, err := TranslateHTML("<p>Hello</p>", failing); err == nil {
+		t.Error("TranslateHTML should return translation errors")
+	}
+}
+
+func TestSameStructure(t *testing.T) {
+	if !SameStructure("<p>Hello <b>world</b></p>", "<p><b>Welt</b>, hallo</p>") {
+		t.Error("SameStructure should ignore text")
+	}
+
+	if SameStructure("<p>Hello <b>world</b></p>", "<p>Hallo <i>Welt</i></p>") {
+		t.Error("SameStructure should detect changed elements")
+	}
+
+	if SameStructure("<p>Hello <b>world</b></p>", "<p>Hallo Welt</p>") {
+		t.Error("SameStructure should detect lost elements")
+	}
+}
@@ -0,0 +1,689 @@
+package markup
+
+import (
+	"github.com/kuboschek/translate-server/placeholder"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// containerMarker matches a block quote or list item marker at the start of a line
+	containerMarker = regexp.MustCompile(`^ {0,3}(?:>[ \t]?|(?:[-+*]|\d{1,9}[.)])(?:[ \t]+|$))`)
+	taskMarker      = regexp.MustCompile(`^\[[ xX]\](?:[ \t]+|$)`)
+	fenceOpen       = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	atxHeading      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+|$)`)
+	headingClose    = regexp.MustCompile(`(?:^|[ \t]+)#+[ \t]*$`)
+	setextUnderline = regexp.MustCompile(`^ {0,3}(?:=+|-+)[ \t]*$`)
+	thematicBreak   = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	htmlBlock       = regexp.MustCompile(`^ {0,3}<[A-Za-z/!?]`)
+	referenceDef    = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:`)
+	tableDelimiter  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	blockStart      = regexp.MustCompile(`^(?:[-+*]|\d{1,9}[.)]|#{1,6}|>)(?:[ \t]|$)`)
+	bareURL         = regexp.MustCompile(`^(?:https?|ftp)://[^\s<>]*[^\s<>.,;:!?'")\]*_]`)
+	autolink        = regexp.MustCompile(`^<(?:[A-Za-z][A-Za-z0-9+.-]{1,31}:[^\s<>]*|[\w.+-]+@[\w-]+(?:\.[\w-]+)+)>`)
+	inlineTag       = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][\w.:-]*(?:\s*=\s*(?:[^\s"'=<>]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>|<!--[\s\S]*?-->)`)
+)
+
+// markdownSpecial are characters with a meaning in Markdown text. They are escaped where translations introduce them.
+const markdownSpecial = "\\`*_[]<"
+
+// paragraph is a run of prose lines, translated as one segment
+type paragraph struct {
+	segment
+
+	// prefix holds the container markers of the first line, continuation the indentation of the following lines
+	prefix, continuation string
+
+	// hardBreak is the line break at the end of the last line, if it is a hard break
+	hardBreak string
+}
+
+// markdownTranslator holds the state of translating one document
+type markdownTranslator struct {
+	translate  func(string) (string, error)
+	output     strings.Builder
+	references map[string]bool
+	current    *paragraph
+}
+
+// TranslateMarkdown translates the prose of a Markdown document: paragraphs, headings, list items, tables, link text
+// and image descriptions. Code, URLs, HTML tags and front matter are kept as they are, and so is the structure of
+// the document. Paragraphs are translated as a whole, so lines wrapped within a paragraph are joined.
+func TranslateMarkdown(document string, translate func(string) (string, error)) (string, error) {
+	crlf := strings.Contains(document, "\r\n")
+	lines := strings.Split(strings.Replace(document, "\r\n", "\n", -1), "\n")
+
+	t := &markdownTranslator{translate: translate, references: make(map[string]bool)}
+	for _, line := range lines {
+		if match := referenceDef.FindStringSubmatch(line); match != nil {
+			t.references[normalizeLabel(match[1])] = true
+		}
+	}
+
+	start := frontMatterEnd(lines)
+	for _, line := range lines[:start] {
+		t.output.WriteString(line + "\n")
+	}
+
+	if err := t.blocks(lines[start:]); err != nil {
+		return "", err
+	}
+
+	translated := strings.TrimSuffix(t.output.String(), "\n")
+	if crlf {
+		translated = strings.Replace(translated, "\n", "\r\n", -1)
+	}
+
+	return translated, nil
+}
+
+// frontMatterEnd returns the number of lines of YAML or TOML front matter at the start of a document
+func frontMatterEnd(lines []string) int {
+	if len(lines) == 0 || (lines[0] != "---" && lines[0] != "+++") {
+		return 0
+	}
+
+	for i, line := range lines[1:] {
+		if line == lines[0] || (lines[0] == "---" && line == "...") {
+			return i + 2
+		}
+	}
+
+	return 0
+}
+
+// normalizeLabel returns a link label as it is matched against references
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// containers splits a line into its block quote and list item markers, and the rest of the line.
+// It returns true if the line starts a list item.
+func containers(line string) (prefix, rest string, item bool) {
+	rest = line
+	for {
+		marker := containerMarker.FindString(rest)
+		if marker == "" {
+			break
+		}
+
+		// A line of three or more list markers is a thematic break, not a list
+		if thematicBreak.MatchString(rest) {
+			break
+		}
+
+		if !strings.Contains(marker, ">") {
+			item = true
+			if task := taskMarker.FindString(rest[len(marker):]); task != "" {
+				marker += task
+			}
+		}
+
+		prefix += marker
+		rest = rest[len(marker):]
+	}
+
+	return prefix, rest, item
+}
+
+// indentation returns the width of the whitespace at the start of a line
+func indentation(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// continuationOf returns the indentation of lines continuing a block with the given prefix
+func continuationOf(prefix string) string {
+	var continuation strings.Builder
+	for _, r := range prefix {
+		if r == '>' || r == ' ' || r == '\t' {
+			continuation.WriteRune(r)
+		} else {
+			continuation.WriteByte(' ')
+		}
+	}
+	return continuation.String()
+}
+
+// blocks translates the lines of a document after its front matter
+func (t *markdownTranslator) blocks(lines []string) error {
+	listIndent := 0
+	blank, indentedCode := true, false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		prefix, rest, item := containers(line)
+
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(rest) == "" && !item {
+			if err := t.flush(); err != nil {
+				return err
+			}
+			t.output.WriteString(line + "\n")
+			blank = true
+			continue
+		}
+
+		if item {
+			listIndent = len(prefix)
+		} else if t.current == nil && !strings.Contains(prefix, ">") && indentation(line) < listIndent {
+			listIndent = 0
+		}
+
+		codeIndent := indentation(rest)
+		if !item && !strings.Contains(prefix, ">") {
+			codeIndent = indentation(line) - listIndent
+		}
+
+		switch {
+		case t.current == nil && (blank || indentedCode) && codeIndent >= 4:
+			t.output.WriteString(line + "\n")
+			blank, indentedCode = false, true
+			continue
+
+		case fenceOpen.MatchString(rest):
+			if err := t.flush(); err != nil {
+				return err
+			}
+			i = t.fencedCode(lines, i, fenceOpen.FindStringSubmatch(rest)[1])
+
+		case t.current != nil && !item && setextUnderline.MatchString(rest):
+			if err := t.flush(); err != nil {
+				return err
+			}
+			t.output.WriteString(line + "\n")
+
+		case thematicBreak.MatchString(rest), t.current == nil && referenceDef.MatchString(rest):
+			if err := t.flush(); err != nil {
+				return err
+			}
+			t.output.WriteString(line + "\n")
+
+		case t.current == nil && prefix == "" && htmlBlock.MatchString(rest):
+			var err error
+			if i, err = t.htmlBlock(lines, i); err != nil {
+				return err
+			}
+
+		case t.current == nil && strings.Contains(rest, "|") && i+1 < len(lines) && tableDelimiter.MatchString(lines[i+1]):
+			var err error
+			if i, err = t.table(lines, i); err != nil {
+				return err
+			}
+
+		case atxHeading.MatchString(rest):
+			if err := t.flush(); err != nil {
+				return err
+			}
+			if err := t.heading(prefix, rest); err != nil {
+				return err
+			}
+
+		case t.current != nil && !item && (prefix == "" || strings.Contains(prefix, ">")):
+			t.continueParagraph(line, prefix, rest)
+
+		default:
+			if err := t.flush(); err != nil {
+				return err
+			}
+			t.startParagraph(prefix, rest)
+		}
+
+		blank, indentedCode = false, false
+	}
+
+	return t.flush()
+}
+
+// fencedCode copies a fenced code block, and returns the index of its last line
+func (t *markdownTranslator) fencedCode(lines []string, start int, fence string) int {
+	t.output.WriteString(lines[start] + "\n")
+
+	for i := start + 1; i < len(lines); i++ {
+		t.output.WriteString(lines[i] + "\n")
+
+		// Closing fences may be indented by the container markers of the block
+		closing := strings.TrimLeft(lines[i], " \t>")
+		if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]+" \t") == "" {
+			return i
+		}
+	}
+
+	return len(lines) - 1
+}
+
+// htmlBlock translates the lines of an HTML block up to the next blank line, and returns the index of its last line
+func (t *markdownTranslator) htmlBlock(lines []string, start int) (int, error) {
+	end := start
+	for end+1 < len(lines) && strings.TrimSpace(lines[end+1]) != "" {
+		end++
+	}
+
+	translated, err := TranslateHTML(strings.Join(lines[start:end+1], "\n"), t.translate)
+	if err != nil {
+		return 0, err
+	}
+
+	t.output.WriteString(translated + "\n")
+	return end, nil
+}
+
+// table translates the cells of a table, and returns the index of its last row
+func (t *markdownTranslator) table(lines []string, start int) (int, error) {
+	end := start
+	for i := start; i < len(lines); i++ {
+		if i > start+1 && (strings.TrimSpace(lines[i]) == "" || !strings.Contains(lines[i], "|")) {
+			break
+		}
+		end = i
+
+		if i == start+1 {
+			t.output.WriteString(lines[i] + "\n")
+			continue
+		}
+
+		for j, cell := range splitCells(lines[i]) {
+			if j%2 == 1 {
+				t.output.WriteString(cell)
+				continue
+			}
+
+			translated, err := t.inline(cell)
+			if err != nil {
+				return 0, err
+			}
+			t.output.WriteString(translated)
+		}
+		t.output.WriteString("\n")
+	}
+
+	return end, nil
+}
+
+// splitCells splits a table row into cells and the pipes between them, e.g. "a | b" into "a ", "|", " b".
+// Pipes in code spans or escaped with a backslash do not separate cells.
+func splitCells(row string) []string {
+	var parts []string
+
+	start, code := 0, false
+	for i := 0; i < len(row); i++ {
+		switch row[i] {
+		case '\\':
+			i++
+		case '`':
+			code = !code
+		case '|':
+			if !code {
+				parts = append(parts, row[start:i], "|")
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, row[start:])
+}
+
+// heading translates an ATX heading, keeping its level and closing sequence
+func (t *markdownTranslator) heading(prefix, rest string) error {
+	marker := atxHeading.FindString(rest)
+	content := rest[len(marker):]
+
+	closing := ""
+	if location := headingClose.FindStringIndex(content); location != nil {
+		content, closing = content[:location[0]], content[location[0]:]
+	}
+
+	translated, err := t.inline(content)
+	if err != nil {
+		return err
+	}
+
+	t.output.WriteString(prefix + marker + translated + closing + "\n")
+	return nil
+}
+
+// startParagraph starts a new paragraph with the first line
+func (t *markdownTranslator) startParagraph(prefix, rest string) {
+	indented := strings.TrimLeft(rest, " \t")
+	prefix, rest = prefix+rest[:len(rest)-len(indented)], indented
+
+	t.current = &paragraph{prefix: prefix, continuation: continuationOf(prefix)}
+	t.addLine(rest)
+}
+
+// continueParagraph adds a line to the current paragraph
+func (t *markdownTranslator) continueParagraph(line, prefix, rest string) {
+	if t.current.hardBreak != "" {
+		t.current.add(placeholder.Piece{Text: t.current.hardBreak + "\n" + t.current.continuation, Opaque: true}, "")
+	} else {
+		t.current.add(placeholder.Piece{Text: " "}, "")
+	}
+
+	if prefix == "" {
+		rest = strings.TrimLeft(line, " \t")
+	}
+	t.addLine(rest)
+}
+
+// addLine adds the inline content of a line to the current paragraph, keeping a hard break at its end
+func (t *markdownTranslator) addLine(content string) {
+	t.current.hardBreak = ""
+
+	trimmed := strings.TrimRight(content, " \t")
+	switch {
+	case strings.HasSuffix(content, "  ") && trimmed != "":
+		t.current.hardBreak = content[len(trimmed):]
+		content = trimmed
+	case strings.HasSuffix(content, "\\") && !strings.HasSuffix(content, "\\\\"):
+		t.current.hardBreak = "\\"
+		content = content[:len(content)-1]
+	default:
+		content = trimmed
+	}
+
+	t.inlinePieces(&t.current.segment, content)
+}
+
+// flush translates the current paragraph, and writes it to the output
+func (t *markdownTranslator) flush() error {
+	current := t.current
+	if current == nil {
+		return nil
+	}
+	t.current = nil
+
+	translated, err := t.translateSegment(current.segment)
+	if err != nil {
+		return err
+	}
+
+	t.output.WriteString(current.prefix + translated + current.hardBreak + "\n")
+	return nil
+}
+
+// inline translates a single line of inline content, like a heading or a table cell
+func (t *markdownTranslator) inline(content string) (string, error) {
+	var s segment
+	t.inlinePieces(&s, content)
+	return t.translateSegment(s)
+}
+
+// translateSegment translates inline content, and writes it back as Markdown
+func (t *markdownTranslator) translateSegment(s segment) (string, error) {
+	if !s.words() {
+		var raw strings.Builder
+		for _, piece := range s.pieces {
+			raw.WriteString(piece.Text)
+		}
+		return raw.String(), nil
+	}
+
+	var original strings.Builder
+	for _, piece := range s.pieces {
+		if !piece.Opaque {
+			original.WriteString(piece.Text)
+		}
+	}
+
+	translated, err := placeholder.TranslatePaired(s.pieces, t.translate)
+	if err != nil {
+		return "", err
+	}
+
+	var markdown strings.Builder
+	for i, piece := range translated {
+		if piece.Opaque {
+			markdown.WriteString(piece.Text)
+			continue
+		}
+
+		text := escapeMarkdown(piece.Text, original.String())
+		if i == 0 && blockStart.MatchString(text) {
+			text = escapeBlockStart(text)
+		}
+		markdown.WriteString(text)
+	}
+
+	return markdown.String(), nil
+}
+
+// escapeMarkdown escapes the characters with a meaning in Markdown that a translation introduced
+func escapeMarkdown(text, original string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(markdownSpecial, r) && !strings.ContainsRune(original, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// escapeBlockStart escapes the marker at the start of a translation that would start a new block, e.g. "1." or "#"
+func escapeBlockStart(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsDigit(r)
+	})
+	return text[:end] + "\\" + text[end:]
+}
+
+// inlinePieces splits inline content into text to translate and opaque markup
+func (t *markdownTranslator) inlinePieces(s *segment, content string) {
+	var text strings.Builder
+
+	opaque := func(markup string) {
+		if text.Len() > 0 {
+			s.add(placeholder.Piece{Text: text.String()}, "")
+			text.Reset()
+		}
+		s.add(placeholder.Piece{Text: markup, Opaque: true}, "")
+	}
+
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		r, size := utf8.DecodeRuneInString(rest)
+
+		switch {
+		case r == '\\' && len(rest) > 1 && strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(rest[1])):
+			opaque(rest[:2])
+			i += 2
+
+		case r == '`':
+			end := codeSpanEnd(rest)
+			if end < 0 {
+				run := len(rest) - len(strings.TrimLeft(rest, "`"))
+				text.WriteString(rest[:run])
+				i += run
+				continue
+			}
+			opaque(rest[:end])
+			i += end
+
+		case r == '[' || r == '!' && strings.HasPrefix(rest, "!["):
+			open := 1
+			if r == '!' {
+				open = 2
+			}
+
+			label, destination, ok := t.link(rest[open-1:])
+			if !ok {
+				text.WriteString(rest[:open])
+				i += open
+				continue
+			}
+
+			if text.Len() > 0 {
+				s.add(placeholder.Piece{Text: text.String()}, "")
+				text.Reset()
+			}
+			t.addEdge(s, rest[:open], 1)
+			t.inlinePieces(s, label)
+			t.addEdge(s, destination, -1)
+			i += open + len(label) + len(destination)
+
+		case r == '<' && (autolink.MatchString(rest) || inlineTag.MatchString(rest)):
+			markup := autolink.FindString(rest)
+			if markup == "" {
+				markup = inlineTag.FindString(rest)
+			}
+			opaque(markup)
+			i += len(markup)
+
+		case (r == 'h' || r == 'f') && bareURL.MatchString(rest) && wordStart(content, i):
+			url := bareURL.FindString(rest)
+			opaque(url)
+			i += len(url)
+
+		case r == '*' || r == '_' || r == '~':
+			run := len(rest) - len(strings.TrimLeft(rest, string(r)))
+			if delimiter(content, i, run) {
+				opaque(rest[:run])
+			} else {
+				text.WriteString(rest[:run])
+			}
+			i += run
+
+		default:
+			text.WriteString(rest[:size])
+			i += size
+		}
+	}
+
+	if text.Len() > 0 {
+		s.add(placeholder.Piece{Text: text.String()}, "")
+	}
+}
+
+// addEdge adds the start (1) or end (-1) of a link to a segment
+func (t *markdownTranslator) addEdge(s *segment, markup string, edge int) {
+	s.add(placeholder.Piece{Text: markup, Opaque: true, Edge: edge}, "")
+}
+
+// link parses a link starting at its opening bracket. It returns the link text, and the rest of the link from the
+// closing bracket, e.g. "](https://example.com)" or "][ref]".
+func (t *markdownTranslator) link(content string) (label, destination string, ok bool) {
+	end := matching(content, '[', ']')
+	if end < 0 {
+		return "", "", false
+	}
+	label = content[1:end]
+	after := content[end+1:]
+
+	switch {
+	case strings.HasPrefix(after, "("):
+		close := matching(after, '(', ')')
+		if close < 0 {
+			return "", "", false
+		}
+		return label, "]" + after[:close+1], true
+
+	case strings.HasPrefix(after, "["):
+		close := matching(after, '[', ']')
+		if close < 0 {
+			return "", "", false
+		}
+		reference := after[1:close]
+		if reference == "" {
+			reference = label
+		}
+		if !t.references[normalizeLabel(reference)] {
+			return "", "", false
+		}
+		return label, "]" + after[:close+1], true
+
+	case t.references[normalizeLabel(label)]:
+		return label, "]", true
+	}
+
+	return "", "", false
+}
+
+// matching returns the index of the bracket closing the one at the start of content, skipping escapes and code,
+// or -1 if it is not closed
+func matching(content string, open, close byte) int {
+	depth := 0
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '`':
+			if end := codeSpanEnd(content[i:]); end > 0 {
+				i += end - 1
+			}
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// codeSpanEnd returns the length of the code span at the start of content, or -1 if it is not closed
+func codeSpanEnd(content string) int {
+	run := len(content) - len(strings.TrimLeft(content, "`"))
+	fence := content[:run]
+
+	for i := run; i < len(content); {
+		next := strings.Index(content[i:], fence)
+		if next < 0 {
+			return -1
+		}
+
+		end := i + next + run
+		if end == len(content) || content[end] != '`' {
+			return end
+		}
+
+		// Longer runs of backticks do not close the span
+		i = end + len(content[end:]) - len(strings.TrimLeft(content[end:], "`"))
+	}
+
+	return -1
+}
+
+// wordStart returns true if position i of content is not inside a word
+func wordStart(content string, i int) bool {
+	previous, _ := utf8.DecodeLastRuneInString(content[:i])
+	return i == 0 || !unicode.IsLetter(previous) && !unicode.IsDigit(previous)
+}
+
+// delimiter returns true if a run of *, _ or ~ at position i of content may open or close emphasis or strikethrough
+func delimiter(content string, i, run int) bool {
+	previous, _ := utf8.DecodeLastRuneInString(content[:i])
+	next, _ := utf8.DecodeRuneInString(content[i+run:])
+	spaceBefore := i == 0 || unicode.IsSpace(previous)
+	spaceAfter := i+run == len(content) || unicode.IsSpace(next)
+
+	if spaceBefore && spaceAfter {
+		return false
+	}
+
+	switch content[i] {
+	case '_':
+		// Underscores within words, as in snake_case, are text
+		return !isAlphanumeric(previous) || !isAlphanumeric(next)
+	case '~':
+		return run == 2
+	}
+
+	return true
+}
+
+func isAlphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
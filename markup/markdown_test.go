@@ -0,0 +1,82 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTranslateMarkdown(t *testing.T) {
+	cases := []struct {
+		document, want string
+	}{
+		{"Hello *world*!", "HELLO *WORLD*!"},
+		{"# Title\n\nSome text.", "# TITLE\n\nSOME TEXT."},
+		{"## Closed ##", "## CLOSED ##"},
+		{"Setext\n======", "SETEXT\n======"},
+		{"- one\n- two\n  1. three", "- ONE\n- TWO\n  1. THREE"},
+		{"- [x] done\n- [ ] todo", "- [x] DONE\n- [ ] TODO"},
+		{"> quoted\n> text", "> QUOTED TEXT"},
+		{"wrapped\nlines", "WRAPPED LINES"},
+		{"hard  \nbreak", "HARD  \nBREAK"},
+		{"Run `ls -la` now", "RUN `ls -la` NOW"},
+		{"```go\nfmt.Println(\"hi\")\n```\nafter", "```go\nfmt.Println(\"hi\")\n```\nAFTER"},
+		{"text\n\n    indented code\n\nmore", "TEXT\n\n    indented code\n\nMORE"},
+		{"See [the docs](https://example.com/docs \"Docs\").", "SEE [THE DOCS](https://example.com/docs \"Docs\")."},
+		{"![a cat](cat.png) and <https://example.com>", "![A CAT](cat.png) AND <https://example.com>"},
+		{"Visit https://example.com/a_b today", "VISIT https://example.com/a_b TODAY"},
+		{"Use [ref][1] or [ref].\n\n[1]: https://example.com\n[ref]: https://example.org",
+			"USE [REF][1] OR [REF].\n\n[1]: https://example.com\n[ref]: https://example.org"},
+		{"[not a link] and snake_case_name", "[NOT A LINK] AND SNAKE_CASE_NAME"},
+		{"---\ntitle: Hello\n---\nBody", "---\ntitle: Hello\n---\nBODY"},
+		{"| Name | Note |\n|------|:----:|\n| a | `x|y` |", "| NAME | NOTE |\n|------|:----:|\n| A | `x|y` |"},
+		{"<div>\n<p>html</p>\n</div>\n\ntext", "<div>\n<p>HTML</p>\n</div>\n\nTEXT"},
+		{"***\n\n1. first", "***\n\n1. FIRST"},
+		{"line\r\nmore\r\n", "LINE MORE\r\n"},
+	}
+
+	for _, c := range cases {
+		got, err := TranslateMarkdown(c.document, upper)
+		if err != nil {
+			t.Errorf("TranslateMarkdown should translate %q: %v", c.document, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("TranslateMarkdown translated %q incorrectly: got %q want %q", c.document, got, c.want)
+		}
+	}
+}
+
+// TestTranslateMarkdownEscaping checks that translations cannot introduce markup
+func TestTranslateMarkdownEscaping(t *testing.T) {
+	translations := map[string]string{
+		"Price":       "1. Preis",
+		"a ⟦0⟧b⟦1⟧ c": "*a* ⟦0⟧b⟦1⟧ c",
+	}
+	translate := func(phrase string) (string, error) {
+		return translations[phrase], nil
+	}
+
+	cases := []struct {
+		document, want string
+	}{
+		{"Price", "1\\. Preis"},
+		{"a **b** c", "\\*a\\* **b** c"},
+	}
+
+	for _, c := range cases {
+		got, err := TranslateMarkdown(c.document, translate)
+		if err != nil || got != c.want {
+			t.Errorf("TranslateMarkdown should escape markup in translations of %q: got %q want %q (%v)",
+				c.document, got, c.want, err)
+		}
+	}
+}
+
+func TestSplitCells(t *testing.T) {
+	got := strings.Join(splitCells(`| a \| b | `+"`c|d`"+` |`), "/")
+	want := `/|/ a \| b /|/ ` + "`c|d`" + ` /|/`
+	if got != want {
+		t.Errorf("splitCells should skip escaped pipes and code: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,384 @@
+// Package messageformat parses, translates and writes ICU MessageFormat messages,
+// e.g. "{count, plural, one {# item} other {# items}} in {folder}".
+package messageformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Message is a parsed message, a sequence of Text, Argument, Select and Pound nodes.
+type Message []Node
+
+// Node is a part of a message.
+type Node interface{}
+
+// Text is literal text. It is stored unquoted.
+type Text string
+
+// Pound is the # in plural cases, replaced by the number when the message is formatted.
+type Pound struct{}
+
+// Argument is a simple argument, like {name} or {count, number, integer}.
+type Argument struct {
+	Name, Type, Style string
+}
+
+// Select is a plural, selectordinal or select argument, choosing between messages.
+type Select struct {
+	Name string
+
+	// Type is one of "plural", "selectordinal" or "select".
+	Type   string
+	Offset int
+	Cases  []Case
+}
+
+// Case is a message chosen by a Select. Keys are plural categories like "one", exact values like "=0",
+// or select keywords like "female".
+type Case struct {
+	Key     string
+	Message Message
+}
+
+// SyntaxError describes an invalid message.
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("messageformat: %v at offset %d", e.Message, e.Offset)
+}
+
+// plural returns true for selects on numbers
+func (s Select) plural() bool {
+	return s.Type == "plural" || s.Type == "selectordinal"
+}
+
+type parser struct {
+	input  string
+	offset int
+}
+
+// Parse parses an ICU message.
+func Parse(input string) (Message, error) {
+	p := &parser{input: input}
+
+	message, err := p.message(false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: p.offset, Message: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next rune without consuming it, or -1 at the end of the input
+func (p *parser) peek() rune {
+	if p.offset >= len(p.input) {
+		return -1
+	}
+
+	r, _ := utf8.DecodeRuneInString(p.input[p.offset:])
+	return r
+}
+
+func (p *parser) next() rune {
+	r := p.peek()
+	if r >= 0 {
+		p.offset += utf8.RuneLen(r)
+	}
+	return r
+}
+
+func (p *parser) skipSpace() {
+	for unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+// syntax returns true if r has a meaning in the current context, so an apostrophe before it starts quoting
+func syntax(r rune, inPlural bool) bool {
+	return r == '{' || r == '}' || (inPlural && r == '#')
+}
+
+// message parses nodes until the end of the input, or the closing brace of a nested message
+func (p *parser) message(inPlural, nested bool) (Message, error) {
+	var message Message
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			message = append(message, Text(text.String()))
+			text.Reset()
+		}
+	}
+
+	for {
+		r := p.peek()
+		switch {
+		case r < 0:
+			if nested {
+				return nil, p.errorf("unterminated message")
+			}
+			flush()
+			return message, nil
+
+		case r == '}':
+			if !nested {
+				return nil, p.errorf("unexpected }")
+			}
+			p.next()
+			flush()
+			return message, nil
+
+		case r == '{':
+			flush()
+			node, err := p.argument()
+			if err != nil {
+				return nil, err
+			}
+			message = append(message, node)
+
+		case r == '#' && inPlural:
+			p.next()
+			flush()
+			message = append(message, Pound{})
+
+		case r == '\'':
+			p.next()
+			quoted := p.peek()
+			switch {
+			case quoted == '\'':
+				p.next()
+				text.WriteRune('\'')
+			case syntax(quoted, inPlural):
+				// Quoted text lasts until the next single apostrophe
+				for {
+					q := p.next()
+					if q < 0 {
+						return nil, p.errorf("unterminated quote")
+					}
+					if q == '\'' {
+						if p.peek() != '\'' {
+							break
+						}
+						p.next()
+					}
+					text.WriteRune(q)
+				}
+			default:
+				text.WriteRune('\'')
+			}
+
+		default:
+			text.WriteRune(p.next())
+		}
+	}
+}
+
+// word reads an identifier, e.g. an argument name, type or case key
+func (p *parser) word() string {
+	p.skipSpace()
+	start := p.offset
+	for r := p.peek(); r >= 0 && !unicode.IsSpace(r) && !strings.ContainsRune("{},", r); r = p.peek() {
+		p.next()
+	}
+	return p.input[start:p.offset]
+}
+
+// argument parses an argument, starting at its opening brace
+func (p *parser) argument() (Node, error) {
+	p.next()
+
+	name := p.word()
+	if name == "" {
+		return nil, p.errorf("missing argument name")
+	}
+
+	p.skipSpace()
+	switch p.next() {
+	case '}':
+		return Argument{Name: name}, nil
+	case ',':
+	default:
+		return nil, p.errorf("expected , or } after argument name")
+	}
+
+	argumentType := p.word()
+	if argumentType == "" {
+		return nil, p.errorf("missing argument type")
+	}
+
+	switch argumentType {
+	case "plural", "selectordinal", "select":
+		p.skipSpace()
+		if p.next() != ',' {
+			return nil, p.errorf("expected , after %v", argumentType)
+		}
+		return p.selectCases(Select{Name: name, Type: argumentType})
+	}
+
+	p.skipSpace()
+	switch p.next() {
+	case '}':
+		return Argument{Name: name, Type: argumentType}, nil
+	case ',':
+	default:
+		return nil, p.errorf("expected , or } after argument type")
+	}
+
+	// Styles are kept as they are, only nested braces need to be balanced
+	start, depth := p.offset, 0
+	for {
+		switch p.next() {
+		case -1:
+			return nil, p.errorf("unterminated argument")
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				style := strings.TrimSpace(p.input[start : p.offset-1])
+				return Argument{Name: name, Type: argumentType, Style: style}, nil
+			}
+			depth--
+		}
+	}
+}
+
+// selectCases parses the cases of a select, up to its closing brace
+func (p *parser) selectCases(s Select) (Node, error) {
+	p.skipSpace()
+	if s.plural() && strings.HasPrefix(p.input[p.offset:], "offset:") {
+		p.offset += len("offset:")
+		value := p.word()
+		offset, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, p.errorf("invalid offset %q", value)
+		}
+		s.Offset = offset
+	}
+
+	hasOther := false
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.next()
+			break
+		}
+
+		key := p.word()
+		if key == "" {
+			return nil, p.errorf("missing case key")
+		}
+
+		p.skipSpace()
+		if p.next() != '{' {
+			return nil, p.errorf("expected { after case %v", key)
+		}
+
+		message, err := p.message(s.plural(), true)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "other" {
+			hasOther = true
+		}
+		s.Cases = append(s.Cases, Case{Key: key, Message: message})
+	}
+
+	if !hasOther {
+		return nil, p.errorf("%v argument %v has no other case", s.Type, s.Name)
+	}
+
+	return s, nil
+}
+
+// String returns the message in ICU MessageFormat syntax.
+func (m Message) String() string {
+	var builder strings.Builder
+	m.write(&builder, false, false)
+	return builder.String()
+}
+
+// write formats a message. Nested messages are followed by a closing brace.
+func (m Message) write(builder *strings.Builder, inPlural, nested bool) {
+	for i, node := range m {
+		switch node := node.(type) {
+		case Text:
+			last := i == len(m)-1 && !nested
+			writeText(builder, string(node), inPlural, last)
+
+		case Pound:
+			builder.WriteByte('#')
+
+		case Argument:
+			builder.WriteString("{" + node.Name)
+			if node.Type != "" {
+				builder.WriteString(", " + node.Type)
+			}
+			if node.Style != "" {
+				builder.WriteString(", " + node.Style)
+			}
+			builder.WriteByte('}')
+
+		case Select:
+			fmt.Fprintf(builder, "{%v, %v,", node.Name, node.Type)
+			if node.Offset != 0 {
+				fmt.Fprintf(builder, " offset:%d", node.Offset)
+			}
+			for _, c := range node.Cases {
+				builder.WriteString(" " + c.Key + " {")
+				c.Message.write(builder, node.plural(), true)
+				builder.WriteByte('}')
+			}
+			builder.WriteByte('}')
+		}
+	}
+}
+
+// writeText quotes text, so it is read back unchanged. Runs of syntax characters are quoted as one, as a quote ending
+// right before another would be read as an apostrophe. Apostrophes are only doubled where they would start or end
+// quoting.
+func writeText(builder *strings.Builder, text string, inPlural, last bool) {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		switch {
+		case syntax(r, inPlural):
+			// Apostrophes among or right after the run are quoted with it, doubled
+			end := i
+			for end < len(text) {
+				next, size := utf8.DecodeRuneInString(text[end:])
+				if next != '\'' && !syntax(next, inPlural) {
+					break
+				}
+				end += size
+			}
+			builder.WriteString("'" + strings.Replace(text[i:end], "'", "''", -1) + "'")
+			i = end
+			continue
+
+		case r == '\'':
+			next, _ := utf8.DecodeRuneInString(text[i+size:])
+			atEnd := i+size == len(text)
+			if (atEnd && !last) || (!atEnd && (next == '\'' || syntax(next, inPlural))) {
+				builder.WriteString("''")
+			} else {
+				builder.WriteRune(r)
+			}
+
+		default:
+			builder.WriteRune(r)
+		}
+		i += size
+	}
+}
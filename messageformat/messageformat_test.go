@@ -0,0 +1,211 @@
+package messageformat
+
+import (
+	"golang.org/x/text/language"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	message, err := Parse("{count, plural, offset:1 =0 {No items} one {# item} other {# items}} in {folder} on {day, date, short}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Message{
+		Select{Name: "count", Type: "plural", Offset: 1, Cases: []Case{
+			{"=0", Message{Text("No items")}},
+			{"one", Message{Pound{}, Text(" item")}},
+			{"other", Message{Pound{}, Text(" items")}},
+		}},
+		Text(" in "),
+		Argument{Name: "folder"},
+		Text(" on "),
+		Argument{Name: "day", Type: "date", Style: "short"},
+	}
+
+	if !reflect.DeepEqual(message, want) {
+		t.Errorf("Parse should return the message tree: got %#v", message)
+	}
+}
+
+func TestParseQuoting(t *testing.T) {
+	cases := map[string]string{
+		"Don't panic":              "Don't panic",
+		"It''s '{literal}'":        "It's {literal}",
+		"'{'{name}'}' and '#'":     "{",
+		"{n, plural, other {'#'}}": "#",
+	}
+
+	for given, want := range cases {
+		message, err := Parse(given)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", given, err)
+			continue
+		}
+
+		if text, _ := message[0].(Text); !strings.HasPrefix(string(text), want) {
+			if s, ok := message[0].(Select); !ok || s.Cases[0].Message[0] != Text(want) {
+				t.Errorf("Parse(%q) should unquote text: got %#v", given, message)
+			}
+		}
+
+		if message.String() != given {
+			if reparsed, _ := Parse(message.String()); !reflect.DeepEqual(reparsed, message) {
+				t.Errorf("String should write %q so it reads back unchanged: got %q", given, message.String())
+			}
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	cases := []struct {
+		given, text string
+	}{
+		{"Use '{}' for braces", "Use {} for braces"},
+		{"a '{{' b", "a {{ b"},
+		{"'{'''", "{'"},
+		{"It''s '{}'''s", "It's {}'s"},
+		{"{n, plural, other {'##' items}}", "## items"},
+		{"{n, plural, other {'{#}' and '#''' it''s}}", "{#} and #' it's"},
+	}
+
+	for _, c := range cases {
+		message, err := Parse(c.given)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", c.given, err)
+			continue
+		}
+
+		text, _ := message[0].(Text)
+		if s, ok := message[0].(Select); ok {
+			text, _ = s.Cases[0].Message[0].(Text)
+		}
+		if string(text) != c.text {
+			t.Errorf("Parse(%q) should unquote text: got %q want %q", c.given, text, c.text)
+		}
+
+		reparsed, err := Parse(message.String())
+		if err != nil || !reflect.DeepEqual(reparsed, message) {
+			t.Errorf("String should write %q so it reads back unchanged: got %q, read %#v (%v)", c.given, message.String(), reparsed, err)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, given := range []string{
+		"{name",
+		"unbalanced }",
+		"{count, plural, one {# item}}",
+		"{count, plural, other {# items}",
+		"'{unterminated",
+		"{, number}",
+	} {
+		if _, err := Parse(given); err == nil {
+			t.Errorf("Parse should reject %q", given)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	message := Message{
+		Text("It's "),
+		Select{Name: "n", Type: "plural", Cases: []Case{{"other", Message{Text("#"), Pound{}, Text(" {x}'")}}}},
+	}
+
+	want := "It's {n, plural, other {'#'# '{'x'}'''}}"
+	if message.String() != want {
+		t.Errorf("String should quote syntax characters: got %q want %q", message.String(), want)
+	}
+}
+
+func TestPluralCategories(t *testing.T) {
+	cases := []struct {
+		lang    string
+		ordinal bool
+		want    []string
+	}{
+		{"en", false, []string{"one", "other"}},
+		{"ja", false, []string{"other"}},
+		{"ru", false, []string{"one", "few", "many", "other"}},
+		{"ar", false, []string{"zero", "one", "two", "few", "many", "other"}},
+		{"en", true, []string{"one", "two", "few", "other"}},
+	}
+
+	for _, c := range cases {
+		got := PluralCategories(language.MustParse(c.lang), c.ordinal)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("PluralCategories(%v, %v): got %v want %v", c.lang, c.ordinal, got, c.want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	message, _ := Parse("{n, plural, =0 {none} one {# file} other {# files}}")
+
+	russian := Localize(message, language.Russian).String()
+	if russian != "{n, plural, =0 {none} one {# file} few {# files} many {# files} other {# files}}" {
+		t.Errorf("Localize should add the categories of the language: got %q", russian)
+	}
+
+	japanese := Localize(message, language.Japanese)
+	if japanese.String() != "{n, plural, =0 {none} other {# files}}" {
+		t.Errorf("Localize should drop categories the language does not use: got %q", japanese)
+	}
+
+	if err := Validate(japanese, language.Japanese); err != nil {
+		t.Errorf("Validate should accept localized messages: %v", err)
+	}
+
+	if err := Validate(message, language.Japanese); err == nil {
+		t.Error("Validate should reject categories the language does not use")
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	message, _ := Parse("You have {count, plural, one {# new message} other {# new messages}} from {name}.")
+
+	var phrases []string
+	translated, err := Translate(message, func(phrase string) (string, error) {
+		phrases = append(phrases, phrase)
+		return strings.ToUpper(phrase), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"⟦0⟧ new message", "⟦0⟧ new messages", "You have ⟦0⟧ from ⟦1⟧."}
+	if !reflect.DeepEqual(phrases, want) {
+		t.Errorf("Translate should translate text with placeholders for arguments: got %q", phrases)
+	}
+
+	if translated.String() != "YOU HAVE {count, plural, one {# NEW MESSAGE} other {# NEW MESSAGES}} FROM {name}." {
+		t.Errorf("Translate should keep arguments unchanged: got %q", translated)
+	}
+
+	_, err = Translate(message, func(phrase string) (string, error) {
+		return "lost", nil
+	})
+	if err == nil {
+		t.Error("Translate should fail when arguments are lost")
+	}
+}
+
+func TestTranslateTo(t *testing.T) {
+	message, _ := Parse("{n, plural, one {# file} other {# files}}")
+
+	translated, err := TranslateTo(message, language.Japanese, func(phrase string) (string, error) {
+		return strings.ToUpper(phrase), nil
+	})
+	if err != nil || translated != "{n, plural, other {# FILES}}" {
+		t.Errorf("TranslateTo should translate and localize messages: got %q (%v)", translated, err)
+	}
+
+	_, err = TranslateTo(message, language.Japanese, func(phrase string) (string, error) {
+		return "lost", nil
+	})
+	if err == nil {
+		t.Error("TranslateTo should fail when arguments are lost")
+	}
+}
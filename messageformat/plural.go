@@ -0,0 +1,153 @@
+package messageformat
+
+import (
+	"fmt"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"strings"
+)
+
+// categoryOrder is the order of plural categories in CLDR
+var categoryOrder = []plural.Form{plural.Zero, plural.One, plural.Two, plural.Few, plural.Many, plural.Other}
+
+var categoryNames = map[plural.Form]string{
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+	plural.Other: "other",
+}
+
+// PluralCategories returns the plural categories a language distinguishes, e.g. one and other for English,
+// or one, few, many and other for Russian. Ordinal selects the categories of ordinal numbers, as in selectordinal.
+func PluralCategories(lang language.Tag, ordinal bool) []string {
+	rules := plural.Cardinal
+	if ordinal {
+		rules = plural.Ordinal
+	}
+
+	// The rules cannot be listed, so find the categories used by a broad sample of numbers
+	found := map[plural.Form]bool{plural.Other: true}
+	for i := 0; i <= 1000; i++ {
+		found[rules.MatchPlural(lang, i, 0, 0, 0, 0)] = true
+	}
+	for _, i := range []int{10000, 100000, 1000000, 10000000} {
+		found[rules.MatchPlural(lang, i, 0, 0, 0, 0)] = true
+	}
+	if !ordinal {
+		for i := 0; i <= 20; i++ {
+			for f := 0; f <= 9; f++ {
+				w := 1
+				if f == 0 {
+					w = 0
+				}
+				found[rules.MatchPlural(lang, i, 1, w, f, f)] = true
+			}
+		}
+	}
+
+	var categories []string
+	for _, form := range categoryOrder {
+		if found[form] {
+			categories = append(categories, categoryNames[form])
+		}
+	}
+
+	return categories
+}
+
+// exact returns true for case keys matching exact values, like =0
+func exact(key string) bool {
+	return strings.HasPrefix(key, "=")
+}
+
+// Localize adapts the plural cases of a message to the plural rules of a language. Cases for categories the language
+// does not use are dropped, and missing categories are added as copies of the other case.
+func Localize(message Message, lang language.Tag) Message {
+	localized := make(Message, len(message))
+
+	for i, node := range message {
+		s, ok := node.(Select)
+		if !ok {
+			localized[i] = node
+			continue
+		}
+
+		cases := make(map[string]Message)
+		var exactCases []Case
+		for _, c := range s.Cases {
+			c.Message = Localize(c.Message, lang)
+			if exact(c.Key) || !s.plural() {
+				exactCases = append(exactCases, c)
+			} else {
+				cases[c.Key] = c.Message
+			}
+		}
+
+		if !s.plural() {
+			s.Cases = exactCases
+			localized[i] = s
+			continue
+		}
+
+		s.Cases = exactCases
+		for _, category := range PluralCategories(lang, s.Type == "selectordinal") {
+			message, ok := cases[category]
+			if !ok {
+				message = cases["other"]
+			}
+			s.Cases = append(s.Cases, Case{Key: category, Message: message})
+		}
+
+		localized[i] = s
+	}
+
+	return localized
+}
+
+// Validate checks that a message can be formatted in a language: every select has an other case,
+// and plural cases are exact values or categories the language uses.
+func Validate(message Message, lang language.Tag) error {
+	for _, node := range message {
+		s, ok := node.(Select)
+		if !ok {
+			continue
+		}
+
+		var categories []string
+		if s.plural() {
+			categories = PluralCategories(lang, s.Type == "selectordinal")
+		}
+
+		hasOther := false
+		for _, c := range s.Cases {
+			if c.Key == "other" {
+				hasOther = true
+			}
+
+			if s.plural() && !exact(c.Key) && !contains(categories, c.Key) {
+				return fmt.Errorf("messageformat: %v argument %v has case %v, which %v does not use", s.Type, s.Name, c.Key, lang)
+			}
+
+			if err := Validate(c.Message, lang); err != nil {
+				return err
+			}
+		}
+
+		if !hasOther {
+			return fmt.Errorf("messageformat: %v argument %v has no other case", s.Type, s.Name)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package messageformat
+
+import (
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+)
+
+// Translate returns a copy of a message with its text translated. Arguments are kept unchanged.
+// Text is translated together with the arguments around it, replaced by placeholders, so translations keep their
+// context and may reorder arguments. Each case of a plural or select argument is translated as a message of its own.
+func Translate(message Message, translate func(string) (string, error)) (Message, error) {
+	nodes := make(Message, len(message))
+	for i, node := range message {
+		s, ok := node.(Select)
+		if !ok {
+			nodes[i] = node
+			continue
+		}
+
+		cases := make([]Case, len(s.Cases))
+		for j, c := range s.Cases {
+			translated, err := Translate(c.Message, translate)
+			if err != nil {
+				return nil, err
+			}
+			cases[j] = Case{Key: c.Key, Message: translated}
+		}
+
+		s.Cases = cases
+		nodes[i] = s
+	}
+
+	// Translate text with placeholders for everything else
+	pieces := make([]placeholder.Piece, len(nodes))
+	for i, node := range nodes {
+		if t, ok := node.(Text); ok {
+			pieces[i] = placeholder.Piece{Text: string(t)}
+		} else {
+			pieces[i] = placeholder.Piece{Opaque: true}
+		}
+	}
+
+	translated, err := placeholder.Translate(pieces, translate)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Message
+	for _, piece := range translated {
+		if piece.Opaque {
+			result = append(result, nodes[piece.Index])
+		} else if piece.Text != "" {
+			result = append(result, Text(piece.Text))
+		}
+	}
+
+	return result, nil
+}
+
+// TranslateTo translates a message into lang, with its plural cases adapted to the language, and returns it as text.
+// Translations that do not read back as a valid message fail.
+func TranslateTo(message Message, lang language.Tag, translate func(string) (string, error)) (string, error) {
+	translated, err := Translate(message, translate)
+	if err != nil {
+		return "", err
+	}
+
+	result := Localize(translated, lang).String()
+	reparsed, err := Parse(result)
+	if err != nil {
+		return "", err
+	}
+
+	if err := Validate(reparsed, lang); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
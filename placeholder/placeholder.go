@@ -0,0 +1,311 @@
+// Package placeholder hides parts of a text from upstream services, by replacing them with opaque placeholders
+// before translation, and restoring them afterwards.
+package placeholder
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Placeholders look like ⟦0⟧. Services occasionally add spaces inside the brackets, which is tolerated.
+var placeholderPattern = regexp.MustCompile(`⟦\s*(\d+)\s*⟧`)
+
+// Span is a part of a text to be replaced by a placeholder, from byte offset Start up to End.
+type Span struct {
+	Start, End int
+
+	// Restore replaces the placeholder after translation, e.g. the original text or its approved translation
+	Restore string
+}
+
+// Masked is a text whose spans have been replaced by placeholders.
+type Masked struct {
+	Text    string
+	restore []string
+}
+
+// placeholder returns the placeholder for the span with the given index
+func placeholder(index int) string {
+	return fmt.Sprintf("⟦%d⟧", index)
+}
+
+// Mask replaces the given spans of text by placeholders. Where spans overlap, the one starting first is kept,
+// or the longest one if they start at the same offset. Placeholders already in the text, e.g. from masking it
+// before, are masked as well, so they are restored unchanged.
+func Mask(text string, spans []Span) Masked {
+	var sorted []Span
+	for _, location := range placeholderPattern.FindAllStringIndex(text, -1) {
+		sorted = append(sorted, Span{location[0], location[1], text[location[0]:location[1]]})
+	}
+	sorted = append(sorted, spans...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End > sorted[j].End
+	})
+
+	var builder strings.Builder
+	masked := Masked{}
+
+	offset := 0
+	for _, span := range sorted {
+		if span.Start < offset || span.End <= span.Start || span.End > len(text) {
+			continue
+		}
+
+		builder.WriteString(text[offset:span.Start])
+		builder.WriteString(placeholder(len(masked.restore)))
+		masked.restore = append(masked.restore, span.Restore)
+		offset = span.End
+	}
+	builder.WriteString(text[offset:])
+
+	masked.Text = builder.String()
+	return masked
+}
+
+// Len returns the number of placeholders in the masked text.
+func (m Masked) Len() int {
+	return len(m.restore)
+}
+
+// Unmask restores the placeholders in a translation of the masked text. Placeholders that were lost, duplicated
+// or invented by the service result in an error, as the translation could not be restored faithfully.
+func (m Masked) Unmask(translated string) (string, error) {
+	if len(m.restore) == 0 {
+		return translated, nil
+	}
+
+	seen := make([]bool, len(m.restore))
+	var err error
+
+	restored := placeholderPattern.ReplaceAllStringFunc(translated, func(match string) string {
+		index, _ := strconv.Atoi(placeholderPattern.FindStringSubmatch(match)[1])
+		if index >= len(m.restore) {
+			err = errors.Errorf("unknown placeholder %v in translation", match)
+			return match
+		}
+
+		if seen[index] {
+			err = errors.Errorf("placeholder %v duplicated in translation", placeholder(index))
+		}
+		seen[index] = true
+
+		return m.restore[index]
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	for index, ok := range seen {
+		if !ok {
+			return "", errors.Errorf("placeholder %v lost in translation", placeholder(index))
+		}
+	}
+
+	return restored, nil
+}
+
+// Piece is a part of a text to translate. Opaque pieces, e.g. markup, are replaced by placeholders.
+type Piece struct {
+	Text   string
+	Opaque bool
+
+	// Edge is 1 for opaque pieces starting a paired element, like <b>, -1 for those ending one, and 0 for all others
+	Edge int
+
+	// Index is the position of an opaque piece in the pieces passed to Translate
+	Index int
+}
+
+// Split splits text into pieces, with the matches of pattern, e.g. format specifiers, as opaque pieces.
+func Split(text string, pattern *regexp.Regexp) []Piece {
+	var pieces []Piece
+
+	start := 0
+	for _, location := range pattern.FindAllStringIndex(text, -1) {
+		if location[0] > start {
+			pieces = append(pieces, Piece{Text: text[start:location[0]]})
+		}
+		pieces = append(pieces, Piece{Text: text[location[0]:location[1]], Opaque: true})
+		start = location[1]
+	}
+	if start < len(text) {
+		pieces = append(pieces, Piece{Text: text[start:]})
+	}
+
+	return pieces
+}
+
+// pieceMarker stands in for opaque pieces while restoring a translation. Translations never contain NUL bytes.
+const pieceMarker = "\x00"
+
+// Translate translates pieces as one text, with opaque pieces replaced by placeholders, so text keeps its context.
+// It returns the pieces of the translation: text as translated, and opaque pieces unchanged in their new order.
+// Pieces without any letters are not translated. Whitespace around the text is kept, as services tend to drop it.
+func Translate(pieces []Piece, translate func(string) (string, error)) ([]Piece, error) {
+	var text strings.Builder
+	var spans []Span
+	words := false
+
+	for i, piece := range pieces {
+		if !piece.Opaque {
+			text.WriteString(piece.Text)
+			words = words || strings.IndexFunc(piece.Text, unicode.IsLetter) >= 0
+			continue
+		}
+
+		start := text.Len()
+		fmt.Fprintf(&text, "{%d}", i)
+		spans = append(spans, Span{Start: start, End: text.Len(), Restore: pieceMarker + strconv.Itoa(i) + pieceMarker})
+	}
+
+	if !words {
+		translated := make([]Piece, len(pieces))
+		for i, piece := range pieces {
+			piece.Index = i
+			translated[i] = piece
+		}
+		return translated, nil
+	}
+
+	masked := Mask(text.String(), spans)
+	trimmed := strings.TrimSpace(masked.Text)
+	leading := masked.Text[:strings.Index(masked.Text, trimmed)]
+	trailing := masked.Text[len(leading)+len(trimmed):]
+
+	translation, err := translate(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := masked.Unmask(leading + strings.TrimSpace(translation) + trailing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Markers alternate with text: text, index, text, index, ..., text
+	var translated []Piece
+	for i, part := range strings.Split(restored, pieceMarker) {
+		if i%2 == 0 {
+			if part != "" {
+				translated = append(translated, Piece{Text: part})
+			}
+			continue
+		}
+
+		index, _ := strconv.Atoi(part)
+		piece := pieces[index]
+		piece.Index = index
+		translated = append(translated, piece)
+	}
+
+	return translated, nil
+}
+
+// Balanced returns true if the paired elements of translated pieces are nested as they were in the pieces passed to
+// Translate. Elements whose start or end is not among the pieces are not checked.
+func Balanced(pieces, translated []Piece) bool {
+	// Each end is paired with the start it closed before translation
+	starts := make(map[int]int)
+	var open []int
+	for i, piece := range pieces {
+		switch {
+		case !piece.Opaque:
+		case piece.Edge > 0:
+			open = append(open, i)
+		case piece.Edge < 0 && len(open) > 0:
+			starts[i] = open[len(open)-1]
+			open = open[:len(open)-1]
+		}
+	}
+
+	paired := make(map[int]bool, 2*len(starts))
+	for end, start := range starts {
+		paired[end], paired[start] = true, true
+	}
+
+	open = nil
+	for _, piece := range translated {
+		if !piece.Opaque || !paired[piece.Index] {
+			continue
+		}
+
+		if pieces[piece.Index].Edge > 0 {
+			open = append(open, piece.Index)
+			continue
+		}
+
+		if len(open) == 0 || open[len(open)-1] != starts[piece.Index] {
+			return false
+		}
+		open = open[:len(open)-1]
+	}
+
+	return len(open) == 0
+}
+
+// TranslatePaired translates pieces like Translate, keeping paired elements intact. Translations that broke the
+// nesting of elements are replaced by translating each text on its own, as are those that failed.
+func TranslatePaired(pieces []Piece, translate func(string) (string, error)) ([]Piece, error) {
+	translated, err := Translate(pieces, translate)
+	if err == nil && Balanced(pieces, translated) {
+		return translated, nil
+	}
+
+	translated = nil
+	for i, piece := range pieces {
+		if !piece.Opaque {
+			texts, err := Translate([]Piece{piece}, translate)
+			if err != nil {
+				return nil, err
+			}
+			piece.Text = Join(texts)
+		}
+		piece.Index = i
+		translated = append(translated, piece)
+	}
+
+	return translated, nil
+}
+
+// Join returns the text of pieces.
+func Join(pieces []Piece) string {
+	var text strings.Builder
+	for _, piece := range pieces {
+		text.WriteString(piece.Text)
+	}
+	return text.String()
+}
+
+// Splice replaces the text of a document from byte offset Start up to End.
+type Splice struct {
+	Start, End int
+	Text       string
+}
+
+// Apply returns a document with splices applied, in order of their offsets.
+func Apply(document string, splices []Splice) string {
+	sort.SliceStable(splices, func(i, j int) bool {
+		return splices[i].Start < splices[j].Start
+	})
+
+	var result strings.Builder
+	offset := 0
+	for _, splice := range splices {
+		result.WriteString(document[offset:splice.Start])
+		result.WriteString(splice.Text)
+		offset = splice.End
+	}
+	result.WriteString(document[offset:])
+
+	return result.String()
+}
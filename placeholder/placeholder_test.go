@@ -0,0 +1,101 @@
+package placeholder
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMaskUnmask(t *testing.T) {
+	text := "Open Acme Cloud at https://acme.example"
+	masked := Mask(text, []Span{
+		{Start: 19, End: 39, Restore: "https://acme.example"},
+		{Start: 5, End: 15, Restore: "Acme Cloud"},
+		{Start: 5, End: 9, Restore: "Acme"},
+	})
+
+	if masked.Text != "Open ⟦0⟧ at ⟦1⟧" || masked.Len() != 2 {
+		t.Errorf("Mask should replace the longest of overlapping spans: got %q", masked.Text)
+	}
+
+	restored, err := masked.Unmask("Öffne ⟦ 0 ⟧ unter ⟦1⟧")
+	if err != nil || restored != "Öffne Acme Cloud unter https://acme.example" {
+		t.Errorf("Unmask should restore spaced placeholders: got %q (%v)", restored, err)
+	}
+
+	for _, translated := range []string{"Öffne ⟦0⟧", "⟦0⟧ ⟦0⟧ ⟦1⟧", "⟦0⟧ ⟦1⟧ ⟦2⟧"} {
+		if _, err := masked.Unmask(translated); err == nil {
+			t.Errorf("Unmask should reject translations with damaged placeholders: %q", translated)
+		}
+	}
+}
+
+func TestMaskNothing(t *testing.T) {
+	masked := Mask("Hello", nil)
+
+	restored, err := masked.Unmask("Hallo")
+	if masked.Text != "Hello" || err != nil || restored != "Hallo" {
+		t.Errorf("Mask without spans should not change the text: got %q, %q (%v)", masked.Text, restored, err)
+	}
+}
+
+func TestMaskTwice(t *testing.T) {
+	inner := Mask("Visit Acme at acme.example", []Span{{Start: 6, End: 10, Restore: "ACME"}})
+	start := strings.Index(inner.Text, "acme.example")
+	outer := Mask(inner.Text, []Span{{Start: start, End: start + 12, Restore: "acme.example"}})
+
+	if outer.Text != "Visit ⟦0⟧ at ⟦1⟧" {
+		t.Errorf("Mask should renumber existing placeholders: got %q", outer.Text)
+	}
+
+	restored, err := outer.Unmask("Besuche ⟦0⟧ unter ⟦1⟧")
+	if err == nil {
+		restored, err = inner.Unmask(restored)
+	}
+
+	if err != nil || restored != "Besuche ACME unter acme.example" {
+		t.Errorf("Unmask should restore nested placeholders: got %q (%v)", restored, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	pieces := Split("%s of %d files", regexp.MustCompile(`%[sd]`))
+	want := []Piece{{Text: "%s", Opaque: true}, {Text: " of "}, {Text: "%d", Opaque: true}, {Text: " files"}}
+
+	if !reflect.DeepEqual(pieces, want) {
+		t.Errorf("Split should make the matches opaque pieces: got %v want %v", pieces, want)
+	}
+}
+
+func TestTranslatePaired(t *testing.T) {
+	pieces := []Piece{
+		{Text: "<b>", Opaque: true, Edge: 1}, {Text: "bold"}, {Text: "</b>", Opaque: true, Edge: -1},
+		{Text: " and "},
+		{Text: "<i>", Opaque: true, Edge: 1}, {Text: "italic"}, {Text: "</i>", Opaque: true, Edge: -1},
+	}
+
+	reordered, err := TranslatePaired(pieces, func(string) (string, error) {
+		return "⟦2⟧kursiv⟦3⟧ und ⟦0⟧fett⟦1⟧", nil
+	})
+	if err != nil || Join(reordered) != "<i>kursiv</i> und <b>fett</b>" {
+		t.Errorf("TranslatePaired should keep reordered elements: got %q (%v)", Join(reordered), err)
+	}
+
+	broken, err := TranslatePaired(pieces, func(phrase string) (string, error) {
+		if strings.Contains(phrase, "⟦") {
+			return "⟦0⟧fett ⟦2⟧und⟦1⟧ kursiv⟦3⟧", nil
+		}
+		return strings.ToUpper(phrase), nil
+	})
+	if err != nil || Join(broken) != "<b>BOLD</b> AND <i>ITALIC</i>" {
+		t.Errorf("TranslatePaired should translate texts on their own if elements overlap: got %q (%v)", Join(broken), err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	applied := Apply("Hello world", []Splice{{Start: 6, End: 11, Text: "Welt"}, {Start: 0, End: 5, Text: "Hallo"}})
+	if applied != "Hallo Welt" {
+		t.Errorf("Apply should apply splices in order of their offsets: got %q", applied)
+	}
+}
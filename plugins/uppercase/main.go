@@ -0,0 +1,47 @@
+// uppercase is a sample translate-server plugin. It "translates" text by converting it to upper case.
+//
+// Plugins read requests from standard input and write responses to standard output, one JSON object per line.
+// Requests look like {"id": 1, "method": "translate", "text": "Hallo", "source": "de", "target": "en"},
+// and are answered with {"id": 1, "text": "HALLO"} or {"id": 1, "error": "reason"}. Health checks are sent
+// as {"id": 2, "method": "health"}, and answered with {"id": 2}. Logs may be written to standard error.
+//
+// For testing supervision, translating the text "crash" makes the plugin exit.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/kuboschek/translate-server/upstream"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		request := upstream.PluginRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			log.Printf("invalid request: %v", err)
+			continue
+		}
+
+		response := upstream.PluginResponse{ID: request.ID}
+		switch request.Method {
+		case "health":
+		case "translate":
+			if request.Text == "crash" {
+				log.Fatal("crashing on request")
+			}
+			response.Text = strings.ToUpper(request.Text)
+		default:
+			response.Error = "unknown method " + request.Method
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
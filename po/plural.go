@@ -0,0 +1,330 @@
+package po
+
+import (
+	"fmt"
+	"golang.org/x/text/language"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PluralForms are the plural rules of a language, as in the Plural-Forms header,
+// e.g. "nplurals=2; plural=(n != 1);".
+type PluralForms struct {
+	// N is the number of plural forms
+	N int
+
+	expression expression
+}
+
+// Form returns the index of the plural form for the number n.
+func (p PluralForms) Form(n int) int {
+	form := p.expression.evaluate(n)
+	if form < 0 || form >= p.N {
+		return p.N - 1
+	}
+	return form
+}
+
+// defaultPluralForms are the plural forms of common languages, from the gettext manual
+var defaultPluralForms = map[string]string{
+	"ja": "nplurals=1; plural=0;", "zh": "nplurals=1; plural=0;", "ko": "nplurals=1; plural=0;",
+	"vi": "nplurals=1; plural=0;", "th": "nplurals=1; plural=0;", "id": "nplurals=1; plural=0;",
+	"ms": "nplurals=1; plural=0;",
+
+	"en": "nplurals=2; plural=(n != 1);", "de": "nplurals=2; plural=(n != 1);", "nl": "nplurals=2; plural=(n != 1);",
+	"sv": "nplurals=2; plural=(n != 1);", "da": "nplurals=2; plural=(n != 1);", "nb": "nplurals=2; plural=(n != 1);",
+	"nn": "nplurals=2; plural=(n != 1);", "no": "nplurals=2; plural=(n != 1);", "fi": "nplurals=2; plural=(n != 1);",
+	"et": "nplurals=2; plural=(n != 1);", "it": "nplurals=2; plural=(n != 1);", "es": "nplurals=2; plural=(n != 1);",
+	"pt": "nplurals=2; plural=(n != 1);", "el": "nplurals=2; plural=(n != 1);", "hu": "nplurals=2; plural=(n != 1);",
+	"bg": "nplurals=2; plural=(n != 1);", "ca": "nplurals=2; plural=(n != 1);", "eu": "nplurals=2; plural=(n != 1);",
+	"gl": "nplurals=2; plural=(n != 1);", "he": "nplurals=2; plural=(n != 1);", "tr": "nplurals=2; plural=(n != 1);",
+	"hi": "nplurals=2; plural=(n != 1);",
+
+	"fr":    "nplurals=2; plural=(n > 1);",
+	"pt-BR": "nplurals=2; plural=(n > 1);",
+
+	"ru": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"uk": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"be": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"sr": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"hr": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"bs": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"pl": "nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"cs": "nplurals=3; plural=(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2;",
+	"sk": "nplurals=3; plural=(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2;",
+	"lt": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"lv": "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n != 0 ? 1 : 2);",
+	"ro": "nplurals=3; plural=(n==1 ? 0 : (n==0 || (n%100 > 0 && n%100 < 20)) ? 1 : 2);",
+	"sl": "nplurals=4; plural=(n%100==1 ? 0 : n%100==2 ? 1 : n%100==3 || n%100==4 ? 2 : 3);",
+	"ga": "nplurals=5; plural=(n==1 ? 0 : n==2 ? 1 : n>=3 && n<=6 ? 2 : n>=7 && n<=10 ? 3 : 4);",
+	"ar": "nplurals=6; plural=(n==0 ? 0 : n==1 ? 1 : n==2 ? 2 : n%100>=3 && n%100<=10 ? 3 : n%100>=11 ? 4 : 5);",
+}
+
+// DefaultPluralForms returns the Plural-Forms header for a language, or false if the language is not known.
+func DefaultPluralForms(lang language.Tag) (string, bool) {
+	base, _ := lang.Base()
+	region, _ := lang.Region()
+
+	if forms, ok := defaultPluralForms[base.String()+"-"+region.String()]; ok {
+		return forms, true
+	}
+
+	forms, ok := defaultPluralForms[base.String()]
+	return forms, ok
+}
+
+// maxPluralForms is the largest number of plural forms accepted. No language uses more than six.
+const maxPluralForms = 6
+
+// ParsePluralForms parses a Plural-Forms header.
+func ParsePluralForms(header string) (PluralForms, error) {
+	var forms PluralForms
+	var plural string
+
+	for _, part := range strings.Split(header, ";") {
+		equals := strings.Index(part, "=")
+		if equals < 0 {
+			continue
+		}
+
+		switch strings.TrimSpace(part[:equals]) {
+		case "nplurals":
+			n, err := strconv.Atoi(strings.TrimSpace(part[equals+1:]))
+			if err != nil || n < 1 || n > maxPluralForms {
+				return forms, fmt.Errorf("po: invalid nplurals in %q", header)
+			}
+			forms.N = n
+		case "plural":
+			plural = part[equals+1:]
+		}
+	}
+
+	if forms.N == 0 || plural == "" {
+		return forms, fmt.Errorf("po: incomplete Plural-Forms %q", header)
+	}
+
+	p := &expressionParser{input: plural}
+	expression, err := p.ternary()
+	if err == nil && p.skipSpace() < len(p.input) {
+		err = fmt.Errorf("unexpected %q", p.input[p.offset:])
+	}
+	if err != nil {
+		return forms, fmt.Errorf("po: invalid plural expression %q: %v", plural, err)
+	}
+
+	forms.expression = expression
+	return forms, nil
+}
+
+// expression is a C expression of the number n
+type expression interface {
+	evaluate(n int) int
+}
+
+type number int
+
+type variable struct{}
+
+type unary struct {
+	operand expression
+}
+
+type binary struct {
+	operator    string
+	left, right expression
+}
+
+type conditional struct {
+	condition, then, otherwise expression
+}
+
+func (e number) evaluate(n int) int {
+	return int(e)
+}
+
+func (e variable) evaluate(n int) int {
+	return n
+}
+
+func (e unary) evaluate(n int) int {
+	return boolean(e.operand.evaluate(n) == 0)
+}
+
+func (e conditional) evaluate(n int) int {
+	if e.condition.evaluate(n) != 0 {
+		return e.then.evaluate(n)
+	}
+	return e.otherwise.evaluate(n)
+}
+
+func (e binary) evaluate(n int) int {
+	left := e.left.evaluate(n)
+
+	// Logical operators short-circuit, as in C
+	switch e.operator {
+	case "&&":
+		return boolean(left != 0 && e.right.evaluate(n) != 0)
+	case "||":
+		return boolean(left != 0 || e.right.evaluate(n) != 0)
+	}
+
+	right := e.right.evaluate(n)
+	switch e.operator {
+	case "==":
+		return boolean(left == right)
+	case "!=":
+		return boolean(left != right)
+	case "<":
+		return boolean(left < right)
+	case "<=":
+		return boolean(left <= right)
+	case ">":
+		return boolean(left > right)
+	case ">=":
+		return boolean(left >= right)
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/", "%":
+		if right == 0 {
+			return 0
+		}
+		if e.operator == "/" {
+			return left / right
+		}
+		return left % right
+	}
+
+	return 0
+}
+
+func boolean(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// binaryOperators are the operators of each precedence level, from lowest to highest
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type expressionParser struct {
+	input  string
+	offset int
+}
+
+// skipSpace skips whitespace, and returns the offset of the next token
+func (p *expressionParser) skipSpace() int {
+	for p.offset < len(p.input) && unicode.IsSpace(rune(p.input[p.offset])) {
+		p.offset++
+	}
+	return p.offset
+}
+
+// consume skips a token, if it is next in the input
+func (p *expressionParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.offset:], token) {
+		p.offset += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *expressionParser) ternary() (expression, error) {
+	condition, err := p.binary(0)
+	if err != nil || !p.consume("?") {
+		return condition, err
+	}
+
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume(":") {
+		return nil, fmt.Errorf("expected : at offset %d", p.offset)
+	}
+
+	otherwise, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	return conditional{condition, then, otherwise}, nil
+}
+
+func (p *expressionParser) binary(level int) (expression, error) {
+	if level == len(binaryOperators) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := ""
+		for _, candidate := range binaryOperators[level] {
+			if p.consume(candidate) {
+				operator = candidate
+				break
+			}
+		}
+		if operator == "" {
+			return left, nil
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator, left, right}
+	}
+}
+
+func (p *expressionParser) unary() (expression, error) {
+	switch {
+	case p.consume("!"):
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{operand}, nil
+
+	case p.consume("("):
+		inner, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("expected ) at offset %d", p.offset)
+		}
+		return inner, nil
+
+	case p.consume("n"):
+		return variable{}, nil
+	}
+
+	start := p.skipSpace()
+	for p.offset < len(p.input) && p.input[p.offset] >= '0' && p.input[p.offset] <= '9' {
+		p.offset++
+	}
+	if start == p.offset {
+		return nil, fmt.Errorf("expected n or a number at offset %d", p.offset)
+	}
+
+	value, _ := strconv.Atoi(p.input[start:p.offset])
+	return number(value), nil
+}
@@ -0,0 +1,474 @@
+// Package po reads, writes and translates gettext PO and POT files.
+package po
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// File is a PO or POT file, a list of entries. The header is the entry with an empty msgid.
+type File struct {
+	Entries []*Entry
+}
+
+// Entry is a message with its translations and comments.
+type Entry struct {
+	// Comments are the translator, extracted, reference and previous comments as written, e.g. "#: main.c:12"
+	Comments []string
+
+	// Flags are the flags of the #, comment, e.g. "fuzzy" or "c-format"
+	Flags []string
+
+	// Context is the msgctxt of the entry, if HasContext is set
+	Context    string
+	HasContext bool
+
+	ID       string
+	IDPlural string
+
+	// Str holds the msgstr, or the msgstr[n] of each plural form of entries with an IDPlural
+	Str []string
+
+	// Obsolete entries (#~) are kept as they are written
+	Obsolete bool
+
+	// raw holds the lines the entry was read from, to write unchanged entries as they were
+	raw []string
+}
+
+// ParseError describes an invalid line of a PO file.
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("po: line %d: %v", e.Line, e.Message)
+}
+
+// Translated returns true if the entry has a translation for every form.
+func (e *Entry) Translated() bool {
+	if len(e.Str) == 0 {
+		return false
+	}
+
+	for _, str := range e.Str {
+		if str == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// HasFlag returns true if the entry has the given flag, e.g. "fuzzy".
+func (e *Entry) HasFlag(flag string) bool {
+	for _, f := range e.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFlag adds a flag to the entry, unless it has it already.
+func (e *Entry) AddFlag(flag string) {
+	if !e.HasFlag(flag) {
+		e.Flags = append(e.Flags, flag)
+		e.raw = nil
+	}
+}
+
+// SetStr sets the translations of the entry.
+func (e *Entry) SetStr(str []string) {
+	e.Str = str
+	e.raw = nil
+}
+
+// Header returns the header entry of the file, or nil if there is none.
+func (f *File) Header() *Entry {
+	for _, entry := range f.Entries {
+		if entry.ID == "" && !entry.HasContext && !entry.Obsolete {
+			return entry
+		}
+	}
+	return nil
+}
+
+// HeaderField returns a field of the header, e.g. "Plural-Forms", or an empty string if it is not set.
+func (f *File) HeaderField(name string) string {
+	header := f.Header()
+	if header == nil || len(header.Str) == 0 {
+		return ""
+	}
+
+	for _, line := range strings.Split(header.Str[0], "\n") {
+		if fieldName(line) == strings.ToLower(name) {
+			return strings.TrimSpace(line[strings.Index(line, ":")+1:])
+		}
+	}
+	return ""
+}
+
+// fieldName returns the lower case name of a header field, or an empty string for lines that are not fields
+func fieldName(line string) string {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(line[:colon]))
+}
+
+// SetHeaderField sets a field of the header, adding a header if the file has none.
+func (f *File) SetHeaderField(name, value string) {
+	header := f.Header()
+	if header == nil {
+		header = &Entry{Str: []string{""}}
+		f.Entries = append([]*Entry{header}, f.Entries...)
+	}
+	if len(header.Str) == 0 {
+		header.Str = []string{""}
+	}
+
+	field := name + ": " + value + "\n"
+
+	lines := strings.SplitAfter(header.Str[0], "\n")
+	replaced := false
+	for i, line := range lines {
+		if fieldName(line) == strings.ToLower(name) {
+			lines[i] = field
+			replaced = true
+		}
+	}
+
+	str := strings.Join(lines, "")
+	if !replaced {
+		if str != "" && !strings.HasSuffix(str, "\n") {
+			str += "\n"
+		}
+		str += field
+	}
+
+	header.SetStr([]string{str})
+}
+
+// Parse reads a PO or POT file.
+func Parse(r io.Reader) (*File, error) {
+	p := &parser{file: &File{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		p.line++
+		if err := p.parseLine(strings.TrimSuffix(scanner.Text(), "\r")); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := p.finish(); err != nil {
+		return nil, err
+	}
+
+	return p.file, nil
+}
+
+type parser struct {
+	file    *File
+	current *Entry
+	line    int
+
+	// target is the string continuation lines are appended to
+	target *string
+
+	// hasID is set once the current entry has a msgid, so comments that follow start a new entry
+	hasID bool
+}
+
+// finish adds the current entry to the file
+func (p *parser) finish() error {
+	if p.current == nil {
+		return nil
+	}
+
+	if !p.hasID && !p.current.Obsolete {
+		return &ParseError{Line: p.line, Message: "entry without msgid"}
+	}
+
+	p.file.Entries = append(p.file.Entries, p.current)
+	p.current, p.target, p.hasID = nil, nil, false
+	return nil
+}
+
+// entry returns the current entry, starting a new one if needed
+func (p *parser) entry() *Entry {
+	if p.current == nil {
+		p.current = &Entry{}
+	}
+	return p.current
+}
+
+func (p *parser) parseLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case trimmed == "":
+		return p.finish()
+
+	case strings.HasPrefix(trimmed, "#~"):
+		if p.hasID && !p.current.Obsolete {
+			if err := p.finish(); err != nil {
+				return err
+			}
+		}
+		entry := p.entry()
+		entry.Obsolete = true
+		entry.raw = append(entry.raw, line)
+		return nil
+
+	case strings.HasPrefix(trimmed, "#"):
+		if p.hasID || (p.current != nil && p.current.Obsolete) {
+			if err := p.finish(); err != nil {
+				return err
+			}
+		}
+
+		entry := p.entry()
+		entry.raw = append(entry.raw, line)
+		if strings.HasPrefix(trimmed, "#,") {
+			for _, flag := range strings.Split(trimmed[2:], ",") {
+				if flag = strings.TrimSpace(flag); flag != "" {
+					entry.Flags = append(entry.Flags, flag)
+				}
+			}
+		} else {
+			entry.Comments = append(entry.Comments, trimmed)
+		}
+		return nil
+
+	case strings.HasPrefix(trimmed, `"`):
+		if p.target == nil {
+			return &ParseError{Line: p.line, Message: "string without keyword"}
+		}
+
+		value, err := p.unquote(trimmed)
+		if err != nil {
+			return err
+		}
+		*p.target += value
+		p.current.raw = append(p.current.raw, line)
+		return nil
+	}
+
+	space := strings.IndexAny(trimmed, " \t")
+	if space < 0 {
+		return &ParseError{Line: p.line, Message: "expected keyword and string"}
+	}
+	keyword := trimmed[:space]
+
+	value, err := p.unquote(strings.TrimSpace(trimmed[space:]))
+	if err != nil {
+		return err
+	}
+
+	// Keywords after a msgstr start the next entry
+	if p.current != nil && len(p.current.Str) > 0 && (keyword == "msgctxt" || keyword == "msgid") {
+		if err := p.finish(); err != nil {
+			return err
+		}
+	}
+
+	entry := p.entry()
+	if entry.Obsolete {
+		return &ParseError{Line: p.line, Message: "message in an obsolete entry"}
+	}
+	entry.raw = append(entry.raw, line)
+
+	switch {
+	case keyword == "msgctxt":
+		entry.Context, entry.HasContext = value, true
+		p.target = &entry.Context
+
+	case keyword == "msgid":
+		entry.ID = value
+		p.target = &entry.ID
+		p.hasID = true
+
+	case keyword == "msgid_plural":
+		entry.IDPlural = value
+		p.target = &entry.IDPlural
+
+	case keyword == "msgstr":
+		entry.Str = []string{value}
+		p.target = &entry.Str[0]
+
+	case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+		index, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+		if err != nil || index != len(entry.Str) {
+			return &ParseError{Line: p.line, Message: "unexpected " + keyword}
+		}
+		entry.Str = append(entry.Str, value)
+
+		// Appending may move the strings, but continuation lines only follow their own msgstr
+		p.target = &entry.Str[index]
+
+	default:
+		return &ParseError{Line: p.line, Message: "unknown keyword " + keyword}
+	}
+
+	if keyword != "msgctxt" && keyword != "msgid" && !p.hasID {
+		return &ParseError{Line: p.line, Message: keyword + " before msgid"}
+	}
+
+	return nil
+}
+
+// unquote reads a C string literal
+func (p *parser) unquote(quoted string) (string, error) {
+	if len(quoted) < 2 || !strings.HasPrefix(quoted, `"`) || !strings.HasSuffix(quoted, `"`) {
+		return "", &ParseError{Line: p.line, Message: "expected a quoted string"}
+	}
+
+	var value strings.Builder
+	content := quoted[1 : len(quoted)-1]
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c == '"' {
+			return "", &ParseError{Line: p.line, Message: "unescaped quote in string"}
+		}
+		if c != '\\' {
+			value.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(content) {
+			return "", &ParseError{Line: p.line, Message: "unterminated escape sequence"}
+		}
+
+		switch content[i] {
+		case 'n':
+			value.WriteByte('\n')
+		case 't':
+			value.WriteByte('\t')
+		case 'r':
+			value.WriteByte('\r')
+		case 'a':
+			value.WriteByte('\a')
+		case 'b':
+			value.WriteByte('\b')
+		case 'f':
+			value.WriteByte('\f')
+		case 'v':
+			value.WriteByte('\v')
+		case '\\', '"', '\'', '?':
+			value.WriteByte(content[i])
+		default:
+			return "", &ParseError{Line: p.line, Message: fmt.Sprintf("unknown escape sequence \\%c", content[i])}
+		}
+	}
+
+	return value.String(), nil
+}
+
+// quote writes a C string literal
+func quote(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '\n':
+			quoted.WriteString(`\n`)
+		case '\t':
+			quoted.WriteString(`\t`)
+		case '\r':
+			quoted.WriteString(`\r`)
+		case '\\', '"':
+			quoted.WriteRune('\\')
+			quoted.WriteRune(r)
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// writeString writes a keyword and its string. Strings with line breaks are written a line at a time.
+func writeString(w *bufio.Writer, keyword, value string) {
+	lines := strings.SplitAfter(value, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) <= 1 {
+		fmt.Fprintf(w, "%v %v\n", keyword, quote(value))
+		return
+	}
+
+	fmt.Fprintf(w, "%v \"\"\n", keyword)
+	for _, line := range lines {
+		fmt.Fprintln(w, quote(line))
+	}
+}
+
+// write writes an entry. Unchanged entries are written as they were read.
+func (e *Entry) write(w *bufio.Writer) {
+	if e.raw != nil {
+		for _, line := range e.raw {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+
+	for _, comment := range e.Comments {
+		if !strings.HasPrefix(comment, "#|") {
+			fmt.Fprintln(w, comment)
+		}
+	}
+	if len(e.Flags) > 0 {
+		fmt.Fprintf(w, "#, %v\n", strings.Join(e.Flags, ", "))
+	}
+	for _, comment := range e.Comments {
+		if strings.HasPrefix(comment, "#|") {
+			fmt.Fprintln(w, comment)
+		}
+	}
+
+	if e.HasContext {
+		writeString(w, "msgctxt", e.Context)
+	}
+	writeString(w, "msgid", e.ID)
+
+	if e.IDPlural == "" {
+		str := ""
+		if len(e.Str) > 0 {
+			str = e.Str[0]
+		}
+		writeString(w, "msgstr", str)
+		return
+	}
+
+	writeString(w, "msgid_plural", e.IDPlural)
+	for i, str := range e.Str {
+		writeString(w, fmt.Sprintf("msgstr[%d]", i), str)
+	}
+}
+
+// Write writes a file in PO format, with a blank line between entries.
+func (f *File) Write(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+
+	for i, entry := range f.Entries {
+		if i > 0 {
+			buffered.WriteByte('\n')
+		}
+		entry.write(buffered)
+	}
+
+	return buffered.Flush()
+}
@@ -0,0 +1,201 @@
+package po
+
+import (
+	"bytes"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func readTestFile(t *testing.T) (*File, string) {
+	content, err := ioutil.ReadFile("testdata/messages.pot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse should read the test file: %v", err)
+	}
+
+	return file, string(content)
+}
+
+func TestParse(t *testing.T) {
+	file, _ := readTestFile(t)
+
+	if len(file.Entries) != 7 {
+		t.Fatalf("Parse should read all entries: got %d want 7", len(file.Entries))
+	}
+
+	plural := file.Entries[2]
+	if plural.ID != "You have %d new message" || plural.IDPlural != "You have %d new messages" || len(plural.Str) != 2 {
+		t.Errorf("Parse should read plural messages: got %#v", plural)
+	}
+
+	if menu := file.Entries[3]; !menu.HasContext || menu.Context != "menu" || len(menu.Comments) != 2 {
+		t.Errorf("Parse should read contexts and comments: got %#v", menu)
+	}
+
+	if long := file.Entries[5]; long.ID != "A long text that was wrapped over several lines.\nIt has two lines.\n" {
+		t.Errorf("Parse should join continuation lines: got %q", long.ID)
+	}
+
+	if !file.Entries[6].Obsolete {
+		t.Error("Parse should keep obsolete entries")
+	}
+
+	if file.HeaderField("content-type") != "text/plain; charset=UTF-8" {
+		t.Errorf("HeaderField should read header fields: got %q", file.HeaderField("content-type"))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, document := range []string{
+		"msgid \"unterminated\nmsgstr \"\"",
+		"msgstr \"no msgid\"",
+		"msgid \"a\"\nmsgstr[1] \"b\"",
+		"msgid \"a\"\nmsgfoo \"b\"",
+		"\"orphan\"",
+	} {
+		if _, err := Parse(strings.NewReader(document)); err == nil {
+			t.Errorf("Parse should reject %q", document)
+		}
+	}
+}
+
+// TestWriteUnchanged checks that files are written as they were read, if nothing was translated
+func TestWriteUnchanged(t *testing.T) {
+	file, content := readTestFile(t)
+
+	var written bytes.Buffer
+	if err := file.Write(&written); err != nil {
+		t.Fatal(err)
+	}
+
+	if written.String() != content {
+		t.Errorf("Write should keep unchanged entries: got %q want %q", written.String(), content)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	file, _ := readTestFile(t)
+
+	count, err := Translate(file, language.Russian, upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Translate should translate untranslated messages: got %d want 4", count)
+	}
+
+	var written bytes.Buffer
+	file.Write(&written)
+
+	for _, want := range []string{
+		"\"Language: ru\\n\"",
+		"\"Plural-Forms: nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);\\n\"",
+		"#: src/app.py:12\n#, python-format, fuzzy\nmsgid \"Welcome back, %(name)s!\"\nmsgstr \"WELCOME BACK, %(name)s!\"",
+		"#, python-format, fuzzy\nmsgid \"You have %d new message\"\nmsgid_plural \"You have %d new messages\"\n" +
+			"msgstr[0] \"YOU HAVE %d NEW MESSAGE\"\nmsgstr[1] \"YOU HAVE %d NEW MESSAGES\"\nmsgstr[2] \"YOU HAVE %d NEW MESSAGES\"",
+		"#. Button label\n#: src/menu.py:3\n#, fuzzy\nmsgctxt \"menu\"\nmsgid \"Open\"\nmsgstr \"OPEN\"",
+		"#: src/menu.py:9\nmsgid \"Save\"\nmsgstr \"Already translated\"",
+		"msgstr \"\"\n\"A LONG TEXT THAT WAS WRAPPED OVER SEVERAL LINES.\\n\"\n\"IT HAS TWO LINES.\\n\"",
+		"#~ msgid \"Removed\"\n#~ msgstr \"Entfernt\"",
+	} {
+		if !strings.Contains(written.String(), want) {
+			t.Errorf("translated file should contain %q, got:\n%v", want, written.String())
+		}
+	}
+
+	// Translated files read back
+	if _, err := Parse(&written); err != nil {
+		t.Errorf("Translate should result in a valid file: %v", err)
+	}
+}
+
+func TestTranslateDirectives(t *testing.T) {
+	cases := []struct {
+		flags         []string
+		message, want string
+	}{
+		{[]string{"c-format"}, "%d of %s files", "%d OF %s FILES"},
+		{[]string{"c-format"}, "100% of users", "100% OF USERS"},
+		{nil, "50% off, %s", "50% OFF, %S"},
+		{[]string{"python-format"}, "%(count)d of %(name)s", "%(count)d OF %(name)s"},
+		{nil, "Hello {name}", "HELLO {name}"},
+		{[]string{"no-c-format"}, "Hello {name}", "HELLO {NAME}"},
+	}
+
+	for _, c := range cases {
+		translated, err := translateMessage(c.message, directives(&Entry{Flags: c.flags}), upper)
+		if err != nil || translated != c.want {
+			t.Errorf("translateMessage should keep the directives of %q %v: got %q want %q (%v)", c.message, c.flags, translated, c.want, err)
+		}
+	}
+}
+
+func TestTranslateTooManyPluralForms(t *testing.T) {
+	document := "msgid \"\"\nmsgstr \"\"\n\"Plural-Forms: nplurals=1000000000; plural=0;\\n\"\n\n" +
+		"msgid \"%d file\"\nmsgid_plural \"%d files\"\nmsgstr[0] \"\"\n"
+	file, err := Parse(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Translate(file, language.MustParse("tlh"), upper); err != ErrNoPluralForms {
+		t.Errorf("Translate should reject files with more plural forms than any language uses: got %v", err)
+	}
+}
+
+func TestPluralForms(t *testing.T) {
+	cases := []struct {
+		header string
+		forms  map[int]int
+	}{
+		{"nplurals=1; plural=0;", map[int]int{0: 0, 1: 0, 5: 0}},
+		{"nplurals=2; plural=(n != 1);", map[int]int{0: 1, 1: 0, 2: 1}},
+		{"nplurals=2; plural=n>1;", map[int]int{0: 0, 1: 0, 2: 1}},
+		{"nplurals=3; plural=(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2;", map[int]int{1: 0, 3: 1, 5: 2}},
+		{"nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+			map[int]int{1: 0, 11: 2, 21: 0, 22: 1, 12: 2, 25: 2}},
+		{"nplurals=2; plural=!(n == 1);", map[int]int{1: 0, 7: 1}},
+	}
+
+	for _, c := range cases {
+		forms, err := ParsePluralForms(c.header)
+		if err != nil {
+			t.Errorf("ParsePluralForms should parse %q: %v", c.header, err)
+			continue
+		}
+
+		for n, want := range c.forms {
+			if got := forms.Form(n); got != want {
+				t.Errorf("%q should use form %d for %d: got %d", c.header, want, n, got)
+			}
+		}
+	}
+
+	for _, header := range []string{"", "nplurals=2;", "nplurals=x; plural=0;", "nplurals=2; plural=(n != 1;", "nplurals=2; plural=n ? 1;",
+		"nplurals=1000000000; plural=0;"} {
+		if _, err := ParsePluralForms(header); err == nil {
+			t.Errorf("ParsePluralForms should reject %q", header)
+		}
+	}
+}
+
+func TestDefaultPluralForms(t *testing.T) {
+	if forms, _ := DefaultPluralForms(language.MustParse("pt-BR")); forms != "nplurals=2; plural=(n > 1);" {
+		t.Errorf("DefaultPluralForms should prefer regional rules: got %q", forms)
+	}
+
+	if _, ok := DefaultPluralForms(language.MustParse("tlh")); ok {
+		t.Error("DefaultPluralForms should not know every language")
+	}
+}
@@ -0,0 +1,148 @@
+package po
+
+import (
+	"errors"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"regexp"
+	"strings"
+)
+
+// ErrNoPluralForms is returned for files with plural messages, if neither the file nor the package know the plural
+// forms of the target language.
+var ErrNoPluralForms = errors.New("po: no plural forms known for the target language")
+
+// Format directives of the languages gettext flags messages with. Spaces are not taken as flags, as "100% of"
+// would be a directive otherwise.
+var (
+	printfDirective = `%(?:\d+\$)?[-+#0']*(?:\d+|\*)?(?:\.(?:\d+|\*))?(?:hh|h|ll|l|L|q|j|z|t)?[diouxXeEfFgGaAcspn%]`
+	pythonDirective = `%\(\w+\)[-+#0]*\d*(?:\.\d+)?[diouxXeEfFgGcrs]`
+	braceDirective  = regexp.MustCompile(`\{\w*(?:![rsa])?(?::[^{}]*)?\}`)
+)
+
+// formatDirectives match the directives of messages by their format flag, e.g. %s or %1$d for c-format
+var formatDirectives = map[string]*regexp.Regexp{
+	"c-format":            regexp.MustCompile(printfDirective),
+	"objc-format":         regexp.MustCompile(printfDirective),
+	"php-format":          regexp.MustCompile(printfDirective),
+	"python-format":       regexp.MustCompile(printfDirective + "|" + pythonDirective),
+	"python-brace-format": braceDirective,
+}
+
+// directives returns the pattern of the format directives of an entry. printf and Python directives are only
+// protected in messages flagged as such, as a percent sign is text otherwise. Placeholders like {name} are protected
+// unless the message is flagged no-*-format. It returns nil for messages without directives.
+func directives(entry *Entry) *regexp.Regexp {
+	for _, flag := range entry.Flags {
+		if pattern, ok := formatDirectives[flag]; ok {
+			return pattern
+		}
+		if strings.HasPrefix(flag, "no-") && strings.HasSuffix(flag, "-format") {
+			return nil
+		}
+	}
+
+	return braceDirective
+}
+
+// Translate fills the untranslated messages of a file with translations into lang, and marks them fuzzy, so they
+// are reviewed before use. Plural messages get a translation for each plural form of lang, from the Plural-Forms
+// header, or the rules of lang if the file has none, as POT files do. It returns the number of messages translated.
+func Translate(f *File, lang language.Tag, translate func(string) (string, error)) (int, error) {
+	if f.HeaderField("Language") == "" {
+		f.SetHeaderField("Language", lang.String())
+	}
+
+	pluralForms := f.HeaderField("Plural-Forms")
+	if _, err := ParsePluralForms(pluralForms); err != nil {
+		defaults, ok := DefaultPluralForms(lang)
+		if ok {
+			pluralForms = defaults
+			f.SetHeaderField("Plural-Forms", pluralForms)
+		}
+	}
+
+	forms, err := ParsePluralForms(pluralForms)
+	if err != nil {
+		for _, entry := range f.Entries {
+			if !entry.Obsolete && entry.IDPlural != "" && !entry.Translated() {
+				return 0, ErrNoPluralForms
+			}
+		}
+	}
+
+	// Messages repeated in other contexts are translated once
+	type message struct {
+		text       string
+		directives *regexp.Regexp
+	}
+	translations := make(map[message]string)
+	translateOnce := func(text string, directives *regexp.Regexp) (string, error) {
+		if translated, ok := translations[message{text, directives}]; ok {
+			return translated, nil
+		}
+
+		translated, err := translateMessage(text, directives, translate)
+		if err != nil {
+			return "", err
+		}
+		translations[message{text, directives}] = translated
+		return translated, nil
+	}
+
+	count := 0
+	for _, entry := range f.Entries {
+		if entry.Obsolete || entry.ID == "" || entry.Translated() {
+			continue
+		}
+
+		pattern := directives(entry)
+		if entry.IDPlural == "" {
+			translated, err := translateOnce(entry.ID, pattern)
+			if err != nil {
+				return count, err
+			}
+			entry.SetStr([]string{translated})
+		} else {
+			str := make([]string, forms.N)
+			for i := range str {
+				// The form used for one is translated from the singular
+				source := entry.IDPlural
+				if forms.Form(1) == i {
+					source = entry.ID
+				}
+
+				translated, err := translateOnce(source, pattern)
+				if err != nil {
+					return count, err
+				}
+				str[i] = translated
+			}
+			entry.SetStr(str)
+		}
+
+		entry.AddFlag("fuzzy")
+		count++
+	}
+
+	return count, nil
+}
+
+// translateMessage translates a message, keeping its format directives
+func translateMessage(message string, directives *regexp.Regexp, translate func(string) (string, error)) (string, error) {
+	pieces := []placeholder.Piece{{Text: message}}
+	if directives != nil {
+		pieces = placeholder.Split(message, directives)
+	}
+
+	translated, err := placeholder.Translate(pieces, translate)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	for _, piece := range translated {
+		result.WriteString(piece.Text)
+	}
+	return result.String(), nil
+}
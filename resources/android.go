@@ -0,0 +1,372 @@
+package resources
+
+import (
+	"encoding/xml"
+	"github.com/kuboschek/translate-server/markup"
+	"github.com/kuboschek/translate-server/messageformat"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"io"
+	"strings"
+)
+
+// androidEscaper escapes text for the value of an Android string resource. Line breaks are kept, as they are in the
+// source, where they stand for spaces.
+var androidEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`, "&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeAndroid(text string) string {
+	return androidEscaper.Replace(text)
+}
+
+// android holds the state of translating one strings.xml file
+type android struct {
+	document   string
+	decoder    *xml.Decoder
+	translate  func(string) (string, error)
+	targetLang language.Tag
+	splices    []placeholder.Splice
+}
+
+// TranslateAndroid translates the strings, string arrays and plurals of an Android strings.xml file. Resources marked
+// translatable="false" are removed, as they must not be repeated for other locales, and plurals get the quantities
+// of the target language. Inline elements are kept, and <xliff:g> elements are not translated.
+func TranslateAndroid(document string, targetLang language.Tag, translate func(string) (string, error)) (string, error) {
+	a := &android{
+		document:   document,
+		decoder:    xml.NewDecoder(strings.NewReader(document)),
+		translate:  translate,
+		targetLang: targetLang,
+	}
+
+	if err := a.run(); err != nil {
+		return "", err
+	}
+
+	return placeholder.Apply(document, a.splices), nil
+}
+
+// syntaxError returns errors of the XML decoder as syntax errors
+func (a *android) syntaxError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &SyntaxError{Format: "Android resources", Message: err.Error()}
+}
+
+func (a *android) run() error {
+	depth := 0
+	parent := ""
+	hasRoot := false
+
+	for {
+		start := int(a.decoder.InputOffset())
+		token, err := a.decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return a.syntaxError(err)
+		}
+		end := int(a.decoder.InputOffset())
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			switch {
+			case depth == 1:
+				if token.Name.Local != "resources" {
+					return &SyntaxError{Format: "Android resources", Message: "root element is not <resources>"}
+				}
+				hasRoot = true
+
+			case depth == 2 && attribute(token, "translatable") == "false":
+				if err := a.skipElement(); err != nil {
+					return err
+				}
+				a.remove(start, int(a.decoder.InputOffset()))
+				depth--
+
+			case depth == 2 && token.Name.Local == "string",
+				depth == 3 && parent == "string-array" && token.Name.Local == "item":
+				if err := a.translateElement(end); err != nil {
+					return err
+				}
+				depth--
+
+			case depth == 2 && token.Name.Local == "plurals":
+				if err := a.translatePlurals(); err != nil {
+					return err
+				}
+				depth--
+
+			case depth == 2:
+				parent = token.Name.Local
+			}
+
+		case xml.EndElement:
+			if depth == 2 {
+				parent = ""
+			}
+			depth--
+		}
+	}
+
+	if !hasRoot {
+		return &SyntaxError{Format: "Android resources", Message: "no <resources> element"}
+	}
+
+	return nil
+}
+
+// remove adds a splice removing document[start:end], with its line if nothing else is on it
+func (a *android) remove(start, end int) {
+	lineStart := strings.LastIndex(a.document[:start], "\n")
+	if lineStart >= 0 && strings.TrimSpace(a.document[lineStart:start]) == "" {
+		start = lineStart
+	}
+	a.splices = append(a.splices, placeholder.Splice{Start: start, End: end})
+}
+
+// skipElement skips the content of the current element
+func (a *android) skipElement() error {
+	for depth := 1; depth > 0; {
+		token, err := a.decoder.Token()
+		if err != nil {
+			return a.syntaxError(err)
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// translateElement translates the value of the current element, which starts at offset
+func (a *android) translateElement(offset int) error {
+	pieces, end, err := a.readValue(offset)
+	if err != nil {
+		return err
+	}
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	value, err := a.translateValue(pieces)
+	if err != nil {
+		return err
+	}
+
+	a.splices = append(a.splices, placeholder.Splice{Start: offset, End: end, Text: value})
+	return nil
+}
+
+// readValue reads the content of the current element, which starts at offset, into pieces. It returns the pieces and
+// the offset of the end tag.
+func (a *android) readValue(offset int) ([]placeholder.Piece, int, error) {
+	var pieces []placeholder.Piece
+	depth := 0
+
+	for {
+		start := offset
+		token, err := a.decoder.Token()
+		if err != nil {
+			return nil, 0, a.syntaxError(err)
+		}
+		offset = int(a.decoder.InputOffset())
+		raw := a.document[start:offset]
+
+		switch token := token.(type) {
+		case xml.CharData:
+			if strings.HasPrefix(raw, "<![CDATA[") {
+				// Character data holds HTML for Html.fromHtml
+				translated, err := markup.TranslateHTML(string(token), a.translate)
+				if err != nil {
+					return nil, 0, err
+				}
+				pieces = append(pieces, placeholder.Piece{Text: "<![CDATA[" + translated + "]]>", Opaque: true})
+				continue
+			}
+			pieces = append(pieces, unescapeAndroid(string(token))...)
+
+		case xml.StartElement:
+			// <xliff:g> marks text that must not be translated, like names or placeholders
+			if token.Name.Local == "g" || strings.HasSuffix(raw, "/>") {
+				if err := a.skipElement(); err != nil {
+					return nil, 0, err
+				}
+				offset = int(a.decoder.InputOffset())
+				pieces = append(pieces, placeholder.Piece{Text: a.document[start:offset], Opaque: true})
+				continue
+			}
+
+			depth++
+			pieces = append(pieces, placeholder.Piece{Text: raw, Opaque: true, Edge: 1})
+
+		case xml.EndElement:
+			if depth == 0 {
+				return pieces, start, nil
+			}
+			depth--
+			pieces = append(pieces, placeholder.Piece{Text: raw, Opaque: true, Edge: -1})
+
+		default:
+			pieces = append(pieces, placeholder.Piece{Text: raw, Opaque: true})
+		}
+	}
+}
+
+// unescapeAndroid splits text of a value into pieces. Escaped characters are unescaped, while escaped line breaks,
+// tabs, unicode escapes and the quotes that keep whitespace are kept as opaque pieces, as are format specifiers.
+func unescapeAndroid(text string) []placeholder.Piece {
+	var pieces []placeholder.Piece
+	var current strings.Builder
+
+	flush := func() {
+		for _, p := range placeholder.Split(current.String(), formatSpecifier) {
+			pieces = append(pieces, p)
+		}
+		current.Reset()
+	}
+	opaque := func(text string) {
+		flush()
+		pieces = append(pieces, placeholder.Piece{Text: text, Opaque: true})
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"':
+			opaque(`"`)
+
+		case text[i] != '\\' || i+1 == len(text):
+			current.WriteByte(text[i])
+
+		case text[i+1] == 'n' || text[i+1] == 't':
+			opaque(text[i : i+2])
+			i++
+
+		case text[i+1] == 'u' && i+6 <= len(text):
+			opaque(text[i : i+6])
+			i += 5
+
+		default:
+			current.WriteByte(text[i+1])
+			i++
+		}
+	}
+	flush()
+
+	return pieces
+}
+
+// translateValue translates the pieces of a value, and escapes a leading @ or ?, which would make it a reference
+func (a *android) translateValue(pieces []placeholder.Piece) (string, error) {
+	value, err := translatePieces(pieces, a.translate, escapeAndroid)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(value, "@") || strings.HasPrefix(value, "?") {
+		value = `\` + value
+	}
+
+	return value, nil
+}
+
+// translatePlurals translates the items of the current plurals element, with an item for each plural category of
+// the target language. Categories the source does not have are translated from its other item.
+func (a *android) translatePlurals() error {
+	items := make(map[string][]placeholder.Piece)
+	var first, last int
+	var indentation, fallback string
+
+	for {
+		start := int(a.decoder.InputOffset())
+		token, err := a.decoder.Token()
+		if err != nil {
+			return a.syntaxError(err)
+		}
+		end := int(a.decoder.InputOffset())
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local != "item" {
+				if err := a.skipElement(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			pieces, _, err := a.readValue(end)
+			if err != nil {
+				return err
+			}
+
+			quantity := attribute(token, "quantity")
+			if len(items) == 0 {
+				first = start
+				indentation = lineIndentation(a.document[:start])
+				fallback = quantity
+			}
+			items[quantity] = pieces
+			last = int(a.decoder.InputOffset())
+
+		case xml.EndElement:
+			if len(items) == 0 {
+				return nil
+			}
+			if _, ok := items["other"]; ok {
+				fallback = "other"
+			}
+			return a.writePlurals(first, last, indentation, items, fallback)
+		}
+	}
+}
+
+// writePlurals adds a splice replacing the items of plurals between start and end
+func (a *android) writePlurals(start, end int, indentation string, items map[string][]placeholder.Piece, fallback string) error {
+	var result strings.Builder
+	for i, category := range messageformat.PluralCategories(a.targetLang, false) {
+		pieces, ok := items[category]
+		if !ok {
+			pieces = items[fallback]
+		}
+
+		value, err := a.translateValue(pieces)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			result.WriteString(indentation)
+		}
+		result.WriteString(`<item quantity="` + category + `">` + value + "</item>")
+	}
+
+	a.splices = append(a.splices, placeholder.Splice{Start: start, End: end, Text: result.String()})
+	return nil
+}
+
+// attribute returns the value of an attribute, or an empty string
+func attribute(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// lineIndentation returns the line break and whitespace at the end of text, or a space if text does not end in a
+// line of whitespace
+func lineIndentation(text string) string {
+	trimmed := strings.TrimRight(text, " \t")
+	if !strings.HasSuffix(trimmed, "\n") {
+		return " "
+	}
+	return "\n" + text[len(trimmed):]
+}
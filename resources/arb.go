@@ -0,0 +1,123 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kuboschek/translate-server/messageformat"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"io"
+	"strings"
+)
+
+// TranslateARB translates the messages of a Flutter ARB file, which are ICU messages, and sets its @@locale to the
+// target language. Plural cases are adapted to the target language. Metadata, like the @ attributes of messages, is
+// kept as it is, as is the formatting of the file.
+func TranslateARB(document string, targetLang language.Tag, translate func(string) (string, error)) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return "", arbError(err)
+	}
+	if token != json.Delim('{') {
+		return "", &SyntaxError{Format: "ARB", Message: "not a JSON object"}
+	}
+	objectStart := int(decoder.InputOffset())
+
+	locale, err := quoteJSON(strings.Replace(targetLang.String(), "-", "_", -1))
+	if err != nil {
+		return "", err
+	}
+
+	var splices []placeholder.Splice
+	hasLocale := false
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", arbError(err)
+		}
+		key, _ := token.(string)
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return "", arbError(err)
+		}
+		end := int(decoder.InputOffset())
+		start := end - len(raw)
+
+		switch {
+		case key == "@@locale":
+			hasLocale = true
+			splices = append(splices, placeholder.Splice{Start: start, End: end, Text: locale})
+
+		case strings.HasPrefix(key, "@"):
+			continue
+
+		default:
+			translated, err := translateARBMessage(key, raw, targetLang, translate)
+			if err != nil {
+				return "", err
+			}
+			splices = append(splices, placeholder.Splice{Start: start, End: end, Text: translated})
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return "", arbError(err)
+	}
+
+	// A missing locale is added before the first key, with its indentation
+	if !hasLocale {
+		firstKey := strings.Index(document[objectStart:], `"`)
+		if firstKey < 0 {
+			splices = append(splices, placeholder.Splice{Start: objectStart, End: objectStart, Text: `"@@locale": ` + locale})
+		} else {
+			firstKey += objectStart
+			space := document[objectStart:firstKey]
+			splices = append(splices, placeholder.Splice{Start: firstKey, End: firstKey, Text: `"@@locale": ` + locale + "," + space})
+		}
+	}
+
+	return placeholder.Apply(document, splices), nil
+}
+
+// translateARBMessage translates a message of an ARB file, and returns it as JSON
+func translateARBMessage(key string, raw json.RawMessage, targetLang language.Tag, translate func(string) (string, error)) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return "", &SyntaxError{Format: "ARB", Message: "message " + key + " is not a string"}
+	}
+
+	message, err := messageformat.Parse(text)
+	if err != nil {
+		return "", &SyntaxError{Format: "ARB", Message: "message " + key + ": " + err.Error()}
+	}
+
+	translated, err := messageformat.TranslateTo(message, targetLang, translate)
+	if err != nil {
+		return "", err
+	}
+
+	return quoteJSON(translated)
+}
+
+// quoteJSON returns a string as JSON, without escaping HTML characters
+func quoteJSON(text string) (string, error) {
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(text); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(quoted.String(), "\n"), nil
+}
+
+// arbError returns errors of the JSON decoder as syntax errors
+func arbError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &SyntaxError{Format: "ARB", Message: err.Error()}
+}
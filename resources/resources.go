@@ -0,0 +1,53 @@
+// Package resources translates the string resources of mobile apps: Android strings.xml, iOS .strings and
+// .stringsdict, and Flutter ARB files. Values are translated with their format specifiers kept, and plurals get the
+// forms of the target language.
+package resources
+
+import (
+	"github.com/kuboschek/translate-server/placeholder"
+	"regexp"
+	"strings"
+)
+
+// formatSpecifier matches printf format specifiers as used on Android and iOS, like %s, %1$s, %@, %.2f or %#@files@.
+// Spaces are not taken as flags, as "100% of" would be a specifier otherwise.
+var formatSpecifier = regexp.MustCompile(`%#@\w+@|%(?:\d+\$)?[-+#0']*(?:\d+|\*)?(?:\.(?:\d+|\*))?(?:hh|h|ll|l|q|z|t|j|L)?[@dDiuUxXoOfFeEgGcCsSpaA%]`)
+
+// SyntaxError describes a file that cannot be parsed.
+type SyntaxError struct {
+	Format  string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return "resources: invalid " + e.Format + ": " + e.Message
+}
+
+// translateValue translates a value, keeping its format specifiers
+func translateValue(value string, translate func(string) (string, error)) (string, error) {
+	translated, err := placeholder.Translate(placeholder.Split(value, formatSpecifier), translate)
+	if err != nil {
+		return "", err
+	}
+
+	return placeholder.Join(translated), nil
+}
+
+// translatePieces translates the pieces of a value, and writes their text with escape
+func translatePieces(pieces []placeholder.Piece, translate func(string) (string, error), escape func(string) string) (string, error) {
+	translated, err := placeholder.TranslatePaired(pieces, translate)
+	if err != nil {
+		return "", err
+	}
+
+	var value strings.Builder
+	for _, p := range translated {
+		if p.Opaque {
+			value.WriteString(p.Text)
+		} else {
+			value.WriteString(escape(p.Text))
+		}
+	}
+
+	return value.String(), nil
+}
@@ -0,0 +1,186 @@
+package resources
+
+import (
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func checkContains(t *testing.T, translated string, wants ...string) {
+	for _, want := range wants {
+		if !strings.Contains(translated, want) {
+			t.Errorf("translated file should contain %q: got\n%v", want, translated)
+		}
+	}
+}
+
+func TestTranslateValue(t *testing.T) {
+	cases := []struct {
+		value, want string
+	}{
+		{"%1$d of %2$s", "%1$d OF %2$s"},
+		{"100% of users", "100% OF USERS"},
+		{"50% off %@", "50% OFF %@"},
+		{"100%% sure", "100%% SURE"},
+	}
+
+	for _, c := range cases {
+		translated, err := translateValue(c.value, upper)
+		if err != nil || translated != c.want {
+			t.Errorf("translateValue should keep the format specifiers of %q: got %q want %q (%v)", c.value, translated, c.want, err)
+		}
+	}
+}
+
+func TestTranslateAndroid(t *testing.T) {
+	translated, err := TranslateAndroid(readFile(t, "testdata/strings.xml"), language.Russian, upper)
+	if err != nil {
+		t.Fatalf("TranslateAndroid returned error when it shouldn't have: %v", err)
+	}
+
+	checkContains(t, translated,
+		"    <!-- Shown on the start screen -->\n",
+		`<string name="welcome">WELCOME, %1$s!</string>`,
+		`<string name="terms">READ THE <b>TERMS</b> &amp; CONDITIONS</string>`,
+		`<string name="apostrophe">DON\'T FORGET TO SAVE\nYOUR WORK</string>`,
+		`<string name="download">DOWNLOADING <xliff:g id="file" example="photo.jpg">%s</xliff:g> NOW</string>`,
+		`<string name="html"><![CDATA[TAP <i>HERE</i>]]></string>`,
+		"        <item>MERCURY</item>\n        <item>VENUS</item>\n",
+		"    <plurals name=\"songs\">\n"+
+			"        <item quantity=\"one\">%d SONG FOUND</item>\n"+
+			"        <item quantity=\"few\">%d SONGS FOUND</item>\n"+
+			"        <item quantity=\"many\">%d SONGS FOUND</item>\n"+
+			"        <item quantity=\"other\">%d SONGS FOUND</item>\n"+
+			"    </plurals>",
+	)
+
+	if strings.Contains(translated, "app_name") {
+		t.Errorf("TranslateAndroid should remove strings that are not translatable: got\n%v", translated)
+	}
+	if !strings.HasPrefix(translated, "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<resources xmlns:xliff=") {
+		t.Errorf("TranslateAndroid should keep the rest of the file: got\n%v", translated)
+	}
+}
+
+func TestTranslateAndroid_Escaping(t *testing.T) {
+	translate := func(string) (string, error) {
+		return `@"Tom's" <b>`, nil
+	}
+
+	translated, err := TranslateAndroid(`<resources><string name="a">x</string></resources>`, language.German, translate)
+	if err != nil {
+		t.Fatalf("TranslateAndroid returned error when it shouldn't have: %v", err)
+	}
+
+	if want := `<resources><string name="a">\@\"Tom\'s\" &lt;b&gt;</string></resources>`; translated != want {
+		t.Errorf("TranslateAndroid should escape translations: got %q want %q", translated, want)
+	}
+}
+
+func TestTranslateStrings(t *testing.T) {
+	document := readFile(t, "testdata/Localizable.strings")
+
+	translated, err := TranslateStrings(document, upper)
+	if err != nil {
+		t.Fatalf("TranslateStrings returned error when it shouldn't have: %v", err)
+	}
+
+	want := strings.NewReplacer(
+		`"Welcome, %@!"`, `"WELCOME, %@!"`,
+		`"Loading \"%1$@\"\nPlease wait"`, `"LOADING \"%1$@\"\nPLEASE WAIT"`,
+		`"Hello"`, `"HELLO"`,
+	).Replace(document)
+	if translated != want {
+		t.Errorf("TranslateStrings should translate values only: got\n%v\nwant\n%v", translated, want)
+	}
+
+	// Files in UTF-16 are written back in UTF-16
+	encoding := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	utf16, _ := encoding.NewEncoder().String(document)
+	translated, err = TranslateStrings(utf16, upper)
+	if err != nil {
+		t.Fatalf("TranslateStrings returned error when it shouldn't have: %v", err)
+	}
+	if decoded, _ := encoding.NewDecoder().String(translated); decoded != want || !strings.HasPrefix(translated, "\xFF\xFE") {
+		t.Errorf("TranslateStrings should keep UTF-16: got %q", decoded)
+	}
+}
+
+func TestTranslateStrings_Invalid(t *testing.T) {
+	for _, document := range []string{
+		`"key" = "value"`,
+		`"key" "value";`,
+		`"key" = "value;`,
+		`/* comment`,
+	} {
+		_, err := TranslateStrings(document, upper)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("TranslateStrings should return a syntax error for %q: got %v", document, err)
+		}
+	}
+}
+
+func TestTranslateStringsdict(t *testing.T) {
+	translated, err := TranslateStringsdict(readFile(t, "testdata/Localizable.stringsdict"), language.Russian, upper)
+	if err != nil {
+		t.Fatalf("TranslateStringsdict returned error when it shouldn't have: %v", err)
+	}
+
+	checkContains(t, translated,
+		"<key>files selected</key>",
+		"<string>%#@files@ SELECTED</string>",
+		"<string>NSStringPluralRuleType</string>",
+		"\t\t\t<key>zero</key>\n\t\t\t<string>NO FILES</string>\n"+
+			"\t\t\t<key>one</key>\n\t\t\t<string>%d FILE</string>\n"+
+			"\t\t\t<key>few</key>\n\t\t\t<string>%d FILES</string>\n"+
+			"\t\t\t<key>many</key>\n\t\t\t<string>%d FILES</string>\n"+
+			"\t\t\t<key>other</key>\n\t\t\t<string>%d FILES</string>\n"+
+			"\t\t</dict>",
+	)
+}
+
+func TestTranslateARB(t *testing.T) {
+	translated, err := TranslateARB(readFile(t, "testdata/app_en.arb"), language.MustParse("pt-BR"), upper)
+	if err != nil {
+		t.Fatalf("TranslateARB returned error when it shouldn't have: %v", err)
+	}
+
+	checkContains(t, translated,
+		`"@@locale": "pt_BR",`,
+		`"title": "HELLO & <B>WORLD</B>",`,
+		`"description": "The title of the start page"`,
+		`"unread": "{count, plural, =0 {NO MESSAGES} one {ONE MESSAGE} other {{count} MESSAGES}}",`,
+	)
+
+	// A missing locale is added
+	translated, err = TranslateARB("{\n  \"title\": \"Hello\"\n}", language.German, upper)
+	if err != nil {
+		t.Fatalf("TranslateARB returned error when it shouldn't have: %v", err)
+	}
+	if want := "{\n  \"@@locale\": \"de\",\n  \"title\": \"HELLO\"\n}"; translated != want {
+		t.Errorf("TranslateARB should add the locale: got %q want %q", translated, want)
+	}
+
+	for _, document := range []string{`[]`, `{"title": 1}`, `{"title": "{count, plural"}`, `{"title": "x"`} {
+		if _, err := TranslateARB(document, language.German, upper); err == nil {
+			t.Errorf("TranslateARB should fail for %q", document)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("TranslateARB should return a syntax error for %q: got %v", document, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package resources
+
+import (
+	"fmt"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+)
+
+// stringsEscaper escapes text for a quoted string of a .strings file
+var stringsEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+func escapeStrings(text string) string {
+	return stringsEscaper.Replace(text)
+}
+
+// TranslateStrings translates the values of an iOS or macOS .strings file. Keys and comments are kept as they are.
+// Files in UTF-16 with a byte order mark, as Xcode used to write them, are written back in the same encoding.
+func TranslateStrings(document string, translate func(string) (string, error)) (string, error) {
+	encoding := stringsEncoding(document)
+	if encoding != nil {
+		decoded, err := encoding.NewDecoder().String(document)
+		if err != nil {
+			return "", &SyntaxError{Format: ".strings", Message: err.Error()}
+		}
+		document = decoded
+	}
+
+	// A byte order mark of UTF-8 is kept as it is
+	s := &stringsScanner{document: document}
+	if strings.HasPrefix(document, "\uFEFF") {
+		s.offset = len("\uFEFF")
+	}
+	values, err := s.values()
+	if err != nil {
+		return "", err
+	}
+
+	var splices []placeholder.Splice
+	for _, value := range values {
+		translated, err := translatePieces(unescapeStrings(document[value[0]:value[1]]), translate, escapeStrings)
+		if err != nil {
+			return "", err
+		}
+		splices = append(splices, placeholder.Splice{Start: value[0], End: value[1], Text: translated})
+	}
+
+	translated := placeholder.Apply(document, splices)
+	if encoding == nil {
+		return translated, nil
+	}
+
+	return encoding.NewEncoder().String(translated)
+}
+
+// stringsEncoding returns the UTF-16 encoding of a document with a UTF-16 byte order mark, or nil for UTF-8
+func stringsEncoding(document string) encoding.Encoding {
+	switch {
+	case strings.HasPrefix(document, "\xFF\xFE"):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case strings.HasPrefix(document, "\xFE\xFF"):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+	return nil
+}
+
+// unescapeStrings splits a quoted string into pieces. Escaped quotes and backslashes are unescaped, while other
+// escape sequences, like \n or \U00A0, are kept as opaque pieces, as are format specifiers.
+func unescapeStrings(text string) []placeholder.Piece {
+	var pieces []placeholder.Piece
+	var current strings.Builder
+
+	flush := func() {
+		for _, p := range placeholder.Split(current.String(), formatSpecifier) {
+			pieces = append(pieces, p)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] != '\\' || i+1 == len(text):
+			current.WriteByte(text[i])
+
+		case text[i+1] == '"' || text[i+1] == '\\':
+			current.WriteByte(text[i+1])
+			i++
+
+		default:
+			length := 2
+			if (text[i+1] == 'U' || text[i+1] == 'u') && i+6 <= len(text) {
+				length = 6
+			}
+			flush()
+			pieces = append(pieces, placeholder.Piece{Text: text[i : i+length], Opaque: true})
+			i += length - 1
+		}
+	}
+	flush()
+
+	return pieces
+}
+
+// stringsScanner reads the "key" = "value"; pairs of a .strings file
+type stringsScanner struct {
+	document string
+	offset   int
+}
+
+func (s *stringsScanner) errorf(format string, args ...interface{}) error {
+	line := strings.Count(s.document[:s.offset], "\n") + 1
+	return &SyntaxError{Format: ".strings", Message: fmt.Sprintf("line %d: ", line) + fmt.Sprintf(format, args...)}
+}
+
+// values returns the ranges of the quoted values in the document, without their quotes
+func (s *stringsScanner) values() ([][2]int, error) {
+	var values [][2]int
+
+	for {
+		if err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		if s.offset == len(s.document) {
+			return values, nil
+		}
+
+		if _, err := s.string(); err != nil {
+			return nil, err
+		}
+		if err := s.expect('='); err != nil {
+			return nil, err
+		}
+		if err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		if s.offset == len(s.document) || s.document[s.offset] != '"' {
+			return nil, s.errorf("expected a quoted value")
+		}
+		value, err := s.string()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.expect(';'); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+}
+
+// skipSpace skips whitespace and comments
+func (s *stringsScanner) skipSpace() error {
+	for s.offset < len(s.document) {
+		rest := s.document[s.offset:]
+
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return s.errorf("unterminated comment")
+			}
+			s.offset += end + 4
+
+		case strings.HasPrefix(rest, "//"):
+			end := strings.Index(rest, "\n")
+			if end < 0 {
+				end = len(rest)
+			}
+			s.offset += end
+
+		case strings.TrimLeft(rest[:1], " \t\r\n") == "":
+			s.offset++
+
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// expect skips whitespace and the given character
+func (s *stringsScanner) expect(c byte) error {
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if s.offset == len(s.document) || s.document[s.offset] != c {
+		return s.errorf("expected %q", c)
+	}
+	s.offset++
+	return nil
+}
+
+// string reads a quoted string, or an unquoted word as keys may be, and returns the range of its text
+func (s *stringsScanner) string() ([2]int, error) {
+	if s.document[s.offset] != '"' {
+		start := s.offset
+		for s.offset < len(s.document) && !strings.ContainsAny(s.document[s.offset:s.offset+1], " \t\r\n=;\"") {
+			s.offset++
+		}
+		if start == s.offset {
+			return [2]int{}, s.errorf("expected a key")
+		}
+		return [2]int{start, s.offset}, nil
+	}
+
+	start := s.offset + 1
+	for i := start; i < len(s.document); i++ {
+		switch s.document[i] {
+		case '\\':
+			i++
+		case '"':
+			s.offset = i + 1
+			return [2]int{start, i}, nil
+		}
+	}
+
+	return [2]int{}, s.errorf("unterminated string")
+}
@@ -0,0 +1,294 @@
+package resources
+
+import (
+	"encoding/xml"
+	"github.com/kuboschek/translate-server/messageformat"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"io"
+	"strings"
+)
+
+// plistEntry is a key of a property list dictionary with its value
+type plistEntry struct {
+	key string
+
+	// start and end are the range of the key and its value
+	start, end int
+
+	// text is the range of the text of string values
+	text *[2]int
+	dict []plistEntry
+}
+
+// lookup returns the entry with a key, or nil
+func lookup(dict []plistEntry, key string) *plistEntry {
+	for i := range dict {
+		if dict[i].key == key {
+			return &dict[i]
+		}
+	}
+	return nil
+}
+
+// stringsdict holds the state of translating one .stringsdict file
+type stringsdict struct {
+	document   string
+	decoder    *xml.Decoder
+	translate  func(string) (string, error)
+	targetLang language.Tag
+	splices    []placeholder.Splice
+}
+
+// TranslateStringsdict translates the plural rules of an iOS or macOS .stringsdict file. The format keys are
+// translated with their variables kept, and each plural rule gets the categories of the target language. A zero case
+// of the source is kept, as it is used for zero in every language.
+func TranslateStringsdict(document string, targetLang language.Tag, translate func(string) (string, error)) (string, error) {
+	s := &stringsdict{
+		document:   document,
+		decoder:    xml.NewDecoder(strings.NewReader(document)),
+		translate:  translate,
+		targetLang: targetLang,
+	}
+
+	root, err := s.readRoot()
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range root {
+		for _, variable := range entry.dict {
+			if err := s.translateEntry(variable); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return placeholder.Apply(document, s.splices), nil
+}
+
+// syntaxError returns errors of the XML decoder as syntax errors
+func (s *stringsdict) syntaxError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &SyntaxError{Format: ".stringsdict", Message: err.Error()}
+}
+
+// readRoot reads the dictionary of the property list
+func (s *stringsdict) readRoot() ([]plistEntry, error) {
+	for {
+		token, err := s.decoder.Token()
+		if err == io.EOF {
+			return nil, &SyntaxError{Format: ".stringsdict", Message: "no dictionary"}
+		}
+		if err != nil {
+			return nil, s.syntaxError(err)
+		}
+
+		if element, ok := token.(xml.StartElement); ok && element.Name.Local == "dict" {
+			return s.readDict()
+		}
+	}
+}
+
+// readDict reads the entries of the current dictionary
+func (s *stringsdict) readDict() ([]plistEntry, error) {
+	var entries []plistEntry
+	var current *plistEntry
+
+	for {
+		start := int(s.decoder.InputOffset())
+		token, err := s.decoder.Token()
+		if err != nil {
+			return nil, s.syntaxError(err)
+		}
+		end := int(s.decoder.InputOffset())
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local == "key" {
+				text, err := s.readText(end)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, plistEntry{key: s.document[text[0]:text[1]], start: start})
+				current = &entries[len(entries)-1]
+				continue
+			}
+			if current == nil {
+				return nil, &SyntaxError{Format: ".stringsdict", Message: "value without a key"}
+			}
+
+			switch token.Name.Local {
+			case "dict":
+				dict, err := s.readDict()
+				if err != nil {
+					return nil, err
+				}
+				current.dict = dict
+			case "string":
+				text, err := s.readText(end)
+				if err != nil {
+					return nil, err
+				}
+				current.text = &text
+			default:
+				if err := s.skipElement(); err != nil {
+					return nil, err
+				}
+			}
+			current.end = int(s.decoder.InputOffset())
+			current = nil
+
+		case xml.EndElement:
+			return entries, nil
+		}
+	}
+}
+
+// readText reads the text of the current element, which starts at offset, and returns its range
+func (s *stringsdict) readText(offset int) ([2]int, error) {
+	for {
+		start := int(s.decoder.InputOffset())
+		token, err := s.decoder.Token()
+		if err != nil {
+			return [2]int{}, s.syntaxError(err)
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			return [2]int{}, &SyntaxError{Format: ".stringsdict", Message: "element in a string"}
+		case xml.EndElement:
+			return [2]int{offset, start}, nil
+		}
+	}
+}
+
+// skipElement skips the content of the current element
+func (s *stringsdict) skipElement() error {
+	for depth := 1; depth > 0; {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return s.syntaxError(err)
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// text returns the unescaped text of a string value
+func (s *stringsdict) text(entry *plistEntry) string {
+	var text strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader("<string>" + s.document[entry.text[0]:entry.text[1]] + "</string>"))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return text.String()
+		}
+		if data, ok := token.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+}
+
+// translateString translates the text of a string value
+func (s *stringsdict) translateString(entry *plistEntry) (string, error) {
+	translated, err := translateValue(s.text(entry), s.translate)
+	if err != nil {
+		return "", err
+	}
+	return xmlEscaper.Replace(translated), nil
+}
+
+// translateEntry translates an entry of a localized string, which is its format key or the plural rule of a variable
+func (s *stringsdict) translateEntry(entry plistEntry) error {
+	if entry.key == "NSStringLocalizedFormatKey" && entry.text != nil {
+		translated, err := s.translateString(&entry)
+		if err != nil {
+			return err
+		}
+		s.splices = append(s.splices, placeholder.Splice{Start: entry.text[0], End: entry.text[1], Text: translated})
+		return nil
+	}
+
+	specType := lookup(entry.dict, "NSStringFormatSpecTypeKey")
+	if specType == nil || specType.text == nil || s.text(specType) != "NSStringPluralRuleType" {
+		return nil
+	}
+
+	return s.translatePlural(entry.dict)
+}
+
+// translatePlural replaces the cases of a plural rule by those of the target language
+func (s *stringsdict) translatePlural(rule []plistEntry) error {
+	var first, last *plistEntry
+	cases := make(map[string]*plistEntry)
+	for i := range rule {
+		if rule[i].text != nil && categoryKey(rule[i].key) {
+			if first == nil {
+				first = &rule[i]
+			}
+			last = &rule[i]
+			cases[rule[i].key] = &rule[i]
+		}
+	}
+	if first == nil {
+		return nil
+	}
+
+	fallback, ok := cases["other"]
+	if !ok {
+		fallback = first
+	}
+
+	categories := messageformat.PluralCategories(s.targetLang, false)
+	if _, ok := cases["zero"]; ok && categories[0] != "zero" {
+		categories = append([]string{"zero"}, categories...)
+	}
+
+	// Cases are written with the indentation of the source
+	indentation := lineIndentation(s.document[:first.start])
+	valueStart := strings.Index(s.document[first.start:first.end], "<string")
+	separator := s.document[first.start : first.start+valueStart]
+	separator = separator[strings.Index(separator, "</key>")+len("</key>"):]
+
+	var result strings.Builder
+	for i, category := range categories {
+		entry, ok := cases[category]
+		if !ok {
+			entry = fallback
+		}
+
+		translated, err := s.translateString(entry)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			result.WriteString(indentation)
+		}
+		result.WriteString("<key>" + category + "</key>" + separator + "<string>" + translated + "</string>")
+	}
+
+	s.splices = append(s.splices, placeholder.Splice{Start: first.start, End: last.end, Text: result.String()})
+	return nil
+}
+
+// categoryKey returns true for the keys of plural cases
+func categoryKey(key string) bool {
+	switch key {
+	case "zero", "one", "two", "few", "many", "other":
+		return true
+	}
+	return false
+}
+
+// xmlEscaper escapes the text of an element, keeping line breaks and quotes as they are
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
@@ -0,0 +1,185 @@
+// Package segment splits text into sentences, so long texts can be translated and cached a sentence at a time.
+package segment
+
+import (
+	"golang.org/x/text/language"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Segment is a sentence, and the whitespace following it.
+type Segment struct {
+	Text  string
+	Space string
+}
+
+// abbreviations end with a period but rarely end a sentence, by language. They are matched in lower case.
+var abbreviations = map[language.Base][]string{
+	base("en"): {"mr.", "mrs.", "ms.", "dr.", "prof.", "sr.", "jr.", "st.", "vs.", "etc.", "e.g.", "i.e.", "inc.", "ltd.",
+		"co.", "corp.", "no.", "approx.", "dept.", "fig.", "jan.", "feb.", "mar.", "apr.", "jun.", "jul.", "aug.", "sep.",
+		"sept.", "oct.", "nov.", "dec."},
+	base("de"): {"z.b.", "z. b.", "d.h.", "u.a.", "usw.", "bzw.", "ca.", "vgl.", "nr.", "dr.", "prof.", "hr.", "fr.",
+		"str.", "s.", "evtl.", "ggf.", "inkl.", "zzgl.", "bspw.", "jan.", "feb.", "okt.", "dez."},
+	base("fr"): {"m.", "mme.", "mlle.", "dr.", "p.ex.", "etc.", "cf.", "env.", "av.", "bd.", "no."},
+	base("es"): {"sr.", "sra.", "srta.", "dr.", "dra.", "ud.", "uds.", "etc.", "p.ej.", "núm.", "pág.", "av."},
+	base("it"): {"sig.", "sig.ra", "dott.", "prof.", "ecc.", "es.", "pag.", "n."},
+	base("nl"): {"dhr.", "mevr.", "dr.", "bijv.", "o.a.", "enz.", "d.w.z.", "nr.", "blz."},
+	base("pt"): {"sr.", "sra.", "dr.", "dra.", "etc.", "p.ex.", "pág.", "n.º", "av."},
+	base("ru"): {"т.е.", "т.д.", "т.п.", "др.", "г.", "гг.", "стр.", "им.", "ул.", "д."},
+}
+
+// ordinalLanguages write ordinal numbers with a period, as in "am 3. März"
+var ordinalLanguages = map[language.Base]bool{
+	base("de"): true, base("da"): true, base("nb"): true, base("no"): true, base("fi"): true, base("cs"): true,
+	base("sk"): true, base("pl"): true, base("hu"): true, base("sl"): true, base("hr"): true, base("sr"): true,
+	base("et"): true, base("lv"): true, base("is"): true, base("tr"): true,
+}
+
+// spacelessLanguages do not separate sentences on the same line with spaces
+var spacelessLanguages = map[language.Base]bool{
+	base("ja"): true, base("zh"): true, base("yue"): true,
+}
+
+func base(lang string) language.Base {
+	b, _ := language.MustParse(lang).Base()
+	return b
+}
+
+// closing are characters that may follow the end of a sentence, like quotes and brackets
+func closing(r rune) bool {
+	return unicode.In(r, unicode.Pe, unicode.Pf, unicode.Quotation_Mark)
+}
+
+// spaceless returns true for sentence terminators that need no space after them, as in Chinese and Japanese
+func spaceless(r rune) bool {
+	return r == '。' || r == '！' || r == '？' || r == '｡'
+}
+
+// Split splits a text into sentences, using the rules of the given language. Paragraphs and lines always end a
+// sentence. Joining the segments returns the text; text before the first sentence is whitespace in a segment
+// without text.
+func Split(text string, lang language.Tag) []Segment {
+	langBase, _ := lang.Base()
+	rules := rules{abbreviations: abbreviations[langBase], ordinals: ordinalLanguages[langBase]}
+
+	var segments []Segment
+
+	leading := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+	if leading > 0 {
+		segments = append(segments, Segment{Space: text[:leading]})
+	}
+
+	start := leading
+	for i := leading; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		end := i + size
+
+		switch {
+		case r == '\n':
+			end = start + len(strings.TrimRightFunc(text[start:i], unicode.IsSpace))
+
+		case unicode.Is(unicode.STerm, r):
+			// Runs of terminators and closing quotes or brackets belong to the sentence
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if !unicode.Is(unicode.STerm, next) && !closing(next) {
+					break
+				}
+				end += nextSize
+			}
+
+			if !boundary(text, start, end, r, rules) {
+				i = end
+				continue
+			}
+
+		default:
+			i = end
+			continue
+		}
+
+		space := len(text[end:]) - len(strings.TrimLeftFunc(text[end:], unicode.IsSpace))
+		segments = append(segments, Segment{Text: text[start:end], Space: text[end : end+space]})
+		start = end + space
+		i = start
+	}
+
+	if start < len(text) {
+		segments = append(segments, Segment{Text: text[start:]})
+	}
+
+	return segments
+}
+
+// rules are the language-specific rules for periods
+type rules struct {
+	abbreviations []string
+	ordinals      bool
+}
+
+// boundary returns true if the sentence at text[start:end] ends there, with the terminator r
+func boundary(text string, start, end int, r rune, rules rules) bool {
+	next, _ := utf8.DecodeRuneInString(text[end:])
+	if end == len(text) || spaceless(r) {
+		return true
+	}
+	if !unicode.IsSpace(next) {
+		return false
+	}
+
+	if r != '.' {
+		return true
+	}
+
+	// Sentences continuing in lower case did not end, e.g. after an unknown abbreviation
+	following := strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	if first, _ := utf8.DecodeRuneInString(following); unicode.IsLower(first) {
+		return false
+	}
+
+	// Periods after abbreviations and initials, like "Dr." or "J.", do not end sentences
+	sentence := strings.ToLower(text[start:end])
+	for _, abbreviation := range rules.abbreviations {
+		if sentence == abbreviation || strings.HasSuffix(sentence, " "+abbreviation) ||
+			strings.HasSuffix(sentence, "("+abbreviation) {
+			return false
+		}
+	}
+
+	words := strings.Fields(text[start:end])
+	letters := strings.TrimSuffix(words[len(words)-1], ".")
+	if utf8.RuneCountInString(letters) == 1 && unicode.IsUpper([]rune(letters)[0]) {
+		return false
+	}
+
+	if rules.ordinals && strings.IndexFunc(letters, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return false
+	}
+
+	return true
+}
+
+// Join reassembles segments into the text they were split from.
+func Join(segments []Segment) string {
+	var text strings.Builder
+	for _, s := range segments {
+		text.WriteString(s.Text + s.Space)
+	}
+	return text.String()
+}
+
+// Respace adapts the whitespace between translated sentences to their language. Chinese and Japanese sentences on
+// the same line are not separated by spaces.
+func Respace(segments []Segment, lang language.Tag) {
+	langBase, _ := lang.Base()
+	if !spacelessLanguages[langBase] {
+		return
+	}
+
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i].Text != "" && !strings.ContainsAny(segments[i].Space, "\r\n") {
+			segments[i].Space = ""
+		}
+	}
+}
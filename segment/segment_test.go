@@ -0,0 +1,59 @@
+package segment
+
+import (
+	"golang.org/x/text/language"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		text string
+		lang language.Tag
+		want []string
+	}{
+		{"Hello world. How are you?  Fine!", language.English, []string{"Hello world.", "How are you?", "Fine!"}},
+		{"Dr. Smith met J. Doe at 5 p.m. today.", language.English, []string{"Dr. Smith met J. Doe at 5 p.m. today."}},
+		{"He said \"Stop.\" Then he left.", language.English, []string{"He said \"Stop.\"", "Then he left."}},
+		{"Das ist z.B. ein Haus. Es ist groß.", language.German, []string{"Das ist z.B. ein Haus.", "Es ist groß."}},
+		{"Er kommt am 3. März. Danach nicht.", language.German, []string{"Er kommt am 3. März.", "Danach nicht."}},
+		{"Version 1.2 is out. Get it now", language.English, []string{"Version 1.2 is out.", "Get it now"}},
+		{"Title\n\nFirst line  \nsecond line", language.English, []string{"Title", "First line", "second line"}},
+		{"今日は晴れです。明日は雨です。", language.Japanese, []string{"今日は晴れです。", "明日は雨です。"}},
+		{"Привет. Как дела?", language.Russian, []string{"Привет.", "Как дела?"}},
+		{"¿Qué tal? ¡Muy bien!", language.Spanish, []string{"¿Qué tal?", "¡Muy bien!"}},
+	}
+
+	for _, c := range cases {
+		var got []string
+		for _, s := range Split(c.text, c.lang) {
+			got = append(got, s.Text)
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Split should split %q into sentences: got %q want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	for _, text := range []string{"", "  \n Leading space. And trailing.\n\n", "One.\tTwo.\r\nThree"} {
+		if joined := Join(Split(text, language.English)); joined != text {
+			t.Errorf("Join should reassemble the text: got %q want %q", joined, text)
+		}
+	}
+}
+
+func TestRespace(t *testing.T) {
+	segments := []Segment{{Text: "Hello.", Space: " "}, {Text: "Bye.", Space: "\n"}, {Text: "Again."}}
+
+	Respace(segments, language.English)
+	if joined := Join(segments); joined != "Hello. Bye.\nAgain." {
+		t.Errorf("Respace should keep spaces in English: got %q", joined)
+	}
+
+	Respace(segments, language.Japanese)
+	if joined := Join(segments); joined != "Hello.Bye.\nAgain." {
+		t.Errorf("Respace should drop spaces between Japanese sentences: got %q", joined)
+	}
+}
@@ -0,0 +1,160 @@
+// Package subtitle reads, writes and translates SubRip (SRT) and WebVTT subtitles.
+package subtitle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// File is a subtitle file, a list of blocks separated by blank lines.
+type File struct {
+	Blocks []*Block
+
+	// VTT is set for WebVTT files, whose first block is the header
+	VTT bool
+
+	// newline is the line ending of the file, and bom its byte order mark, to write the file as it was read
+	newline string
+	bom     bool
+}
+
+// Block is a cue, or another block like the header, a NOTE or a STYLE block of WebVTT, which is kept as it is.
+type Block struct {
+	Cue bool
+
+	// ID is the identifier of a cue, its number in SRT files. Timing is the line with the times, and settings in WebVTT.
+	ID     string
+	Timing string
+
+	// Lines are the text of a cue, or the lines of other blocks
+	Lines []string
+}
+
+// SyntaxError describes an invalid block of a subtitle file.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("subtitle: line %d: %v", e.Line, e.Message)
+}
+
+// split returns the blocks of a document as lines, with the number of the first line of each block
+func split(document string, f *File) ([][]string, []int) {
+	if strings.HasPrefix(document, "\uFEFF") {
+		f.bom = true
+		document = strings.TrimPrefix(document, "\uFEFF")
+	}
+
+	f.newline = "\n"
+	if strings.Contains(document, "\r\n") {
+		f.newline = "\r\n"
+	}
+
+	var blocks [][]string
+	var numbers []int
+	var block []string
+
+	for i, line := range strings.Split(document, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+			block = nil
+			continue
+		}
+		if block == nil {
+			numbers = append(numbers, i+1)
+		}
+		block = append(block, line)
+	}
+	if block != nil {
+		blocks = append(blocks, block)
+	}
+
+	return blocks, numbers
+}
+
+// ParseSRT reads a SubRip file. Cue numbers are optional, as some tools leave them out.
+func ParseSRT(document string) (*File, error) {
+	f := &File{}
+
+	blocks, numbers := split(document, f)
+	for i, lines := range blocks {
+		cue := &Block{Cue: true}
+
+		if !strings.Contains(lines[0], "-->") {
+			cue.ID, lines = lines[0], lines[1:]
+		}
+		if len(lines) == 0 || !strings.Contains(lines[0], "-->") {
+			return nil, &SyntaxError{Line: numbers[i], Message: "cue without timing"}
+		}
+
+		cue.Timing, cue.Lines = lines[0], lines[1:]
+		f.Blocks = append(f.Blocks, cue)
+	}
+
+	return f, nil
+}
+
+// ParseVTT reads a WebVTT file.
+func ParseVTT(document string) (*File, error) {
+	f := &File{VTT: true}
+
+	blocks, numbers := split(document, f)
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], "WEBVTT") {
+		return nil, &SyntaxError{Line: 1, Message: "missing WEBVTT header"}
+	}
+
+	for i, lines := range blocks {
+		switch {
+		case i == 0, strings.HasPrefix(lines[0], "NOTE"), lines[0] == "STYLE", lines[0] == "REGION":
+			f.Blocks = append(f.Blocks, &Block{Lines: lines})
+			continue
+		}
+
+		cue := &Block{Cue: true}
+		if !strings.Contains(lines[0], "-->") {
+			cue.ID, lines = lines[0], lines[1:]
+		}
+		if len(lines) == 0 || !strings.Contains(lines[0], "-->") {
+			return nil, &SyntaxError{Line: numbers[i], Message: "cue without timing"}
+		}
+
+		cue.Timing, cue.Lines = lines[0], lines[1:]
+		f.Blocks = append(f.Blocks, cue)
+	}
+
+	return f, nil
+}
+
+// String returns the file with blocks separated by a blank line, in the line endings it was read with.
+func (f *File) String() string {
+	var result strings.Builder
+	if f.bom {
+		result.WriteString("\uFEFF")
+	}
+
+	for i, block := range f.Blocks {
+		if i > 0 {
+			result.WriteString(f.newline)
+		}
+
+		var lines []string
+		if block.Cue {
+			if block.ID != "" {
+				lines = append(lines, block.ID)
+			}
+			lines = append(lines, block.Timing)
+		}
+		lines = append(lines, block.Lines...)
+
+		for _, line := range lines {
+			result.WriteString(line + f.newline)
+		}
+	}
+
+	return result.String()
+}
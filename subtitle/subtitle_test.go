@@ -0,0 +1,170 @@
+package subtitle
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParse(t *testing.T) {
+	document := strings.Replace(readFile(t, "testdata/movie.srt"), "\n", "\r\n", -1)
+
+	f, err := ParseSRT(document)
+	if err != nil {
+		t.Fatalf("ParseSRT returned error when it shouldn't have: %v", err)
+	}
+	if len(f.Blocks) != 4 || f.Blocks[0].ID != "1" || f.Blocks[0].Timing != "00:00:01,000 --> 00:00:03,500" || len(f.Blocks[0].Lines) != 2 {
+		t.Errorf("ParseSRT should read cues: got %#v", f.Blocks[0])
+	}
+	if f.String() != document {
+		t.Errorf("String should write the file as it was read: got %q want %q", f.String(), document)
+	}
+
+	if _, err := ParseSRT("1\nHello\n"); err == nil {
+		t.Error("ParseSRT should fail for cues without timing")
+	}
+	if _, err := ParseVTT("00:01.000 --> 00:02.000\nHello\n"); err == nil {
+		t.Error("ParseVTT should fail for files without header")
+	}
+}
+
+func TestTranslateSRT(t *testing.T) {
+	f, err := ParseSRT(readFile(t, "testdata/movie.srt"))
+	if err != nil {
+		t.Fatalf("ParseSRT returned error when it shouldn't have: %v", err)
+	}
+
+	var phrases []string
+	translate := func(phrase string) (string, error) {
+		phrases = append(phrases, phrase)
+		return upper(phrase)
+	}
+
+	count, err := Translate(f, language.German, Options{}, translate)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	want := `1
+00:00:01,000 --> 00:00:03,500
+I NEVER THOUGHT
+WE WOULD MAKE IT
+
+2
+00:00:03,600 --> 00:00:05,000
+TO THE <i>COAST</i>.
+
+3
+00:00:06,000 --> 00:00:08,000
+- ARE YOU COMING?
+- YES!
+
+4
+00:00:09,000 --> 00:00:10,000
+{\an8}<font color="#ffff00">WHERE IS EVERYONE?</font>
+`
+	if f.String() != want {
+		t.Errorf("Translate should translate cue text, keeping timings and tags: got\n%v\nwant\n%v", f, want)
+	}
+	if count != 4 {
+		t.Errorf("Translate should count translated cues: got %d want 4", count)
+	}
+
+	// The sentence over the first two cues is translated as one
+	if len(phrases) != 3 || !strings.HasPrefix(phrases[0], "I never thought we would make it ") {
+		t.Errorf("Translate should translate sentences over several cues together: got %q", phrases)
+	}
+}
+
+func TestTranslate_LostBoundaries(t *testing.T) {
+	f, err := ParseSRT(readFile(t, "testdata/movie.srt"))
+	if err != nil {
+		t.Fatalf("ParseSRT returned error when it shouldn't have: %v", err)
+	}
+
+	// A service dropping placeholders leaves each cue, and the text between tags, to be translated on its own
+	placeholders := regexp.MustCompile(`⟦\d+⟧`)
+	translate := func(phrase string) (string, error) {
+		return upper(placeholders.ReplaceAllString(phrase, ""))
+	}
+
+	if _, err := Translate(f, language.German, Options{}, translate); err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	for _, want := range []string{"I NEVER THOUGHT\nWE WOULD MAKE IT\n", "TO THE <i>COAST</i>.\n"} {
+		if !strings.Contains(f.String(), want) {
+			t.Errorf("Translate should translate cues on their own: want %q in\n%v", want, f)
+		}
+	}
+}
+
+func TestTranslateVTT(t *testing.T) {
+	f, err := ParseVTT(readFile(t, "testdata/captions.vtt"))
+	if err != nil {
+		t.Fatalf("ParseVTT returned error when it shouldn't have: %v", err)
+	}
+
+	if _, err := Translate(f, language.German, Options{LineLength: 20}, upper); err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+
+	want := `WEBVTT
+Kind: captions
+
+NOTE Created by hand
+
+STYLE
+::cue { color: white }
+
+intro
+00:01.000 --> 00:03.000 align:start line:90%
+<v Anna>GOOD MORNING,
+<b>EVERYONE</b>.
+
+00:03.500 --> 00:05.000
+TOM &amp; JERRY SAY
+HELLO.
+`
+	if f.String() != want {
+		t.Errorf("Translate should translate cues and keep other blocks: got\n%v\nwant\n%v", f, want)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	cases := []struct {
+		text    string
+		width   int
+		noSpace bool
+		want    []string
+	}{
+		{"Wir haben es nie bis zur Küste geschafft", 16, false, []string{"Wir haben es nie", "bis zur Küste", "geschafft"}},
+		{"私たちは海岸に着くとは思わなかった。", 10, true, []string{"私たちは海岸に着くと", "は思わなかった。"}},
+		{"海岸に着いた。」", 7, true, []string{"海岸に着い", "た。」"}},
+		{"<i>Hallo</i> Welt", 5, false, []string{"<i>Hallo</i>", "Welt"}},
+		{"か\u3099か\u3099か\u3099", 2, true, []string{"か\u3099か\u3099", "か\u3099"}},
+		{"👩\u200d👧 สวัสดี ครับ", 8, false, []string{"👩\u200d👧 สวัสดี", "ครับ"}},
+	}
+
+	for _, c := range cases {
+		got := wrapper{noSpace: c.noSpace}.wrap(c.text, c.width)
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("wrap should wrap %q at %d: got %q want %q", c.text, c.width, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package subtitle
+
+import (
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxGroup is the largest number of cues translated together, so a sentence running over several cues is
+// translated as one
+const maxGroup = 5
+
+// tag matches styling tags like <i>, <font color="red"> or <c.yellow>, WebVTT timestamps and voices, ASS override
+// tags like {\an8}, and character references like &amp;
+var tag = regexp.MustCompile(`<[^<>]*>|\{\\[^{}]*\}|&(?:[a-zA-Z]+|#\d+);`)
+
+// pairedTags enclose text, like italics. Other tags, like the voice of WebVTT, which needs no end tag, are kept where
+// they are.
+var pairedTags = map[string]bool{"b": true, "i": true, "u": true, "font": true, "c": true, "span": true, "ruby": true, "rt": true, "lang": true}
+
+// sentenceEnd matches cue text ending a sentence, possibly followed by closing quotes, brackets or tags
+var sentenceEnd = regexp.MustCompile(`[.!?…。！？♪]["'”’»)\]]*(?:<[^<>]*>|\{\\[^{}]*\})*$`)
+
+// noSpaceLanguages are written without spaces between words, so their lines are wrapped between characters. Thai,
+// Lao, Khmer and Burmese are not, as breaking them between characters would split words; without a word segmenter,
+// their lines are wrapped at spaces.
+var noSpaceLanguages = map[string]bool{"ja": true, "zh": true, "yue": true}
+
+// piece is a part of the text of a cue
+type piece struct {
+	placeholder.Piece
+
+	// cue is the position in its group of the cue the piece belongs to. Boundaries start their cue.
+	cue      int
+	boundary bool
+}
+
+// Options change how translated cues are written.
+type Options struct {
+	// LineLength is the largest number of characters of a line. Without it, cues keep their number of lines.
+	LineLength int
+}
+
+// Translate translates the text of the cues of a file. Cues that continue a sentence are translated together with
+// it, so the sentence keeps its context, and its translation is divided between them. Timings and tags are kept.
+// It returns the number of translated cues.
+func Translate(f *File, targetLang language.Tag, options Options, translate func(string) (string, error)) (int, error) {
+	base, _ := targetLang.Base()
+	w := wrapper{width: options.LineLength, noSpace: noSpaceLanguages[base.String()]}
+	count := 0
+
+	var group []*Block
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+
+		texts, err := translateGroup(group, translate)
+		if err != nil {
+			return err
+		}
+		for i, cue := range group {
+			cue.Lines = w.lines(texts[i], cue.Lines)
+		}
+
+		count += len(group)
+		group = nil
+		return nil
+	}
+
+	for _, block := range f.Blocks {
+		if !block.Cue || len(block.Lines) == 0 {
+			continue
+		}
+
+		// Dialogue, with a line for each speaker, is not continued by other cues
+		if dialogue(block.Lines) && len(group) > 0 {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+
+		group = append(group, block)
+
+		text := strings.TrimSpace(block.Lines[len(block.Lines)-1])
+		if len(group) == maxGroup || dialogue(block.Lines) || sentenceEnd.MatchString(text) {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, flush()
+}
+
+// dialogue returns true for cues with a line for each speaker, which start with a dash
+func dialogue(lines []string) bool {
+	if len(lines) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "–") {
+			return false
+		}
+	}
+	return true
+}
+
+// cuePieces splits the text of a cue into pieces. Lines are joined with spaces, except those of dialogue, whose line
+// breaks are kept.
+func cuePieces(lines []string, cue int) []piece {
+	var pieces []piece
+
+	for i, line := range lines {
+		if i > 0 {
+			if dialogue(lines) {
+				pieces = append(pieces, piece{Piece: placeholder.Piece{Text: "\n", Opaque: true}, cue: cue})
+			} else {
+				pieces = append(pieces, piece{Piece: placeholder.Piece{Text: " "}, cue: cue})
+			}
+		}
+
+		for _, p := range placeholder.Split(line, tag) {
+			if p.Opaque {
+				p.Edge = tagEdge(p.Text)
+			}
+			pieces = append(pieces, piece{Piece: p, cue: cue})
+		}
+	}
+
+	return pieces
+}
+
+// tagEdge returns 1 for start tags of paired tags, -1 for their end tags, and 0 for everything else
+func tagEdge(raw string) int {
+	if !strings.HasPrefix(raw, "<") {
+		return 0
+	}
+
+	name := strings.TrimPrefix(strings.Trim(raw, "<>"), "/")
+	if end := strings.IndexAny(name, " .\t"); end >= 0 {
+		name = name[:end]
+	}
+	if !pairedTags[strings.ToLower(name)] {
+		return 0
+	}
+
+	if strings.HasPrefix(raw, "</") {
+		return -1
+	}
+	return 1
+}
+
+// translateGroup translates the cues of a group as one text, with their boundaries as placeholders. If the
+// translation moved boundaries or broke tags, each cue is translated on its own. It returns the text of each cue.
+func translateGroup(group []*Block, translate func(string) (string, error)) ([]string, error) {
+	var pieces []piece
+	for i, cue := range group {
+		if i > 0 {
+			pieces = append(pieces, piece{Piece: placeholder.Piece{Text: " "}, cue: i - 1})
+			pieces = append(pieces, piece{Piece: placeholder.Piece{Opaque: true}, cue: i, boundary: true})
+		}
+		pieces = append(pieces, cuePieces(cue.Lines, i)...)
+	}
+
+	if len(group) > 1 {
+		translated, err := placeholder.Translate(plain(pieces), translate)
+		if err == nil {
+			if texts, ok := divide(pieces, translated, len(group)); ok {
+				return texts, nil
+			}
+		}
+	}
+
+	texts := make([]string, len(group))
+	for i, cue := range group {
+		translated, err := placeholder.TranslatePaired(plain(cuePieces(cue.Lines, 0)), translate)
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = strings.TrimSpace(placeholder.Join(translated))
+	}
+
+	return texts, nil
+}
+
+// plain returns the placeholder pieces of pieces
+func plain(pieces []piece) []placeholder.Piece {
+	result := make([]placeholder.Piece, len(pieces))
+	for i, p := range pieces {
+		result[i] = p.Piece
+	}
+	return result
+}
+
+// divide divides the translation of a group between its cues, at the boundaries. It returns false if boundaries
+// moved, tags moved to another cue or lost their nesting, or a cue lost all its text.
+func divide(pieces []piece, translated []placeholder.Piece, cues int) ([]string, bool) {
+	texts := make([]strings.Builder, cues)
+	current, depth := 0, 0
+
+	for _, p := range translated {
+		if !p.Opaque {
+			texts[current].WriteString(p.Text)
+			continue
+		}
+
+		original := pieces[p.Index]
+		if original.boundary {
+			if original.cue != current+1 || depth != 0 {
+				return nil, false
+			}
+			current++
+			continue
+		}
+
+		depth += original.Edge
+		if original.cue != current || depth < 0 {
+			return nil, false
+		}
+		texts[current].WriteString(p.Text)
+	}
+	if current != cues-1 || depth != 0 {
+		return nil, false
+	}
+
+	result := make([]string, cues)
+	for i := range texts {
+		result[i] = strings.TrimSpace(texts[i].String())
+		if strings.IndexFunc(tag.ReplaceAllString(result[i], ""), unicode.IsLetter) < 0 {
+			return nil, false
+		}
+	}
+
+	return result, true
+}
+
+// wrapper divides the text of cues into lines
+type wrapper struct {
+	width   int
+	noSpace bool
+}
+
+// lines returns the lines of a translated cue. Dialogue keeps a line for each speaker. Other text is wrapped to the
+// line length if there is one, or else into as many lines as the source had.
+func (w wrapper) lines(text string, source []string) []string {
+	if dialogue(source) {
+		lines := strings.Split(text, "\n")
+		if w.width == 0 {
+			return lines
+		}
+
+		var wrapped []string
+		for _, line := range lines {
+			wrapped = append(wrapped, w.wrap(line, w.width)...)
+		}
+		return wrapped
+	}
+
+	if w.width > 0 {
+		return w.wrap(text, w.width)
+	}
+	if len(source) == 1 {
+		return []string{text}
+	}
+
+	// Lines are balanced, with the shortest width that needs no more lines than the source
+	for width := (visibleLength(text) + len(source) - 1) / len(source); ; width++ {
+		if lines := w.wrap(text, width); len(lines) <= len(source) {
+			return lines
+		}
+	}
+}
+
+// visibleLength returns the number of characters of text outside tags
+func visibleLength(text string) int {
+	text = tag.ReplaceAllString(text, "")
+
+	length := 0
+	for offset := 0; offset < len(text); offset += character(text[offset:]) {
+		length++
+	}
+	return length
+}
+
+// character returns the length in bytes of the first character of text, as seen by readers: a rune with the marks
+// combined with it, like accents or vowel signs, variation selectors and skin tones, or emoji joined into one.
+func character(text string) int {
+	_, end := utf8.DecodeRuneInString(text)
+
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me) || r >= 0x1F3FB && r <= 0x1F3FF:
+			end += size
+		case r == '\u200d' && end+size < len(text):
+			_, next := utf8.DecodeRuneInString(text[end+size:])
+			end += size + next
+		default:
+			return end
+		}
+	}
+
+	return end
+}
+
+// words splits text into the units lines may break between: words, or characters of languages written without
+// spaces. Tags stay with the text they are next to, and closing punctuation with the character before it.
+func (w wrapper) words(text string) []string {
+	if !w.noSpace {
+		var words []string
+		var word strings.Builder
+		inTag := false
+		for _, r := range text {
+			switch {
+			case r == '<' || r == '{':
+				inTag = true
+			case r == '>' || r == '}':
+				inTag = false
+			case r == ' ' && !inTag:
+				if word.Len() > 0 {
+					words = append(words, word.String())
+				}
+				word.Reset()
+				continue
+			}
+			word.WriteRune(r)
+		}
+		if word.Len() > 0 {
+			words = append(words, word.String())
+		}
+		return words
+	}
+
+	var words []string
+	prefix := ""
+	for offset := 0; offset < len(text); {
+		end := offset
+		if location := tag.FindStringIndex(text[offset:]); location != nil && location[0] == 0 {
+			end += location[1]
+		} else {
+			r, _ := utf8.DecodeRuneInString(text[offset:])
+			end += character(text[offset:])
+
+			// Words of scripts with spaces, like names, are kept together
+			for ascii(r) && end < len(text) {
+				next, size := utf8.DecodeRuneInString(text[end:])
+				if !ascii(next) {
+					break
+				}
+				end += size
+			}
+		}
+
+		token := text[offset:end]
+		offset = end
+		r, _ := utf8.DecodeRuneInString(token)
+
+		switch {
+		case len(words) > 0 && (strings.HasPrefix(token, "</") || closing(r)):
+			words[len(words)-1] += token
+		case tag.MatchString(token) && !strings.HasPrefix(token, "</"):
+			prefix += token
+		default:
+			words = append(words, prefix+token)
+			prefix = ""
+		}
+	}
+	if prefix != "" {
+		words = append(words, prefix)
+	}
+
+	return words
+}
+
+// ascii returns true for letters and digits of ASCII
+func ascii(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// closing returns true for punctuation that must not start a line, like 。 or 」
+func closing(r rune) bool {
+	return strings.ContainsRune("、。，．！？：；ー・", r) || unicode.Is(unicode.Pe, r) || unicode.Is(unicode.Pf, r)
+}
+
+// wrap divides text into lines of at most width characters, where it can
+func (w wrapper) wrap(text string, width int) []string {
+	separator := " "
+	if w.noSpace {
+		separator = ""
+	}
+
+	var lines []string
+	var line []string
+	length := 0
+
+	for _, word := range w.words(text) {
+		wordLength := visibleLength(word)
+		if len(line) > 0 && length+wordLength+len(separator) > width {
+			lines = append(lines, strings.TrimSpace(strings.Join(line, separator)))
+			line, length = nil, 0
+		}
+		if len(line) > 0 {
+			length += len(separator)
+		}
+		line = append(line, word)
+		length += wordLength
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.TrimSpace(strings.Join(line, separator)))
+	}
+
+	if len(lines) == 0 {
+		return []string{""}
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+package tmx
+
+import (
+	"github.com/kuboschek/translate-server/cache"
+	"github.com/kuboschek/translate-server/upstream"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+// ImportCache stores every translation of the document in a cache, and returns how many were stored.
+func ImportCache(document *Document, c cache.Cache) (int, error) {
+	entries := document.Entries()
+
+	for i, entry := range entries {
+		if err := c.Put(entry.Source, entry.TargetLang, entry.Target); err != nil {
+			return i, errors.Wrap(err, "failed to store translation in cache")
+		}
+	}
+
+	return len(entries), nil
+}
+
+// ImportMemory adds every translation of the document to a translation memory, and returns how many were added.
+func ImportMemory(document *Document, memory *upstream.TranslationMemory) int {
+	entries := document.Entries()
+
+	for _, entry := range entries {
+		memory.Add(entry)
+	}
+
+	return len(entries)
+}
+
+// ExportCache returns the contents of a cache as a document. Caches do not record the language translated from,
+// so all entries are assumed to have the given source language.
+func ExportCache(c cache.Cache, sourceLang language.Tag) (*Document, error) {
+	lister, ok := c.(cache.Lister)
+	if !ok {
+		return nil, errors.Errorf("cache %T cannot list its contents", c)
+	}
+
+	var entries []upstream.MemoryEntry
+	for _, entry := range lister.Entries() {
+		entries = append(entries, upstream.MemoryEntry{
+			Source:     entry.SourcePhrase,
+			SourceLang: sourceLang,
+			Target:     entry.TargetPhrase,
+			TargetLang: entry.TargetLang,
+		})
+	}
+
+	return FromEntries(entries), nil
+}
+
+// ExportMemory returns the contents of a translation memory as a document.
+func ExportMemory(memory *upstream.TranslationMemory) *Document {
+	return FromEntries(memory.Entries())
+}
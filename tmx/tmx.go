@@ -0,0 +1,292 @@
+// Package tmx reads and writes translation memories in the Translation Memory eXchange format, version 1.4b.
+package tmx
+
+import (
+	"encoding/xml"
+	"github.com/kuboschek/translate-server/upstream"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io"
+	"strings"
+)
+
+// allLanguages is the source language of documents whose units may be translated from any of their languages
+const allLanguages = "*all*"
+
+// Variant is the text of a translation unit in one language.
+type Variant struct {
+	Lang language.Tag
+	Text string
+}
+
+// Unit is a translation unit, the same phrase in several languages.
+type Unit struct {
+	// SourceLang overrides the source language of the document for this unit.
+	SourceLang language.Tag
+
+	// AnySource overrides the source language of the document, so any variant may be the source.
+	AnySource bool
+	Variants  []Variant
+}
+
+// Document is a translation memory. A SourceLang of language.Und means that any language may be the source.
+type Document struct {
+	SourceLang language.Tag
+	Units      []Unit
+}
+
+type tmxDocument struct {
+	XMLName xml.Name  `xml:"tmx"`
+	Version string    `xml:"version,attr"`
+	Header  tmxHeader `xml:"header"`
+	Units   []tmxUnit `xml:"body>tu"`
+}
+
+type tmxHeader struct {
+	CreationTool        string `xml:"creationtool,attr"`
+	CreationToolVersion string `xml:"creationtoolversion,attr"`
+	SegType             string `xml:"segtype,attr"`
+	Format              string `xml:"o-tmf,attr"`
+	AdminLang           string `xml:"adminlang,attr"`
+	SourceLang          string `xml:"srclang,attr"`
+	DataType            string `xml:"datatype,attr"`
+}
+
+type tmxUnit struct {
+	SourceLang string       `xml:"srclang,attr,omitempty"`
+	Variants   []tmxVariant `xml:"tuv"`
+}
+
+type tmxVariant struct {
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+
+	// LegacyLang is the language attribute of TMX 1.1 and earlier
+	LegacyLang string     `xml:"lang,attr,omitempty"`
+	Segment    tmxSegment `xml:"seg"`
+}
+
+// tmxSegment is the text of a segment, without the native codes of inline elements
+type tmxSegment string
+
+// codeElements contain formatting codes of the original document, rather than translatable text
+var codeElements = map[string]bool{
+	"bpt": true,
+	"ept": true,
+	"it":  true,
+	"ph":  true,
+	"ut":  true,
+}
+
+func (s *tmxSegment) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var text strings.Builder
+
+	depth, skipping := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if skipping > 0 || codeElements[token.Name.Local] {
+				skipping++
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				*s = tmxSegment(text.String())
+				return nil
+			}
+			depth--
+			if skipping > 0 {
+				skipping--
+			}
+		case xml.CharData:
+			if skipping == 0 {
+				text.Write(token)
+			}
+		}
+	}
+}
+
+// parseLanguage normalizes the many spellings of language codes found in TMX files, e.g. EN_us
+func parseLanguage(code string) (language.Tag, error) {
+	tag, err := language.Parse(strings.TrimSpace(code))
+	if err != nil {
+		return language.Und, errors.Wrapf(err, "invalid language %q", code)
+	}
+
+	return tag, nil
+}
+
+// Read parses a TMX document.
+func Read(r io.Reader) (*Document, error) {
+	var raw tmxDocument
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse TMX")
+	}
+
+	document := &Document{}
+	if raw.Header.SourceLang != "" && raw.Header.SourceLang != allLanguages {
+		tag, err := parseLanguage(raw.Header.SourceLang)
+		if err != nil {
+			return nil, errors.Wrap(err, "header")
+		}
+		document.SourceLang = tag
+	}
+
+	for i, rawUnit := range raw.Units {
+		unit := Unit{AnySource: rawUnit.SourceLang == allLanguages}
+		if rawUnit.SourceLang != "" && !unit.AnySource {
+			tag, err := parseLanguage(rawUnit.SourceLang)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unit %d", i+1)
+			}
+			unit.SourceLang = tag
+		}
+
+		for _, rawVariant := range rawUnit.Variants {
+			code := rawVariant.Lang
+			if code == "" {
+				code = rawVariant.LegacyLang
+			}
+
+			tag, err := parseLanguage(code)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unit %d", i+1)
+			}
+
+			unit.Variants = append(unit.Variants, Variant{Lang: tag, Text: string(rawVariant.Segment)})
+		}
+
+		document.Units = append(document.Units, unit)
+	}
+
+	return document, nil
+}
+
+// Write encodes a document as TMX 1.4b.
+func Write(w io.Writer, document *Document) error {
+	raw := tmxDocument{
+		Version: "1.4",
+		Header: tmxHeader{
+			CreationTool:        "translate-server",
+			CreationToolVersion: "1",
+			SegType:             "sentence",
+			Format:              "translate-server",
+			AdminLang:           "en",
+			SourceLang:          allLanguages,
+			DataType:            "plaintext",
+		},
+	}
+
+	if document.SourceLang != language.Und {
+		raw.Header.SourceLang = document.SourceLang.String()
+	}
+
+	for _, unit := range document.Units {
+		rawUnit := tmxUnit{}
+		if unit.AnySource && document.SourceLang != language.Und {
+			rawUnit.SourceLang = allLanguages
+		} else if unit.SourceLang != language.Und && unit.SourceLang != document.SourceLang {
+			rawUnit.SourceLang = unit.SourceLang.String()
+		}
+
+		for _, variant := range unit.Variants {
+			rawUnit.Variants = append(rawUnit.Variants, tmxVariant{
+				Lang:    variant.Lang.String(),
+				Segment: tmxSegment(variant.Text),
+			})
+		}
+
+		raw.Units = append(raw.Units, rawUnit)
+	}
+
+	io.WriteString(w, xml.Header)
+	io.WriteString(w, "<!DOCTYPE tmx SYSTEM \"tmx14.dtd\">\n")
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(raw); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Entries returns a translation memory entry for every pair of source and target variant in the document.
+// Units without a source language are translated from each of their variants.
+func (d *Document) Entries() []upstream.MemoryEntry {
+	var entries []upstream.MemoryEntry
+
+	for _, unit := range d.Units {
+		sourceLang := unit.SourceLang
+		if sourceLang == language.Und && !unit.AnySource {
+			sourceLang = d.SourceLang
+		}
+
+		for _, source := range unit.Variants {
+			if sourceLang != language.Und && source.Lang != sourceLang {
+				continue
+			}
+
+			for _, target := range unit.Variants {
+				if target.Lang == source.Lang {
+					continue
+				}
+
+				entries = append(entries, upstream.MemoryEntry{
+					Source:     source.Text,
+					SourceLang: source.Lang,
+					Target:     target.Text,
+					TargetLang: target.Lang,
+				})
+			}
+		}
+	}
+
+	return entries
+}
+
+// FromEntries groups translation memory entries with the same source into units.
+func FromEntries(entries []upstream.MemoryEntry) *Document {
+	type unitKey struct {
+		lang   language.Tag
+		source string
+	}
+
+	document := &Document{}
+	units := make(map[unitKey]int)
+	sourceLangs := make(map[language.Tag]bool)
+
+	for _, entry := range entries {
+		key := unitKey{entry.SourceLang, entry.Source}
+		index, ok := units[key]
+		if !ok {
+			index = len(document.Units)
+			units[key] = index
+			sourceLangs[entry.SourceLang] = true
+
+			document.Units = append(document.Units, Unit{
+				SourceLang: entry.SourceLang,
+				Variants:   []Variant{{Lang: entry.SourceLang, Text: entry.Source}},
+			})
+		}
+
+		document.Units[index].Variants = append(document.Units[index].Variants, Variant{
+			Lang: entry.TargetLang,
+			Text: entry.Target,
+		})
+	}
+
+	// Documents with a single source language declare it once in the header
+	if len(sourceLangs) == 1 {
+		for lang := range sourceLangs {
+			document.SourceLang = lang
+		}
+	}
+
+	return document
+}
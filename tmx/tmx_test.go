@@ -0,0 +1,106 @@
+package tmx
+
+import (
+	"bytes"
+	"github.com/kuboschek/translate-server/upstream"
+	"golang.org/x/text/language"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var (
+	enUS = language.MustParse("en-US")
+	deDE = language.MustParse("de-DE")
+	frFR = language.MustParse("fr-FR")
+)
+
+func readVendor(t *testing.T) *Document {
+	file, err := os.Open("testdata/vendor.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	document, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return document
+}
+
+func TestRead(t *testing.T) {
+	document := readVendor(t)
+
+	if document.SourceLang != enUS {
+		t.Errorf("Read should normalize the source language: got %v", document.SourceLang)
+	}
+
+	if len(document.Units) != 3 {
+		t.Fatalf("Read should return every unit: got %v", len(document.Units))
+	}
+
+	want := []Variant{{enUS, "Save changes"}, {deDE, "Änderungen speichern"}, {frFR, "Enregistrer les modifications"}}
+	if !reflect.DeepEqual(document.Units[0].Variants, want) {
+		t.Errorf("Read should normalize language tags: got %v", document.Units[0].Variants)
+	}
+
+	want = []Variant{{enUS, "Click here & continue"}, {deDE, "Hier klicken & weiter"}}
+	if !reflect.DeepEqual(document.Units[1].Variants, want) {
+		t.Errorf("Read should drop native codes and read TMX 1.1 languages: got %v", document.Units[1].Variants)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := Read(bytes.NewBufferString(`<tmx version="1.4"><header srclang="en"/><body><tu><tuv xml:lang="not a language"><seg>x</seg></tuv></tu></body></tmx>`))
+	if err == nil {
+		t.Error("Read should return an error for invalid languages")
+	}
+
+	_, err = Read(bytes.NewBufferString(`<tmx><body>`))
+	if err == nil {
+		t.Error("Read should return an error for malformed documents")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	entries := readVendor(t).Entries()
+
+	want := []upstream.MemoryEntry{
+		{Source: "Save changes", SourceLang: enUS, Target: "Änderungen speichern", TargetLang: deDE},
+		{Source: "Save changes", SourceLang: enUS, Target: "Enregistrer les modifications", TargetLang: frFR},
+		{Source: "Click here & continue", SourceLang: enUS, Target: "Hier klicken & weiter", TargetLang: deDE},
+		{Source: "Ja", SourceLang: deDE, Target: "Oui", TargetLang: frFR},
+		{Source: "Oui", SourceLang: frFR, Target: "Ja", TargetLang: deDE},
+	}
+
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Entries should pair every source with every target: got %v", entries)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	entries := []upstream.MemoryEntry{
+		{Source: "Save <now>", SourceLang: language.English, Target: "Jetzt & sofort", TargetLang: language.German},
+		{Source: "Save <now>", SourceLang: language.English, Target: "Maintenant", TargetLang: language.French},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Write(buf, FromEntries(entries)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte(`srclang="en"`)) || !bytes.Contains(buf.Bytes(), []byte(`xml:lang="de"`)) {
+		t.Errorf("Write should declare languages as TMX 1.4b: got\n%s", buf)
+	}
+
+	document, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(document.Entries(), entries) {
+		t.Errorf("Read should return the written entries: got %v", document.Entries())
+	}
+}
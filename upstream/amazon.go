@@ -0,0 +1,146 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	amazonTarget      = "AWSShineFrontendService_20170701.TranslateText"
+	amazonContentType = "application/x-amz-json-1.1"
+	amazonService     = "translate"
+)
+
+// Amazon is a upstream.Service implementation that calls the Amazon Translate TranslateText API.
+type Amazon struct {
+	// Region is the AWS region to send requests to, e.g. eu-west-1
+	Region string
+
+	Credentials AWSCredentials
+
+	// TerminologyNames lists custom terminologies, previously imported into Amazon Translate, to apply.
+	TerminologyNames []string
+
+	// Endpoint overrides the regional endpoint, e.g. for VPC endpoints or local stand-ins.
+	Endpoint string
+
+	// Client is used to perform requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+type amazonRequest struct {
+	Text               string
+	SourceLanguageCode string
+	TargetLanguageCode string
+	TerminologyNames   []string `json:",omitempty"`
+}
+
+type amazonResponse struct {
+	TranslatedText     string
+	SourceLanguageCode string
+	TargetLanguageCode string
+}
+
+type amazonError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// endpoint returns the URL requests are sent to
+func (a Amazon) endpoint() string {
+	if a.Endpoint != "" {
+		return a.Endpoint
+	}
+
+	return "https://translate." + a.Region + ".amazonaws.com/"
+}
+
+// amazonLanguage converts a language tag to the code Amazon Translate expects.
+// Amazon accepts bare language codes, plus a few regional and script variants.
+func amazonLanguage(tag language.Tag) string {
+	base, _ := tag.Base()
+	switch base.String() {
+	case "zh":
+		if script, _ := tag.Script(); script.String() == "Hant" {
+			return "zh-TW"
+		}
+	case "fr", "pt", "es":
+		if region, confidence := tag.Region(); confidence == language.Exact {
+			switch base.String() + "-" + region.String() {
+			case "fr-CA", "pt-PT", "es-MX":
+				return base.String() + "-" + region.String()
+			}
+		}
+	}
+
+	return base.String()
+}
+
+// Translate translates the given text using Amazon Translate. Requests are signed with AWS Signature Version 4.
+func (a Amazon) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	body, err := json.Marshal(amazonRequest{
+		Text:               givenPhrase,
+		SourceLanguageCode: amazonLanguage(givenLang),
+		TargetLanguageCode: amazonLanguage(targetLang),
+		TerminologyNames:   a.TerminologyNames,
+	})
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, a.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	request.Header.Set("Content-Type", amazonContentType)
+	request.Header.Set("X-Amz-Target", amazonTarget)
+	signV4(request, body, a.Credentials, a.Region, amazonService, time.Now())
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		apiError := amazonError{}
+		json.NewDecoder(response.Body).Decode(&apiError)
+		log.Printf("Amazon Translate API returned error: %v: %v", apiError.Type, apiError.Message)
+		if strings.HasSuffix(apiError.Type, "UnsupportedLanguagePairException") {
+			sendError(out, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "amazon: " + apiError.Message})
+			return
+		}
+		sendError(out, errors.Errorf("amazon: %v: %v", response.Status, apiError.Message))
+		return
+	}
+
+	result := amazonResponse{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		sendError(out, errors.Wrap(err, "amazon: invalid response"))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: result.TranslatedText,
+	}
+}
@@ -0,0 +1,108 @@
+package upstream
+
+import (
+	"encoding/json"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCredentials = AWSCredentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+// TestSignV4 checks the signer against the example from the AWS General Reference
+func TestSignV4(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	signV4(request, nil, testCredentials, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+
+	if got := request.Header.Get("Authorization"); got != want {
+		t.Errorf("signV4 produced wrong Authorization header: want %v, got %v", want, got)
+	}
+}
+
+func TestAmazon_Translate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != amazonTarget {
+			t.Errorf("Amazon should call TranslateText: got target %v", r.Header.Get("X-Amz-Target"))
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Errorf("Amazon should sign requests: got %v", r.Header.Get("Authorization"))
+		}
+
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Error("Amazon should send the session token")
+		}
+
+		request := amazonRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if request.SourceLanguageCode != "de" || request.TargetLanguageCode != "fr-CA" {
+			t.Errorf("Amazon sent wrong languages: got %v -> %v", request.SourceLanguageCode, request.TargetLanguageCode)
+		}
+
+		if len(request.TerminologyNames) != 1 || request.TerminologyNames[0] != "brands" {
+			t.Errorf("Amazon should send terminology names: got %v", request.TerminologyNames)
+		}
+
+		if request.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(amazonError{Type: "ValidationException", Message: "empty text"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(amazonResponse{TranslatedText: strings.ToLower(request.Text)})
+	}))
+	defer server.Close()
+
+	credentials := testCredentials
+	credentials.SessionToken = "token"
+
+	service := Amazon{
+		Region:           "eu-west-1",
+		Credentials:      credentials,
+		TerminologyNames: []string{"brands"},
+		Endpoint:         server.URL,
+	}
+
+	out := make(chan Result)
+	go service.Translate(testPhrase, language.German, language.CanadianFrench, &out)
+
+	select {
+	case result := <-out:
+		if result.Error != nil {
+			t.Errorf("Amazon returned error when it shouldn't have: %v", result.Error)
+		}
+
+		if result.TranslatedPhrase != strings.ToLower(testPhrase) {
+			t.Errorf("Amazon returned incorrect result: want %v, got %v", strings.ToLower(testPhrase), result.TranslatedPhrase)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+
+	out = make(chan Result)
+	go service.Translate("", language.German, language.CanadianFrench, &out)
+
+	select {
+	case result := <-out:
+		if result.Error == nil {
+			t.Error("Amazon should return an error when the API rejects the request")
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+}
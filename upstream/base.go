@@ -1,7 +1,12 @@
 // Package upstream provides implementations for upstream translation services.
 package upstream
 
-import "golang.org/x/text/language"
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/language"
+	"regexp"
+)
 
 // Result represents the result of a translation call to a service.
 type Result struct {
@@ -10,9 +15,71 @@ type Result struct {
 	GivenLang        language.Tag
 	TargetLang       language.Tag
 	TranslatedPhrase string
+
+	// Pivot is the intermediate language a translation went through, or language.Und for direct translations.
+	Pivot language.Tag
+
+	// MatchScore is the similarity, from 0 to 1, of the phrase a stored translation was found for.
+	// It is zero for machine translations.
+	MatchScore float64
 }
 
 // Service represents an external service that provides translations.
 type Service interface {
 	Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result)
 }
+
+// HTMLService is implemented by services that can translate HTML themselves, keeping tags and entities.
+type HTMLService interface {
+	Service
+
+	// WithHTML returns a service translating phrases as HTML, or false if this is not supported
+	WithHTML() (Service, bool)
+}
+
+// BatchService is implemented by services that can translate several phrases with one request.
+type BatchService interface {
+	Service
+
+	// TranslateBatch returns the translations of phrases in the same order, or ErrNoBatch if this is not supported
+	TranslateBatch(phrases []string, givenLang, targetLang language.Tag) ([]string, error)
+}
+
+// ErrNoBatch is returned by wrappers of services that do not translate batches.
+var ErrNoBatch = errors.New("service does not translate batches")
+
+// UnsupportedLanguageError is returned by services that cannot translate between two languages at all, as opposed to
+// failing for a while. Only these errors make Pivot translate through an intermediate language.
+type UnsupportedLanguageError struct {
+	GivenLang, TargetLang language.Tag
+
+	// Message is the error message of the service
+	Message string
+}
+
+func (e *UnsupportedLanguageError) Error() string {
+	return fmt.Sprintf("unsupported language pair %v -> %v: %v", e.GivenLang, e.TargetLang, e.Message)
+}
+
+// IsUnsupportedLanguage reports whether err is, or wraps, an UnsupportedLanguageError.
+func IsUnsupportedLanguage(err error) bool {
+	var unsupported *UnsupportedLanguageError
+	return errors.As(err, &unsupported)
+}
+
+// unsupportedLanguageMessage matches error messages of APIs that do not report unsupported languages by a code, like
+// "Bad language pair: th|sw" or "sw is not supported"
+var unsupportedLanguageMessage = regexp.MustCompile(`(?i)language pair|(source|target) language (is )?(invalid|not (valid|supported))|is not supported|unsupported language`)
+
+// call runs a service and waits for its result. This is used by services wrapping other services.
+func call(svc Service, givenPhrase string, givenLang, targetLang language.Tag) Result {
+	out := make(chan Result)
+	go svc.Translate(givenPhrase, givenLang, targetLang, &out)
+
+	result, ok := <-out
+	if !ok {
+		return Result{Error: errors.New("service returned no result")}
+	}
+
+	return result
+}
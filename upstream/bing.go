@@ -2,79 +2,211 @@ package upstream
 
 import (
 	"bytes"
-	"encoding/xml"
+	"encoding/json"
 	"github.com/pkg/errors"
 	"golang.org/x/text/language"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 const (
-	azureAPIBase = "https://api.microsofttranslator.com/v2/Http.svc/Translate"
-)
+	azureAPIBase = "https://api.cognitive.microsofttranslator.com"
+
+	// Error codes of the Translator v3 API for languages it does not translate
+	azureUnsupportedLanguage = 400019
+	azureInvalidSource       = 400035
+	azureInvalidTarget       = 400036
 
-var azureBaseURL *url.URL
+	// Limits of a single request to the Translator v3 API
+	azureMaxElements   = 100
+	azureMaxCharacters = 50000
+)
 
-// Azure represents a translation service calling the Azure Cognitive Services Machine Translation Service.
+// Azure represents a translation service calling the Azure Cognitive Services Translator v3 API.
 type Azure struct {
 	// ServiceKey is the key from the Azure dashboard
 	ServiceKey string
+
+	// Region is the location of a regional or multi-service resource, e.g. westeurope.
+	// It may be empty for global Translator resources.
+	Region string
+
+	// Endpoint overrides the global API endpoint, e.g. for custom domains or sovereign clouds.
+	Endpoint string
+
+	// TextType is either "plain" (the default) or "html"
+	TextType string
+
+	// Client is used to perform requests. If nil, http.DefaultClient is used.
+	Client *http.Client
 }
 
-type bingResult struct {
-	// Translated is the translation content as returned from Azure
-	Translated string `xml:",chardata"`
+type azureText struct {
+	Text string
 }
 
-func init() {
-	var err error
-	azureBaseURL, err = url.Parse(azureAPIBase)
-	if err != nil {
-		panic(err)
+type azureResult struct {
+	Translations []struct {
+		Text string `json:"text"`
+		To   string `json:"to"`
+	} `json:"translations"`
+}
+
+type azureError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// azureLanguage converts a language tag to the code the Translator API expects.
+func azureLanguage(tag language.Tag) string {
+	base, _ := tag.Base()
+	switch base.String() {
+	case "zh", "sr":
+		script, _ := tag.Script()
+		return base.String() + "-" + script.String()
+	case "fr", "pt":
+		if region, confidence := tag.Region(); confidence == language.Exact {
+			switch base.String() + "-" + region.String() {
+			case "fr-CA", "pt-PT":
+				return base.String() + "-" + region.String()
+			}
+		}
 	}
+
+	return base.String()
 }
 
-// Translate call Microsoft Cognitive Services to translate the given string
-func (b Azure) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
-	requestURL := *azureBaseURL
-	requestURL.RawQuery = "from=" + url.QueryEscape(givenLang.String()) + "&to=" + url.QueryEscape(targetLang.String()) + "&text=" + url.QueryEscape(givenPhrase)
+// batches splits phrases into groups that stay within the limits of a single API request
+func batches(phrases []string) [][]string {
+	var result [][]string
+	var current []string
+	characters := 0
 
-	request, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
-	request.Header.Set("Ocp-Apim-Subscription-Key", b.ServiceKey)
+	for _, phrase := range phrases {
+		length := len([]rune(phrase))
+		if len(current) > 0 && (len(current) == azureMaxElements || characters+length > azureMaxCharacters) {
+			result = append(result, current)
+			current, characters = nil, 0
+		}
 
-	if err != nil {
-		*out <- Result{
-			Error: err,
+		current = append(current, phrase)
+		characters += length
+	}
+
+	if len(current) > 0 {
+		result = append(result, current)
+	}
+
+	return result
+}
+
+// TranslateBatch translates multiple phrases, using as few API requests as possible.
+// The translations are returned in the same order as the given phrases.
+func (b Azure) TranslateBatch(phrases []string, givenLang, targetLang language.Tag) ([]string, error) {
+	var translated []string
+	for _, batch := range batches(phrases) {
+		result, err := b.translateBatch(batch, givenLang, targetLang)
+		if err != nil {
+			return nil, err
 		}
-		return
+
+		translated = append(translated, result...)
+	}
+
+	return translated, nil
+}
+
+// translateBatch performs a single call to the /translate endpoint
+func (b Azure) translateBatch(phrases []string, givenLang, targetLang language.Tag) ([]string, error) {
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = azureAPIBase
 	}
 
-	response, err := http.DefaultClient.Do(request)
+	query := url.Values{}
+	query.Set("api-version", "3.0")
+	query.Set("from", azureLanguage(givenLang))
+	query.Set("to", azureLanguage(targetLang))
+	if b.TextType != "" {
+		query.Set("textType", b.TextType)
+	}
+
+	texts := make([]azureText, len(phrases))
+	for i, phrase := range phrases {
+		texts[i].Text = phrase
+	}
+
+	body, err := json.Marshal(texts)
 	if err != nil {
-		*out <- Result{
-			Error: err,
-		}
-		return
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/translate?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Ocp-Apim-Subscription-Key", b.ServiceKey)
+	if b.Region != "" {
+		request.Header.Set("Ocp-Apim-Subscription-Region", b.Region)
 	}
 
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(response.Body)
-	content := buf.String()
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		log.Printf("Azure API returned error: %v", content)
-		*out <- Result{
-			Error: errors.New(response.Status),
+		apiError := azureError{}
+		json.NewDecoder(response.Body).Decode(&apiError)
+		log.Printf("Azure API returned error: %v: %v", apiError.Error.Code, apiError.Error.Message)
+
+		switch apiError.Error.Code {
+		case azureUnsupportedLanguage, azureInvalidSource, azureInvalidTarget:
+			return nil, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "azure: " + apiError.Error.Message}
 		}
+		return nil, errors.Errorf("azure: %v: %v", response.Status, apiError.Error.Message)
 	}
 
-	result := &bingResult{}
-	err = xml.Unmarshal(buf.Bytes(), result)
+	var results []azureResult
+	err = json.NewDecoder(response.Body).Decode(&results)
 	if err != nil {
-		*out <- Result{
-			Error: err,
+		return nil, errors.Wrap(err, "azure: invalid response")
+	}
+
+	if len(results) != len(phrases) {
+		return nil, errors.Errorf("azure: got %v translations for %v phrases", len(results), len(phrases))
+	}
+
+	translated := make([]string, len(results))
+	for i, result := range results {
+		if len(result.Translations) == 0 {
+			return nil, errors.New("azure: response contains no translation")
 		}
+		translated[i] = result.Translations[0].Text
+	}
+
+	return translated, nil
+}
+
+// Translate call Microsoft Cognitive Services to translate the given string
+func (b Azure) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	translated, err := b.TranslateBatch([]string{givenPhrase}, givenLang, targetLang)
+	if err != nil {
+		sendError(out, err)
 		return
 	}
 
@@ -82,6 +214,12 @@ func (b Azure) Translate(givenPhrase string, givenLang, targetLang language.Tag,
 		GivenLang:        givenLang,
 		GivenPhrase:      givenPhrase,
 		TargetLang:       targetLang,
-		TranslatedPhrase: result.Translated,
+		TranslatedPhrase: translated[0],
 	}
 }
+
+// WithHTML returns a copy of this service translating HTML.
+func (b Azure) WithHTML() (Service, bool) {
+	b.TextType = "html"
+	return b, true
+}
@@ -0,0 +1,143 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAzureServer starts a fake Translator v3 API that upper-cases its input, and counts requests
+func newAzureServer(t *testing.T, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"code":401000,"message":"The request is not authorized."}}`)
+			return
+		}
+
+		if r.Header.Get("Ocp-Apim-Subscription-Region") != "westeurope" {
+			t.Errorf("Azure should send the region header: got %v", r.Header.Get("Ocp-Apim-Subscription-Region"))
+		}
+
+		query := r.URL.Query()
+		if r.URL.Path != "/translate" || query.Get("api-version") != "3.0" || query.Get("from") != "de" || query.Get("to") != "zh-Hant" {
+			t.Errorf("Azure called wrong URL: %v", r.URL)
+		}
+
+		var texts []azureText
+		json.NewDecoder(r.Body).Decode(&texts)
+		if len(texts) > azureMaxElements {
+			t.Errorf("Azure sent too many elements in one request: %v", len(texts))
+		}
+
+		results := make([]azureResult, len(texts))
+		for i, text := range texts {
+			translated := strings.ToUpper(text.Text)
+			if query.Get("textType") == "html" {
+				translated = "<b>" + translated + "</b>"
+			}
+
+			results[i].Translations = append(results[i].Translations, struct {
+				Text string `json:"text"`
+				To   string `json:"to"`
+			}{translated, query.Get("to")})
+		}
+		json.NewEncoder(w).Encode(results)
+	}))
+}
+
+func TestAzure_Translate(t *testing.T) {
+	requests := 0
+	server := newAzureServer(t, &requests)
+	defer server.Close()
+
+	service := Azure{ServiceKey: "secret", Region: "westeurope", Endpoint: server.URL}
+	out := make(chan Result)
+	go service.Translate("test", language.German, language.TraditionalChinese, &out)
+
+	select {
+	case result := <-out:
+		if result.Error != nil {
+			t.Errorf("Azure returned error when it shouldn't have: %v", result.Error)
+		}
+
+		if result.TranslatedPhrase != "TEST" {
+			t.Errorf("Azure returned incorrect result: want %v, got %v", "TEST", result.TranslatedPhrase)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+
+	service.TextType = "html"
+	translated, err := service.TranslateBatch([]string{"html"}, language.German, language.TraditionalChinese)
+	if err != nil || translated[0] != "<b>HTML</b>" {
+		t.Errorf("Azure should request HTML translation: got %v (%v)", translated, err)
+	}
+}
+
+func TestAzure_TranslateError(t *testing.T) {
+	requests := 0
+	server := newAzureServer(t, &requests)
+	defer server.Close()
+
+	service := Azure{ServiceKey: "wrong", Endpoint: server.URL}
+	out := make(chan Result)
+	go service.Translate("test", language.German, language.TraditionalChinese, &out)
+
+	select {
+	case result := <-out:
+		if result.Error == nil || !strings.Contains(result.Error.Error(), "not authorized") {
+			t.Errorf("Azure should return the decoded error message: got %v", result.Error)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+}
+
+func TestAzure_TranslateUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400036,"message":"The target language is not valid."}}`)
+	}))
+	defer server.Close()
+
+	service := Azure{ServiceKey: "secret", Endpoint: server.URL}
+	result := call(service, "test", language.Thai, language.Swahili)
+	if !IsUnsupportedLanguage(result.Error) {
+		t.Errorf("Azure should report unsupported languages: got %v", result.Error)
+	}
+}
+
+func TestAzure_TranslateBatch(t *testing.T) {
+	requests := 0
+	server := newAzureServer(t, &requests)
+	defer server.Close()
+
+	phrases := make([]string, 150)
+	for i := range phrases {
+		phrases[i] = fmt.Sprintf("phrase %v", i)
+	}
+
+	service := Azure{ServiceKey: "secret", Region: "westeurope", Endpoint: server.URL}
+	translated, err := service.TranslateBatch(phrases, language.German, language.TraditionalChinese)
+	if err != nil {
+		t.Fatalf("TranslateBatch returned error when it shouldn't have: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("TranslateBatch should split large batches: want 2 requests, got %v", requests)
+	}
+
+	if len(translated) != len(phrases) || translated[149] != "PHRASE 149" {
+		t.Error("TranslateBatch should return translations in order")
+	}
+}
@@ -51,3 +51,56 @@ func (b *CircuitBreaker) Translate(givenPhrase string, givenLang, targetLang lan
 		b.Breaker.Fail()
 	}
 }
+
+// WithGlossary returns the wrapped handler with a glossary, sharing this breaker, if the handler supports it.
+func (b *CircuitBreaker) WithGlossary(terms map[string]string) (Service, bool) {
+	native, ok := b.Handler.(GlossaryService)
+	if !ok {
+		return nil, false
+	}
+
+	handler, ok := native.WithGlossary(terms)
+	if !ok {
+		return nil, false
+	}
+
+	return &CircuitBreaker{Breaker: b.Breaker, Timeout: b.Timeout, Handler: handler}, true
+}
+
+// WithHTML returns the wrapped handler translating HTML, sharing this breaker, if the handler supports it.
+func (b *CircuitBreaker) WithHTML() (Service, bool) {
+	native, ok := b.Handler.(HTMLService)
+	if !ok {
+		return nil, false
+	}
+
+	handler, ok := native.WithHTML()
+	if !ok {
+		return nil, false
+	}
+
+	return &CircuitBreaker{Breaker: b.Breaker, Timeout: b.Timeout, Handler: handler}, true
+}
+
+// TranslateBatch translates several phrases with the wrapped handler, if it translates batches.
+func (b *CircuitBreaker) TranslateBatch(phrases []string, givenLang, targetLang language.Tag) ([]string, error) {
+	native, ok := b.Handler.(BatchService)
+	if !ok {
+		return nil, ErrNoBatch
+	}
+
+	if b.Breaker == nil {
+		return nil, errors.New("circuit breaker: is nil")
+	}
+
+	if b.Breaker.Tripped() {
+		return nil, errors.New("circuit breaker: is tripped")
+	}
+
+	translated, err := native.TranslateBatch(phrases, givenLang, targetLang)
+	if err != nil {
+		b.Breaker.Fail()
+	}
+
+	return translated, err
+}
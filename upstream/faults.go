@@ -0,0 +1,328 @@
+package upstream
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHangTimeout is how long hanging requests block by default, far longer than clients wait
+	defaultHangTimeout = time.Minute
+
+	// maxScriptSteps limits how long scripts get by repeating faults
+	maxScriptSteps = 10000
+)
+
+// Fault is a behaviour Faults can simulate for a single request.
+type Fault int
+
+const (
+	// Succeed returns the original phrase, like Mock does
+	Succeed Fault = iota
+	// Fail returns an error
+	Fail
+	// Hang does not respond until the request has long timed out
+	Hang
+	// Garble returns a corrupted phrase
+	Garble
+	// Partial returns a truncated phrase
+	Partial
+)
+
+var faultNames = map[string]Fault{
+	"ok":      Succeed,
+	"fail":    Fail,
+	"hang":    Hang,
+	"garble":  Garble,
+	"partial": Partial,
+}
+
+func (f Fault) String() string {
+	for name, fault := range faultNames {
+		if fault == f {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(f))
+}
+
+// Latency describes the distribution of simulated response times.
+type Latency struct {
+	// Distribution is one of "fixed" (the default), "uniform", "normal" or "exponential".
+	Distribution string
+
+	// Mean is the average delay.
+	Mean time.Duration
+
+	// Spread is the maximum deviation for uniform, and the standard deviation for normal distributions.
+	Spread time.Duration
+}
+
+// sample draws a delay from the distribution. Delays are never negative.
+func (l Latency) sample(random *rand.Rand) time.Duration {
+	var delay float64
+	switch l.Distribution {
+	case "uniform":
+		delay = float64(l.Mean) + (random.Float64()*2-1)*float64(l.Spread)
+	case "normal":
+		delay = float64(l.Mean) + random.NormFloat64()*float64(l.Spread)
+	case "exponential":
+		delay = random.ExpFloat64() * float64(l.Mean)
+	default:
+		delay = float64(l.Mean)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+
+	return time.Duration(delay)
+}
+
+// Faults is a programmable mock used for resilience testing. For every request, it plays the next step of
+// Script, if any are left, or picks a fault at random with the configured rates. Responses are delayed
+// according to Latency.
+type Faults struct {
+	FailureRate float64
+	HangRate    float64
+	GarbleRate  float64
+	PartialRate float64
+
+	Latency Latency
+
+	// Script lists faults to simulate in order, e.g. fail three times, then succeed.
+	Script []Fault
+
+	// Languages overrides the behaviour for requests to a given target language.
+	Languages map[language.Tag]*Faults
+
+	// Seed makes random faults reproducible. If zero, the current time is used.
+	Seed int64
+
+	// HangTimeout is how long hanging requests block before closing the channel without a result, so their
+	// goroutines end. Defaults to a minute.
+	HangTimeout time.Duration
+
+	lock   sync.Mutex
+	step   int
+	random *rand.Rand
+}
+
+// next decides on the fault and delay for the next request
+func (f *Faults) next() (Fault, time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.random == nil {
+		seed := f.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		f.random = rand.New(rand.NewSource(seed))
+	}
+
+	delay := f.Latency.sample(f.random)
+
+	if f.step < len(f.Script) {
+		f.step++
+		return f.Script[f.step-1], delay
+	}
+
+	roll := f.random.Float64()
+	for _, candidate := range []struct {
+		fault Fault
+		rate  float64
+	}{{Fail, f.FailureRate}, {Hang, f.HangRate}, {Garble, f.GarbleRate}, {Partial, f.PartialRate}} {
+		if roll < candidate.rate {
+			return candidate.fault, delay
+		}
+		roll -= candidate.rate
+	}
+
+	return Succeed, delay
+}
+
+// garble corrupts a phrase the way broken encodings tend to
+func garble(phrase string) string {
+	runes := []rune(phrase)
+	for i := 0; i < len(runes); i += 3 {
+		runes[i] = '�'
+	}
+
+	return string(runes)
+}
+
+// Translate simulates the next fault. Successful requests return the original phrase.
+func (f *Faults) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	if override, ok := f.Languages[targetLang]; ok {
+		override.Translate(givenPhrase, givenLang, targetLang, out)
+		return
+	}
+
+	fault, delay := f.next()
+	log.Printf("Faults got request: \"%v\" (%v -> %v), simulating fault %v after %v", givenPhrase, givenLang, targetLang, fault, delay)
+
+	defer close(*out)
+
+	if fault == Hang {
+		timeout := f.HangTimeout
+		if timeout == 0 {
+			timeout = defaultHangTimeout
+		}
+		time.Sleep(timeout)
+		return
+	}
+
+	time.Sleep(delay)
+
+	result := Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: givenPhrase,
+	}
+
+	switch fault {
+	case Fail:
+		result = Result{Error: errors.New("simulating service failure")}
+	case Garble:
+		result.TranslatedPhrase = garble(givenPhrase)
+	case Partial:
+		runes := []rune(givenPhrase)
+		result.TranslatedPhrase = string(runes[:len(runes)/2])
+	}
+
+	*out <- result
+}
+
+// ParseFaults reads a Faults configuration from a specification like
+//
+//	fail=0.1;hang=0.01;garble=0.05;partial=0.05;latency=normal:200ms:50ms;script=fail*3,ok;seed=42
+//
+// Keys may be prefixed with a language tag to configure behaviour for that target language only,
+// e.g. "fr.fail=1" makes every request to French fail.
+func ParseFaults(spec string) (*Faults, error) {
+	faults := &Faults{}
+
+	for _, setting := range strings.Split(spec, ";") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("faults: expected key=value, got %q", setting)
+		}
+		key, value := parts[0], parts[1]
+
+		target := faults
+		if dot := strings.Index(key, "."); dot >= 0 {
+			tag, err := language.Parse(key[:dot])
+			if err != nil {
+				return nil, errors.Wrapf(err, "faults: %q", setting)
+			}
+
+			if faults.Languages == nil {
+				faults.Languages = make(map[language.Tag]*Faults)
+			}
+			if faults.Languages[tag] == nil {
+				faults.Languages[tag] = &Faults{}
+			}
+			target, key = faults.Languages[tag], key[dot+1:]
+		}
+
+		if err := target.set(key, value); err != nil {
+			return nil, errors.Wrapf(err, "faults: %q", setting)
+		}
+	}
+
+	return faults, nil
+}
+
+// set applies a single key=value setting of a specification
+func (f *Faults) set(key, value string) error {
+	var err error
+	switch key {
+	case "fail":
+		f.FailureRate, err = strconv.ParseFloat(value, 64)
+	case "hang":
+		f.HangRate, err = strconv.ParseFloat(value, 64)
+	case "garble":
+		f.GarbleRate, err = strconv.ParseFloat(value, 64)
+	case "partial":
+		f.PartialRate, err = strconv.ParseFloat(value, 64)
+	case "seed":
+		f.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "latency":
+		f.Latency, err = parseLatency(value)
+	case "script":
+		f.Script, err = parseScript(value)
+	default:
+		err = errors.New("unknown key")
+	}
+
+	return err
+}
+
+// parseLatency reads a distribution:mean[:spread] specification, or a single fixed duration
+func parseLatency(value string) (Latency, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 1 {
+		parts = []string{"fixed", parts[0]}
+	}
+
+	latency := Latency{Distribution: parts[0]}
+	switch latency.Distribution {
+	case "fixed", "uniform", "normal", "exponential":
+	default:
+		return latency, errors.Errorf("unknown distribution %v", latency.Distribution)
+	}
+
+	var err error
+	latency.Mean, err = time.ParseDuration(parts[1])
+	if err == nil && len(parts) > 2 {
+		latency.Spread, err = time.ParseDuration(parts[2])
+	}
+
+	return latency, err
+}
+
+// parseScript reads a comma-separated list of faults, each optionally repeated, e.g. fail*3,ok
+func parseScript(value string) ([]Fault, error) {
+	var script []Fault
+	for _, step := range strings.Split(value, ",") {
+		parts := strings.SplitN(step, "*", 2)
+
+		fault, ok := faultNames[parts[0]]
+		if !ok {
+			return nil, errors.Errorf("unknown fault %v", parts[0])
+		}
+
+		count := 1
+		if len(parts) == 2 {
+			var err error
+			count, err = strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if count < 1 || len(script)+count > maxScriptSteps {
+			return nil, errors.Errorf("script repeats %v too often, at most %d steps are allowed", parts[0], maxScriptSteps)
+		}
+
+		for i := 0; i < count; i++ {
+			script = append(script, fault)
+		}
+	}
+
+	return script, nil
+}
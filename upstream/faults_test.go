@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"testing"
+	"time"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults("fail=0.25; latency=normal:200ms:50ms;script=fail*2,ok;seed=7;fr.hang=1")
+	if err != nil {
+		t.Fatalf("ParseFaults returned error for a valid specification: %v", err)
+	}
+
+	if faults.FailureRate != 0.25 || faults.Seed != 7 {
+		t.Errorf("ParseFaults should read rates: got %#v", faults)
+	}
+
+	if faults.Latency != (Latency{"normal", 200 * time.Millisecond, 50 * time.Millisecond}) {
+		t.Errorf("ParseFaults should read latency distributions: got %v", faults.Latency)
+	}
+
+	if len(faults.Script) != 3 || faults.Script[1] != Fail || faults.Script[2] != Succeed {
+		t.Errorf("ParseFaults should expand scripts: got %v", faults.Script)
+	}
+
+	if faults.Languages[language.French] == nil || faults.Languages[language.French].HangRate != 1 {
+		t.Error("ParseFaults should read per-language settings")
+	}
+
+	for _, spec := range []string{"fail", "fail=often", "latency=lognormal:1s", "script=explode", "xx-!.fail=1",
+		"script=fail*1000000000", "script=fail*0"} {
+		if _, err := ParseFaults(spec); err == nil {
+			t.Errorf("ParseFaults should reject %q", spec)
+		}
+	}
+}
+
+func TestFaults_Script(t *testing.T) {
+	faults := &Faults{Script: []Fault{Fail, Fail, Garble, Partial}}
+
+	want := []bool{true, true, false, false, false}
+	for i, failing := range want {
+		result := call(faults, testPhrase, language.German, language.English)
+		if (result.Error != nil) != failing {
+			t.Errorf("Faults should follow the script: step %v returned error %v", i, result.Error)
+		}
+	}
+
+	faults = &Faults{Script: []Fault{Garble, Partial}}
+	if result := call(faults, testPhrase, language.German, language.English); result.TranslatedPhrase == testPhrase {
+		t.Error("Faults should garble the phrase")
+	}
+
+	if result := call(faults, testPhrase, language.German, language.English); result.TranslatedPhrase != testPhrase[:len(testPhrase)/2] {
+		t.Errorf("Faults should truncate the phrase: got %v", result.TranslatedPhrase)
+	}
+}
+
+func TestFaults_Hang(t *testing.T) {
+	faults := &Faults{
+		Languages: map[language.Tag]*Faults{
+			language.French: {HangRate: 1, HangTimeout: 200 * time.Millisecond},
+		},
+	}
+
+	if result := call(faults, testPhrase, language.German, language.English); result.Error != nil {
+		t.Errorf("Faults should succeed for languages without overrides: %v", result.Error)
+	}
+
+	out := make(chan Result)
+	go faults.Translate(testPhrase, language.German, language.French, &out)
+
+	select {
+	case <-out:
+		t.Error("Faults should not respond when hanging")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	select {
+	case result, ok := <-out:
+		if ok {
+			t.Errorf("Faults should stop hanging without a result: got %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Error("Faults should stop hanging after the timeout")
+	}
+}
+
+func TestFaults_Latency(t *testing.T) {
+	faults := &Faults{Latency: Latency{Mean: 50 * time.Millisecond}, FailureRate: 1}
+
+	start := time.Now()
+	result := call(faults, testPhrase, language.German, language.English)
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Faults should delay responses")
+	}
+
+	if result.Error == nil {
+		t.Error("Faults should fail at a failure rate of 1")
+	}
+}
@@ -0,0 +1,229 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Interaction is a single recorded exchange with the HTTP API of a translation service.
+type Interaction struct {
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	RequestBody  string `json:"requestBody,omitempty"`
+	Status       int    `json:"status"`
+	ContentType  string `json:"contentType,omitempty"`
+	ResponseBody string `json:"responseBody"`
+}
+
+// secretParameters are query parameters and JSON fields holding credentials, which are left out of fixtures
+var secretParameters = []string{"key", "api_key", "apikey", "access_token"}
+
+// redactURL returns a URL without credentials in its query
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, name := range secretParameters {
+		query.Del(name)
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// redactBody returns a request body without credentials. JSON objects are written with sorted keys, so the same
+// request is always recorded the same way.
+func redactBody(body []byte) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return string(body)
+	}
+
+	for _, name := range secretParameters {
+		delete(fields, name)
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// readBody reads and restores the body of a request, so it can still be sent
+func readBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// interactionKey identifies the request of an interaction
+func interactionKey(method, url, body string) string {
+	return method + " " + url + "\n" + body
+}
+
+// Recorder is an http.RoundTripper storing every request and response of the services using it in a fixture
+// file, one interaction per line. The fixtures can be served back by Replay, e.g. in tests that cannot reach the real
+// services. Credentials in query parameters and JSON bodies are left out, headers are not recorded.
+type Recorder struct {
+	// Transport performs the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Path is the file interactions are appended to.
+	Path string
+
+	lock sync.Mutex
+}
+
+// RoundTrip performs a request, and records it with its response.
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	err = r.record(Interaction{
+		Method:       request.Method,
+		URL:          redactURL(request.URL),
+		RequestBody:  redactBody(requestBody),
+		Status:       response.StatusCode,
+		ContentType:  response.Header.Get("Content-Type"),
+		ResponseBody: string(responseBody),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "recorder")
+	}
+
+	return response, nil
+}
+
+// record appends an interaction to the fixture file
+func (r *Recorder) record(interaction Interaction) error {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	file, err := os.OpenFile(r.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replay is an http.RoundTripper serving responses from a fixture file written by Recorder, without calling any real
+// service. Requests that were not recorded fail. If a request was recorded more than once, the last response is served.
+type Replay struct {
+	// Path is the file interactions are read from.
+	Path string
+
+	load         sync.Once
+	interactions map[string]Interaction
+	err          error
+}
+
+// readFixtures reads the interactions stored at path, one per line
+func readFixtures(path string) ([]Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var interactions []Interaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, errors.Wrapf(err, "reading fixtures from %v, line %v", path, number)
+		}
+		interactions = append(interactions, interaction)
+	}
+
+	return interactions, scanner.Err()
+}
+
+// RoundTrip returns the recorded response to a request.
+func (r *Replay) RoundTrip(request *http.Request) (*http.Response, error) {
+	r.load.Do(func() {
+		var interactions []Interaction
+		interactions, r.err = readFixtures(r.Path)
+
+		r.interactions = make(map[string]Interaction)
+		for _, interaction := range interactions {
+			r.interactions[interactionKey(interaction.Method, interaction.URL, interaction.RequestBody)] = interaction
+		}
+	})
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "replay")
+	}
+
+	body, err := readBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction, ok := r.interactions[interactionKey(request.Method, redactURL(request.URL), redactBody(body))]
+	if !ok {
+		return nil, errors.Errorf("replay: no recorded interaction for %v %v", request.Method, redactURL(request.URL))
+	}
+
+	header := http.Header{}
+	if interaction.ContentType != "" {
+		header.Set("Content-Type", interaction.ContentType)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       request,
+	}, nil
+}
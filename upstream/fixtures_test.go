@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixtures.jsonl")
+
+	requests := 0
+	server := newAzureServer(t, &requests)
+	defer server.Close()
+
+	recorder := Azure{ServiceKey: "secret", Region: "westeurope", Endpoint: server.URL,
+		Client: &http.Client{Transport: &Recorder{Path: path}}}
+	result := call(recorder, "test", language.German, language.TraditionalChinese)
+	if result.Error != nil || result.TranslatedPhrase != "TEST" {
+		t.Errorf("Recorder should pass on the response: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	recorder.ServiceKey = "wrong"
+	call(recorder, "failing", language.German, language.TraditionalChinese)
+
+	interactions, err := readFixtures(path)
+	if err != nil || len(interactions) != 2 {
+		t.Fatalf("Recorder should store every request: got %v (%v)", len(interactions), err)
+	}
+	if interactions[0].Status != http.StatusOK || !strings.Contains(interactions[0].ResponseBody, "TEST") {
+		t.Errorf("Recorder should store the response: got %#v", interactions[0])
+	}
+
+	// The server is gone, so translations can only come from the recording
+	server.Close()
+
+	replay := Azure{ServiceKey: "other", Endpoint: server.URL, Client: &http.Client{Transport: &Replay{Path: path}}}
+	result = call(replay, "test", language.German, language.TraditionalChinese)
+	if result.Error != nil || result.TranslatedPhrase != "TEST" {
+		t.Errorf("Replay should return the recorded translation: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	result = call(replay, "failing", language.German, language.TraditionalChinese)
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "not authorized") {
+		t.Errorf("Replay should return recorded errors: got %v", result.Error)
+	}
+
+	result = call(replay, "test", language.German, language.Japanese)
+	if result.Error == nil {
+		t.Error("Replay should fail for requests that were not recorded")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodPost, "https://example.com/translate?q=Hallo&key=secret", nil)
+	if got := redactURL(request.URL); got != "https://example.com/translate?q=Hallo" {
+		t.Errorf("redactURL should leave out keys: got %v", got)
+	}
+
+	if got := redactBody([]byte(`{"q": "Hallo", "api_key": "secret"}`)); got != `{"q":"Hallo"}` {
+		t.Errorf("redactBody should leave out keys: got %v", got)
+	}
+}
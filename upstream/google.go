@@ -4,19 +4,52 @@ import (
 	"cloud.google.com/go/translate"
 	"golang.org/x/net/context"
 	"golang.org/x/text/language"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"net/http"
 )
 
 // Google is a upstream.Service implementation that uses Google Cloud Translation.
 type Google struct {
 	// Personal Access Token, as granted by Google.
-	Key    string
+	Key string
+
+	// HTML makes Google translate phrases as HTML, keeping tags and entities.
+	HTML bool
+
+	// Client is used to perform requests, e.g. to record them. If nil, the library sets up its own.
+	Client *http.Client
+
 	client *translate.Client
 }
 
+// googleKeyTransport adds the API key to requests, which the library leaves to custom clients
+type googleKeyTransport struct {
+	key       string
+	transport http.RoundTripper
+}
+
+func (t googleKeyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	query := request.URL.Query()
+	query.Set("key", t.key)
+	request.URL.RawQuery = query.Encode()
+
+	return t.transport.RoundTrip(request)
+}
+
 // makeGoogleClient sets up the Google Translation Client library
 func (p *Google) makeGoogleClient() error {
-	client, err := translate.NewClient(context.Background(), option.WithAPIKey(p.Key))
+	opt := option.WithAPIKey(p.Key)
+	if p.Client != nil {
+		transport := p.Client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		opt = option.WithHTTPClient(&http.Client{Transport: googleKeyTransport{key: p.Key, transport: transport}})
+	}
+
+	client, err := translate.NewClient(context.Background(), opt)
 	if err != nil {
 		return err
 	}
@@ -47,7 +80,15 @@ func (p Google) Translate(givenPhrase string, givenLang, targetLang language.Tag
 		Format: translate.Text,
 	}
 
+	if p.HTML {
+		opts.Format = translate.HTML
+	}
+
 	result, err := p.client.Translate(context.Background(), []string{givenPhrase}, targetLang, &opts)
+	if apiError, ok := err.(*googleapi.Error); ok && apiError.Code == 400 && unsupportedLanguageMessage.MatchString(apiError.Message) {
+		sendError(out, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "google: " + apiError.Message})
+		return
+	}
 	if err != nil {
 		sendError(out, err)
 		return
@@ -60,3 +101,9 @@ func (p Google) Translate(givenPhrase string, givenLang, targetLang language.Tag
 		TranslatedPhrase: result[0].Text,
 	}
 }
+
+// WithHTML returns a copy of this service translating HTML.
+func (p Google) WithHTML() (Service, bool) {
+	p.HTML = true
+	return p, true
+}
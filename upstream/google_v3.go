@@ -0,0 +1,158 @@
+package upstream
+
+import (
+	translate "cloud.google.com/go/translate/apiv3"
+	"cloud.google.com/go/translate/apiv3/translatepb"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+)
+
+// GoogleAdvanced is a upstream.Service implementation that uses Google Cloud Translation v3 (Advanced).
+// In contrast to Google, it authenticates with application default credentials, e.g. a service account key
+// named by GOOGLE_APPLICATION_CREDENTIALS, and supports custom models and glossaries hosted by Google.
+type GoogleAdvanced struct {
+	// ProjectID is the Google Cloud project requests are billed to.
+	ProjectID string
+
+	// Location is the region models and glossaries are stored in. Defaults to "global",
+	// but custom models and glossaries require a regional location, e.g. us-central1.
+	Location string
+
+	// Model is either "nmt" (the default), the ID of a custom AutoML model, or a full model resource name.
+	Model string
+
+	// Glossary is the ID or full resource name of a glossary to apply, if any.
+	Glossary string
+
+	lock   sync.Mutex
+	client *translate.TranslationClient
+}
+
+// location returns the configured location, or the default
+func (p *GoogleAdvanced) location() string {
+	if p.Location == "" {
+		return "global"
+	}
+
+	return p.Location
+}
+
+// parent returns the resource name of the project and location
+func (p *GoogleAdvanced) parent() string {
+	return "projects/" + p.ProjectID + "/locations/" + p.location()
+}
+
+// resourceName expands an ID to a full resource name of the given collection, unless it is one already
+func (p *GoogleAdvanced) resourceName(collection, id string) string {
+	if strings.HasPrefix(id, "projects/") {
+		return id
+	}
+
+	return p.parent() + "/" + collection + "/" + id
+}
+
+// request builds the TranslateText request for a single phrase of the given MIME type
+func (p *GoogleAdvanced) request(givenPhrase, mimeType string, givenLang, targetLang language.Tag) *translatepb.TranslateTextRequest {
+	model := p.Model
+	if model == "" || model == "nmt" {
+		model = "general/nmt"
+	}
+
+	request := &translatepb.TranslateTextRequest{
+		Parent:             p.parent(),
+		Contents:           []string{givenPhrase},
+		MimeType:           mimeType,
+		SourceLanguageCode: givenLang.String(),
+		TargetLanguageCode: targetLang.String(),
+		Model:              p.resourceName("models", model),
+	}
+
+	if p.Glossary != "" {
+		request.GlossaryConfig = &translatepb.TranslateTextGlossaryConfig{
+			Glossary: p.resourceName("glossaries", p.Glossary),
+		}
+	}
+
+	return request
+}
+
+// getClient returns the client, setting it up on first use
+func (p *GoogleAdvanced) getClient() (*translate.TranslationClient, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	client, err := translate.NewTranslationClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = client
+	return client, nil
+}
+
+// Translate translates the given text using the Google Cloud Translation v3 API.
+// If a glossary is configured, the glossary-aware translation is returned.
+func (p *GoogleAdvanced) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	p.translate(givenPhrase, "text/plain", givenLang, targetLang, out)
+}
+
+// WithHTML returns this service translating HTML, sharing its client.
+func (p *GoogleAdvanced) WithHTML() (Service, bool) {
+	return googleAdvancedHTML{p}, true
+}
+
+// googleAdvancedHTML translates phrases as HTML with a GoogleAdvanced service
+type googleAdvancedHTML struct {
+	*GoogleAdvanced
+}
+
+func (p googleAdvancedHTML) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	p.translate(givenPhrase, "text/html", givenLang, targetLang, out)
+}
+
+// translate performs a TranslateText call for a phrase of the given MIME type
+func (p *GoogleAdvanced) translate(givenPhrase, mimeType string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	client, err := p.getClient()
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+
+	response, err := client.TranslateText(context.Background(), p.request(givenPhrase, mimeType, givenLang, targetLang))
+	if s, ok := status.FromError(err); ok && s.Code() == codes.InvalidArgument && unsupportedLanguageMessage.MatchString(s.Message()) {
+		sendError(out, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "google: " + s.Message()})
+		return
+	}
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+
+	translations := response.GetTranslations()
+	if len(response.GetGlossaryTranslations()) > 0 {
+		translations = response.GetGlossaryTranslations()
+	}
+
+	if len(translations) == 0 {
+		sendError(out, errors.New("google: response contains no translation"))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: translations[0].GetTranslatedText(),
+	}
+}
@@ -0,0 +1,62 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"testing"
+)
+
+func TestGoogleAdvanced_RequestDefaults(t *testing.T) {
+	service := GoogleAdvanced{ProjectID: "test"}
+	request := service.request(testPhrase, "text/plain", language.German, language.English)
+
+	if request.Parent != "projects/test/locations/global" {
+		t.Errorf("GoogleAdvanced should default to the global location: got %v", request.Parent)
+	}
+
+	if request.Model != "projects/test/locations/global/models/general/nmt" {
+		t.Errorf("GoogleAdvanced should default to the NMT model: got %v", request.Model)
+	}
+
+	if request.GlossaryConfig != nil {
+		t.Error("GoogleAdvanced should not send a glossary unless configured")
+	}
+
+	if request.SourceLanguageCode != "de" || request.TargetLanguageCode != "en" || request.Contents[0] != testPhrase {
+		t.Errorf("GoogleAdvanced built a malformed request: %v", request)
+	}
+}
+
+func TestGoogleAdvanced_RequestCustom(t *testing.T) {
+	service := GoogleAdvanced{
+		ProjectID: "test",
+		Location:  "us-central1",
+		Model:     "TRL123",
+		Glossary:  "projects/other/locations/us-central1/glossaries/brands",
+	}
+	request := service.request(testPhrase, "text/plain", language.German, language.English)
+
+	if request.Model != "projects/test/locations/us-central1/models/TRL123" {
+		t.Errorf("GoogleAdvanced should expand custom model IDs: got %v", request.Model)
+	}
+
+	if request.GlossaryConfig == nil || request.GlossaryConfig.Glossary != service.Glossary {
+		t.Errorf("GoogleAdvanced should keep full glossary resource names: got %v", request.GlossaryConfig)
+	}
+}
+
+func TestGoogleAdvanced_WithHTML(t *testing.T) {
+	service := &GoogleAdvanced{ProjectID: "test"}
+
+	htmlService, ok := service.WithHTML()
+	if !ok {
+		t.Fatal("GoogleAdvanced should support HTML")
+	}
+
+	if native, ok := htmlService.(googleAdvancedHTML); !ok || native.GoogleAdvanced != service {
+		t.Errorf("WithHTML should share the service and its client: got %#v", htmlService)
+	}
+
+	if request := service.request("<b>Hallo</b>", "text/html", language.German, language.English); request.MimeType != "text/html" {
+		t.Errorf("GoogleAdvanced should request HTML translation: got %v", request.MimeType)
+	}
+}
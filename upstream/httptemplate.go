@@ -0,0 +1,405 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// HTTPTemplate is a upstream.Service implementation that is configured declaratively, rather than in code.
+// The request is rendered from text/template strings, and the translation extracted from the response
+// using a JSONPath (starting with "$") or XPath (starting with "/") expression.
+//
+// Templates are executed with a TemplateData value, and may use the functions query, json, xml and env.
+type HTTPTemplate struct {
+	// Name identifies the provider in logs.
+	Name string `json:"name"`
+
+	// URL is a template for the request URL.
+	URL string `json:"url"`
+
+	// Method is the HTTP method to use, POST if empty.
+	Method string `json:"method"`
+
+	// Headers maps header names to value templates.
+	Headers map[string]string `json:"headers"`
+
+	// Body is a template for the request body. No body is sent if empty.
+	Body string `json:"body"`
+
+	// Extract is the JSONPath or XPath expression selecting the translation in the response.
+	Extract string `json:"extract"`
+
+	// Client is used to perform requests. If nil, http.DefaultClient is used.
+	Client *http.Client `json:"-"`
+}
+
+// TemplateData is passed to the templates of a HTTPTemplate.
+type TemplateData struct {
+	Text string
+
+	// Source and Target are BCP 47 tags, e.g. de-CH
+	Source string
+	Target string
+
+	// SourceBase and TargetBase are ISO 639 language codes, e.g. de
+	SourceBase string
+	TargetBase string
+}
+
+var templateFuncs = template.FuncMap{
+	"query": url.QueryEscape,
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"xml": func(value string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(value))
+		return buf.String()
+	},
+	"env": os.Getenv,
+}
+
+// LoadHTTPTemplates reads a JSON array of HTTPTemplate configurations from a file, and validates them.
+func LoadHTTPTemplates(path string) ([]HTTPTemplate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var templates []HTTPTemplate
+	err = json.NewDecoder(file).Decode(&templates)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading http templates from %v", path)
+	}
+
+	for _, h := range templates {
+		if err := h.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+// Validate checks that all templates and the extraction path are well-formed.
+func (h HTTPTemplate) Validate() error {
+	if h.URL == "" {
+		return errors.Errorf("http template %v: url is required", h.Name)
+	}
+
+	for _, text := range h.templates() {
+		if _, err := template.New(h.Name).Funcs(templateFuncs).Parse(text); err != nil {
+			return errors.Wrapf(err, "http template %v", h.Name)
+		}
+	}
+
+	if !strings.HasPrefix(h.Extract, "$") && !strings.HasPrefix(h.Extract, "/") {
+		return errors.Errorf("http template %v: extract must be a JSONPath ($...) or XPath (/...) expression", h.Name)
+	}
+
+	return nil
+}
+
+// templates returns all template strings of the configuration
+func (h HTTPTemplate) templates() []string {
+	texts := []string{h.URL, h.Body}
+	for _, value := range h.Headers {
+		texts = append(texts, value)
+	}
+
+	return texts
+}
+
+// render executes a single template string
+func (h HTTPTemplate) render(text string, data TemplateData) (string, error) {
+	tmpl, err := template.New(h.Name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
+// newRequest renders the templates into an HTTP request
+func (h HTTPTemplate) newRequest(data TemplateData) (*http.Request, error) {
+	requestURL, err := h.render(h.URL, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if h.Body != "" {
+		rendered, err := h.render(h.Body, data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	request, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range h.Headers {
+		rendered, err := h.render(value, data)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set(name, rendered)
+	}
+
+	return request, nil
+}
+
+// Translate renders and sends the configured request, then extracts the translation from the response.
+func (h HTTPTemplate) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	sourceBase, _ := givenLang.Base()
+	targetBase, _ := targetLang.Base()
+
+	request, err := h.newRequest(TemplateData{
+		Text:       givenPhrase,
+		Source:     givenLang.String(),
+		Target:     targetLang.String(),
+		SourceBase: sourceBase.String(),
+		TargetBase: targetBase.String(),
+	})
+	if err != nil {
+		sendError(out, errors.Wrapf(err, "http template %v", h.Name))
+		return
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	defer response.Body.Close()
+
+	var buf bytes.Buffer
+	buf.ReadFrom(response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		log.Printf("%v API returned error: %v", h.Name, buf.String())
+		sendError(out, errors.Errorf("http template %v: %v", h.Name, response.Status))
+		return
+	}
+
+	var translated string
+	if strings.HasPrefix(h.Extract, "/") {
+		translated, err = extractXPath(buf.Bytes(), h.Extract)
+	} else {
+		translated, err = extractJSONPath(buf.Bytes(), h.Extract)
+	}
+	if err != nil {
+		sendError(out, errors.Wrapf(err, "http template %v", h.Name))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: translated,
+	}
+}
+
+// extractJSONPath evaluates a simple JSONPath expression, supporting member access ($.a.b or $['a'])
+// and array indices ($.a[0]). The selected value must be a string.
+func extractJSONPath(document []byte, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return "", err
+	}
+
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		var key string
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], rest[end:]
+
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return "", errors.Errorf("unterminated bracket in %v", path)
+			}
+			key, rest = strings.Trim(rest[1:end], `'"`), rest[end+1:]
+
+		default:
+			return "", errors.Errorf("invalid JSONPath %v", path)
+		}
+
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", errors.Errorf("%v: index %v out of range", path, key)
+			}
+			value = node[index]
+		default:
+			return "", errors.Errorf("%v: cannot select %v from %T", path, key, value)
+		}
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return "", errors.Errorf("%v: selected %T, not a string", path, value)
+	}
+
+	return text, nil
+}
+
+// xmlNode is a minimal DOM used for evaluating XPath expressions
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// parseXML builds a tree of xmlNodes, returning a virtual root node containing the document element
+func parseXML(document []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			for _, node := range stack {
+				node.text.Write(t)
+			}
+		}
+	}
+}
+
+// extractXPath evaluates a simple XPath expression, supporting child (/a/b) and descendant (//b) steps,
+// wildcards, 1-based positions (b[2]), attributes (@id) and text(). The text of the first match is returned.
+func extractXPath(document []byte, path string) (string, error) {
+	root, err := parseXML(document)
+	if err != nil {
+		return "", err
+	}
+
+	nodes := []*xmlNode{root}
+	descendant := false
+	for _, step := range strings.Split(path, "/")[1:] {
+		if step == "" {
+			descendant = true
+			continue
+		}
+
+		if step == "text()" {
+			break
+		}
+
+		if strings.HasPrefix(step, "@") {
+			for _, node := range nodes {
+				if value, ok := node.attrs[step[1:]]; ok {
+					return value, nil
+				}
+			}
+			return "", errors.Errorf("%v: attribute not found", path)
+		}
+
+		name, position := step, 0
+		if open := strings.Index(step, "["); open >= 0 && strings.HasSuffix(step, "]") {
+			name = step[:open]
+			position, err = strconv.Atoi(step[open+1 : len(step)-1])
+			if err != nil || position < 1 {
+				return "", errors.Errorf("invalid position in %v", path)
+			}
+		}
+
+		var matches []*xmlNode
+		for _, node := range nodes {
+			matches = append(matches, node.find(name, position, descendant)...)
+		}
+		nodes, descendant = matches, false
+	}
+
+	if len(nodes) == 0 {
+		return "", errors.Errorf("%v: no matching element", path)
+	}
+
+	return nodes[0].text.String(), nil
+}
+
+// find returns the children (or descendants) matching name, optionally restricted to a 1-based position
+func (n *xmlNode) find(name string, position int, descendant bool) []*xmlNode {
+	var matches []*xmlNode
+	for _, child := range n.children {
+		if name == "*" || child.name == name {
+			matches = append(matches, child)
+		}
+	}
+
+	if position > 0 {
+		if position > len(matches) {
+			matches = nil
+		} else {
+			matches = matches[position-1 : position]
+		}
+	}
+
+	if descendant {
+		for _, child := range n.children {
+			matches = append(matches, child.find(name, position, true)...)
+		}
+	}
+
+	return matches
+}
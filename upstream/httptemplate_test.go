@@ -0,0 +1,125 @@
+package upstream
+
+import (
+	"fmt"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPTemplate_Translate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Key") != "secret-de" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/json" {
+			if string(body) != `{"q":"TESTPHRASE","to":"en"}` {
+				t.Errorf("HTTPTemplate rendered wrong body: %s", body)
+			}
+			fmt.Fprintf(w, `{"data":{"translations":[{"text":"json %v"}]}}`, r.URL.Query().Get("from"))
+			return
+		}
+
+		fmt.Fprint(w, `<?xml version="1.0"?><response><result lang="en"><text>first</text></result>`+
+			`<result lang="fr"><text>xml &amp; more</text></result></response>`)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		template HTTPTemplate
+		want     string
+	}{
+		{
+			HTTPTemplate{
+				Name:    "json",
+				URL:     server.URL + "/json?from={{query .Source}}",
+				Headers: map[string]string{"X-Key": "secret-{{.SourceBase}}"},
+				Body:    `{"q":{{json .Text}},"to":"{{.TargetBase}}"}`,
+				Extract: "$.data.translations[0]['text']",
+			},
+			"json de-CH",
+		},
+		{
+			HTTPTemplate{
+				Name:    "xml",
+				URL:     server.URL + "/xml",
+				Method:  http.MethodGet,
+				Headers: map[string]string{"X-Key": "secret-de"},
+				Extract: "//result[2]/text/text()",
+			},
+			"xml & more",
+		},
+	}
+
+	for _, c := range cases {
+		if err := c.template.Validate(); err != nil {
+			t.Errorf("HTTPTemplate %v should be valid: %v", c.template.Name, err)
+		}
+
+		out := make(chan Result)
+		go c.template.Translate(testPhrase, language.MustParse("de-CH"), language.English, &out)
+
+		select {
+		case result := <-out:
+			if result.Error != nil {
+				t.Errorf("HTTPTemplate %v returned error when it shouldn't have: %v", c.template.Name, result.Error)
+			}
+
+			if result.TranslatedPhrase != c.want {
+				t.Errorf("HTTPTemplate %v returned incorrect result: want %v, got %v", c.template.Name, c.want, result.TranslatedPhrase)
+			}
+
+		case <-time.After(time.Second):
+			t.Error("operation timed out when it should have returned")
+		}
+	}
+}
+
+func TestExtractXPath(t *testing.T) {
+	document := []byte(`<a><b id="1">one</b><c><b id="2">two</b></c></a>`)
+	cases := map[string]string{
+		"/a/b":        "one",
+		"/a/c/b":      "two",
+		"//c/b/@id":   "2",
+		"/a/*[2]":     "two",
+		"/a/b/@id":    "1",
+		"//b[1]":      "one",
+		"/a/c/text()": "two",
+	}
+
+	for path, want := range cases {
+		got, err := extractXPath(document, path)
+		if err != nil || got != want {
+			t.Errorf("extractXPath(%v): want %v, got %v (%v)", path, want, got, err)
+		}
+	}
+
+	if _, err := extractXPath(document, "/a/d"); err == nil {
+		t.Error("extractXPath should return an error if nothing matches")
+	}
+}
+
+func TestLoadHTTPTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "templates.json")
+	ioutil.WriteFile(path, []byte(`[{"name": "broken", "url": "http://localhost/{{.Text", "extract": "$.text"}]`), 0600)
+
+	_, err = LoadHTTPTemplates(path)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("LoadHTTPTemplates should reject malformed templates: got %v", err)
+	}
+}
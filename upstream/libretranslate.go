@@ -0,0 +1,118 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// LibreTranslate is a upstream.Service implementation that calls a (self-hosted) LibreTranslate instance.
+type LibreTranslate struct {
+	// BaseURL is the address of the LibreTranslate instance, e.g. http://localhost:5000
+	BaseURL string
+
+	// APIKey is sent along with every request, if the instance requires one.
+	APIKey string
+
+	// HTML makes LibreTranslate translate phrases as HTML, keeping tags and entities.
+	HTML bool
+
+	// Client is used to perform requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+type libreRequest struct {
+	Query  string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type libreResponse struct {
+	TranslatedText string `json:"translatedText"`
+	Error          string `json:"error"`
+}
+
+// libreLanguage converts a language tag to the code LibreTranslate expects.
+// LibreTranslate mostly uses bare ISO 639-1 codes, with the exception of Chinese scripts.
+func libreLanguage(tag language.Tag) string {
+	base, _ := tag.Base()
+	if base.String() == "zh" {
+		if script, _ := tag.Script(); script.String() == "Hant" {
+			return "zt"
+		}
+	}
+
+	return base.String()
+}
+
+// Translate translates the given text by calling the /translate endpoint of a LibreTranslate instance.
+func (l LibreTranslate) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	format := "text"
+	if l.HTML {
+		format = "html"
+	}
+
+	body, err := json.Marshal(libreRequest{
+		Query:  givenPhrase,
+		Source: libreLanguage(givenLang),
+		Target: libreLanguage(targetLang),
+		Format: format,
+		APIKey: l.APIKey,
+	})
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	endpoint := strings.TrimSuffix(l.BaseURL, "/") + "/translate"
+	response, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	defer response.Body.Close()
+
+	result := libreResponse{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+
+	if response.StatusCode != http.StatusOK {
+		log.Printf("LibreTranslate API returned error: %v", result.Error)
+		if response.StatusCode == http.StatusBadRequest && unsupportedLanguageMessage.MatchString(result.Error) {
+			sendError(out, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "libretranslate: " + result.Error})
+			return
+		}
+		sendError(out, errors.Errorf("libretranslate: %v: %v", response.Status, result.Error))
+		return
+	}
+
+	if err != nil {
+		sendError(out, errors.Wrap(err, "libretranslate: invalid response"))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: result.TranslatedText,
+	}
+}
+
+// WithHTML returns a copy of this service translating HTML.
+func (l LibreTranslate) WithHTML() (Service, bool) {
+	l.HTML = true
+	return l, true
+}
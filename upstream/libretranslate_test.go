@@ -0,0 +1,120 @@
+package upstream
+
+import (
+	"encoding/json"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newLibreServer starts a fake LibreTranslate instance that upper-cases its input
+func newLibreServer(t *testing.T, apiKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/translate" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		request := libreRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("LibreTranslate should send a JSON body: %v", err)
+		}
+
+		if request.APIKey != apiKey {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(libreResponse{Error: "Invalid API key"})
+			return
+		}
+
+		if request.Source != "de" || request.Target != "en" {
+			t.Errorf("LibreTranslate sent wrong languages: got %v -> %v", request.Source, request.Target)
+		}
+
+		json.NewEncoder(w).Encode(libreResponse{TranslatedText: request.Query + "!"})
+	}))
+}
+
+func TestLibreTranslate_Translate(t *testing.T) {
+	server := newLibreServer(t, "secret")
+	defer server.Close()
+
+	service := LibreTranslate{BaseURL: server.URL + "/", APIKey: "secret"}
+	out := make(chan Result)
+	go service.Translate(testPhrase, language.German, language.English, &out)
+
+	select {
+	case result := <-out:
+		if result.Error != nil {
+			t.Errorf("LibreTranslate returned error when it shouldn't have: %v", result.Error)
+		}
+
+		if result.TranslatedPhrase != testPhrase+"!" {
+			t.Errorf("LibreTranslate returned incorrect result: want %v, got %v", testPhrase+"!", result.TranslatedPhrase)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+}
+
+func TestLibreTranslate_TranslateRejected(t *testing.T) {
+	server := newLibreServer(t, "secret")
+	defer server.Close()
+
+	service := LibreTranslate{BaseURL: server.URL}
+	out := make(chan Result)
+	go service.Translate(testPhrase, language.German, language.English, &out)
+
+	select {
+	case result := <-out:
+		if result.Error == nil {
+			t.Error("LibreTranslate should return an error when the instance rejects the request")
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+}
+
+func TestLibreLanguage(t *testing.T) {
+	cases := map[string]string{
+		"de-CH":   "de",
+		"en":      "en",
+		"zh-Hans": "zh",
+		"zh-TW":   "zt",
+	}
+
+	for given, want := range cases {
+		if got := libreLanguage(language.MustParse(given)); got != want {
+			t.Errorf("libreLanguage(%v): want %v, got %v", given, want, got)
+		}
+	}
+}
+
+func TestLibreTranslate_WithHTML(t *testing.T) {
+	format := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := libreRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		format = request.Format
+		json.NewEncoder(w).Encode(libreResponse{TranslatedText: request.Query})
+	}))
+	defer server.Close()
+
+	service, ok := LibreTranslate{BaseURL: server.URL}.WithHTML()
+	if !ok {
+		t.Fatal("LibreTranslate should support HTML")
+	}
+
+	out := make(chan Result)
+	go service.Translate("<p>Hallo</p>", language.German, language.English, &out)
+	if result := <-out; result.Error != nil {
+		t.Errorf("LibreTranslate returned error when it shouldn't have: %v", result.Error)
+	}
+
+	if format != "html" {
+		t.Errorf("LibreTranslate should request the html format: got %q", format)
+	}
+}
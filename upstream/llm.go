@@ -0,0 +1,222 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LLM is a upstream.Service implementation that prompts a chat-completion model for translations.
+// Any server implementing the OpenAI chat completions API can be used, including local ones.
+type LLM struct {
+	// BaseURL is the API root, e.g. https://api.openai.com/v1 or http://localhost:11434/v1
+	BaseURL string
+
+	// APIKey is sent as a bearer token, if set.
+	APIKey string
+
+	// Model is the name of the model to prompt.
+	Model string
+
+	// Style is an optional instruction on tone and register, e.g. "informal, friendly".
+	Style string
+
+	// Glossary maps source terms to the translation the model must use.
+	Glossary map[string]string
+
+	// Client is used to perform requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var (
+	// thinkingBlock matches reasoning output some local models emit before answering
+	thinkingBlock = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+	// codeFence matches an answer wrapped in a Markdown code block
+	codeFence = regexp.MustCompile("(?s)^```[a-zA-Z]*\\n(.*?)\\n?```$")
+
+	// preamble matches introductions like "Here is the translation:" or "Translation:", but not a translation starting
+	// with "Here is the list:"
+	preamble = regexp.MustCompile(`(?i)^(sure|certainly|of course)\b[^\n]*:\s*\n|^(here is|here's)[^\n]*\b(translation|you go)\b[^\n]*:\s*\n|^translation\s*:\s*`)
+)
+
+// languageName returns an English name for tag that a model will understand, e.g. "German (Switzerland)"
+func languageName(tag language.Tag) string {
+	name := display.English.Tags().Name(tag)
+	if name == "" {
+		return tag.String()
+	}
+
+	return fmt.Sprintf("%v [%v]", name, tag)
+}
+
+// prompt builds the system prompt instructing the model how to translate
+func (l LLM) prompt(givenLang, targetLang language.Tag) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "You are a professional translator. Translate the user's message from %v to %v.\n",
+		languageName(givenLang), languageName(targetLang))
+	builder.WriteString("Reply with the translation only. Do not add explanations, notes, quotes or formatting " +
+		"that is not present in the original. Keep line breaks, placeholders and markup unchanged.\n")
+
+	if l.Style != "" {
+		fmt.Fprintf(&builder, "Style: %v\n", l.Style)
+	}
+
+	if len(l.Glossary) > 0 {
+		terms := make([]string, 0, len(l.Glossary))
+		for source := range l.Glossary {
+			terms = append(terms, source)
+		}
+		sort.Strings(terms)
+
+		builder.WriteString("Always use these translations for the following terms:\n")
+		for _, source := range terms {
+			fmt.Fprintf(&builder, "- %v => %v\n", source, l.Glossary[source])
+		}
+	}
+
+	return builder.String()
+}
+
+// cleanCompletion removes chatter models tend to add around the actual translation
+func cleanCompletion(givenPhrase, completion string) string {
+	completion = thinkingBlock.ReplaceAllString(completion, "")
+	completion = strings.TrimSpace(completion)
+
+	if match := codeFence.FindStringSubmatch(completion); match != nil && !strings.Contains(givenPhrase, "```") {
+		completion = strings.TrimSpace(match[1])
+	}
+
+	if !preamble.MatchString(strings.TrimSpace(givenPhrase)) {
+		completion = strings.TrimSpace(preamble.ReplaceAllString(completion, ""))
+	}
+
+	for _, quotes := range []string{`""`, "“”", "«»", "„“", "''"} {
+		opening, closing := string([]rune(quotes)[0]), string([]rune(quotes)[1])
+		if strings.HasPrefix(completion, opening) && strings.HasSuffix(completion, closing) && len(completion) > len(opening+closing) &&
+			!strings.HasPrefix(strings.TrimSpace(givenPhrase), opening) {
+			completion = strings.TrimSpace(completion[len(opening) : len(completion)-len(closing)])
+			break
+		}
+	}
+
+	return completion
+}
+
+// Translate translates the given text by prompting a chat-completion model.
+func (l LLM) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	body, err := json.Marshal(chatRequest{
+		Model: l.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: l.prompt(givenLang, targetLang)},
+			{Role: "user", Content: givenPhrase},
+		},
+	})
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(l.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if l.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+l.APIKey)
+	}
+
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		sendError(out, err)
+		return
+	}
+	defer response.Body.Close()
+
+	result := chatResponse{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+
+	if response.StatusCode != http.StatusOK {
+		message := ""
+		if result.Error != nil {
+			message = result.Error.Message
+		}
+		log.Printf("LLM API returned error: %v", message)
+		sendError(out, errors.Errorf("llm: %v: %v", response.Status, message))
+		return
+	}
+
+	if err != nil {
+		sendError(out, errors.Wrap(err, "llm: invalid response"))
+		return
+	}
+
+	if len(result.Choices) == 0 {
+		sendError(out, errors.New("llm: response contains no choices"))
+		return
+	}
+
+	translated := cleanCompletion(givenPhrase, result.Choices[0].Message.Content)
+	if translated == "" && strings.TrimSpace(givenPhrase) != "" {
+		sendError(out, errors.New("llm: model returned an empty translation"))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: translated,
+	}
+}
+
+// WithGlossary returns a copy of this service whose prompt includes the given terms.
+func (l LLM) WithGlossary(terms map[string]string) (Service, bool) {
+	merged := make(map[string]string, len(l.Glossary)+len(terms))
+	for source, target := range l.Glossary {
+		merged[source] = target
+	}
+	for source, target := range terms {
+		merged[source] = target
+	}
+
+	l.Glossary = merged
+	return l, true
+}
@@ -0,0 +1,108 @@
+package upstream
+
+import (
+	"encoding/json"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLLM_Translate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "invalid key"}})
+			return
+		}
+
+		request := chatRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if request.Model != "test-model" || len(request.Messages) != 2 {
+			t.Errorf("LLM sent malformed request: %#v", request)
+		}
+
+		system := request.Messages[0].Content
+		for _, want := range []string{"German", "English", "Style: formal", "- Schmetterling => butterfly"} {
+			if !strings.Contains(system, want) {
+				t.Errorf("LLM prompt should contain %q: got %v", want, system)
+			}
+		}
+
+		response := chatResponse{}
+		response.Choices = append(response.Choices, struct {
+			Message chatMessage `json:"message"`
+		}{chatMessage{Role: "assistant", Content: "Here is the translation:\n\"" + request.Messages[1].Content + "\""}})
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	service := LLM{
+		BaseURL:  server.URL + "/v1",
+		APIKey:   "secret",
+		Model:    "test-model",
+		Style:    "formal",
+		Glossary: map[string]string{"Schmetterling": "butterfly"},
+	}
+
+	out := make(chan Result)
+	go service.Translate(testPhrase, language.German, language.English, &out)
+
+	select {
+	case result := <-out:
+		if result.Error != nil {
+			t.Errorf("LLM returned error when it shouldn't have: %v", result.Error)
+		}
+
+		if result.TranslatedPhrase != testPhrase {
+			t.Errorf("LLM should strip model chatter: want %v, got %v", testPhrase, result.TranslatedPhrase)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+
+	service.APIKey = "wrong"
+	out = make(chan Result)
+	go service.Translate(testPhrase, language.German, language.English, &out)
+
+	select {
+	case result := <-out:
+		if result.Error == nil {
+			t.Error("LLM should return an error when the API rejects the request")
+		}
+
+	case <-time.After(time.Second):
+		t.Error("operation timed out when it should have returned")
+	}
+}
+
+func TestCleanCompletion(t *testing.T) {
+	cases := []struct {
+		given, completion, want string
+	}{
+		{"Hallo", "Hello", "Hello"},
+		{"Hallo", "  Translation: Hello\n", "Hello"},
+		{"Hallo", "<think>The user wants English.</think>\nHello", "Hello"},
+		{"Hallo", "```\nHello\n```", "Hello"},
+		{"Hallo", "“Hello”", "Hello"},
+		{"\"Hallo\"", "\"Hello\"", "\"Hello\""},
+		{"Hallo", "Sure! Here you go:\nHello", "Hello"},
+		{"Hier ist die Liste:\n- Eins", "Here is the list:\n- One", "Here is the list:\n- One"},
+		{"Translation: Übersetzung", "Translation: Translation", "Translation: Translation"},
+	}
+
+	for _, c := range cases {
+		if got := cleanCompletion(c.given, c.completion); got != c.want {
+			t.Errorf("cleanCompletion(%q): want %q, got %q", c.completion, c.want, got)
+		}
+	}
+}
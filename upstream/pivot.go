@@ -0,0 +1,128 @@
+package upstream
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"log"
+)
+
+// Pivot wraps services to translate through an intermediate language, when direct translation is unavailable.
+// Many language pairs, e.g. Thai to Swahili, are unsupported or translate poorly, while both legs via English work well.
+// Only services reporting an UnsupportedLanguageError are pivoted; other errors, like timeouts or outages, are
+// returned, so a failing service is not called twice more.
+type Pivot struct {
+	// Direct is tried first, if set. Pivoting only happens if it does not support the language pair.
+	Direct Service
+
+	// Handler translates both legs, source to pivot and pivot to target.
+	Handler Service
+
+	// Via is the intermediate language. Defaults to English.
+	Via language.Tag
+}
+
+// via returns the configured pivot language, or the default
+func (p Pivot) via() language.Tag {
+	if p.Via == language.Und {
+		return language.English
+	}
+
+	return p.Via
+}
+
+// sameBase reports whether two tags share a base language
+func sameBase(a, b language.Tag) bool {
+	baseA, _ := a.Base()
+	baseB, _ := b.Base()
+	return baseA == baseB
+}
+
+// Translate tries the direct service, then translates source to pivot and pivot to target.
+// Pivoted results have their Pivot field set.
+func (p Pivot) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	var directErr error
+	if p.Direct != nil {
+		result := call(p.Direct, givenPhrase, givenLang, targetLang)
+		if result.Error == nil {
+			*out <- result
+			return
+		}
+		directErr = result.Error
+
+		if !IsUnsupportedLanguage(directErr) {
+			sendError(out, directErr)
+			return
+		}
+	}
+
+	via := p.via()
+	if p.Handler == nil || sameBase(givenLang, via) || sameBase(targetLang, via) {
+		if directErr == nil {
+			directErr = errors.New("pivot: no service to translate with")
+		}
+		sendError(out, directErr)
+		return
+	}
+
+	log.Printf("pivoting translation %v -> %v via %v (direct translation failed: %v)", givenLang, targetLang, via, directErr)
+
+	first := call(p.Handler, givenPhrase, givenLang, via)
+	if first.Error != nil {
+		sendError(out, errors.Wrapf(first.Error, "pivot: %v -> %v", givenLang, via))
+		return
+	}
+
+	second := call(p.Handler, first.TranslatedPhrase, via, targetLang)
+	if second.Error != nil {
+		sendError(out, errors.Wrapf(second.Error, "pivot: %v -> %v", via, targetLang))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: second.TranslatedPhrase,
+		Pivot:            via,
+	}
+}
+
+// WithGlossary returns a copy of this pivot whose direct service uses the glossary, if it supports it. The copy does
+// not pivot, as the terms do not apply to the intermediate language; Terminology falls back to placeholders for
+// language pairs the direct service does not support.
+func (p Pivot) WithGlossary(terms map[string]string) (Service, bool) {
+	native, ok := p.Direct.(GlossaryService)
+	if !ok {
+		return nil, false
+	}
+
+	direct, ok := native.WithGlossary(terms)
+	if !ok {
+		return nil, false
+	}
+
+	return Pivot{Direct: direct, Via: p.Via}, true
+}
+
+// WithHTML returns a copy of this pivot translating HTML, if all of its services support it.
+func (p Pivot) WithHTML() (Service, bool) {
+	html := p
+	for _, svc := range []*Service{&html.Direct, &html.Handler} {
+		if *svc == nil {
+			continue
+		}
+
+		native, ok := (*svc).(HTMLService)
+		if !ok {
+			return nil, false
+		}
+
+		if *svc, ok = native.WithHTML(); !ok {
+			return nil, false
+		}
+	}
+
+	return html, true
+}
@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"errors"
+	"golang.org/x/text/language"
+	"testing"
+)
+
+var (
+	thai    = language.Thai
+	swahili = language.Swahili
+)
+
+// pairService appends the target language to phrases, but fails for one unsupported language pair
+type pairService struct {
+	from, to language.Tag
+}
+
+func (p pairService) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	if givenLang == p.from && targetLang == p.to {
+		sendError(out, &UnsupportedLanguageError{GivenLang: givenLang, TargetLang: targetLang, Message: "not supported"})
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: givenPhrase + "|" + targetLang.String(),
+	}
+}
+
+func TestPivot_Translate(t *testing.T) {
+	svc := pairService{thai, swahili}
+	pivot := Pivot{Direct: svc, Handler: svc}
+
+	result := call(pivot, testPhrase, thai, swahili)
+	if result.Error != nil {
+		t.Fatalf("Pivot returned error when it shouldn't have: %v", result.Error)
+	}
+
+	if result.TranslatedPhrase != testPhrase+"|en|sw" {
+		t.Errorf("Pivot should translate via English: got %v", result.TranslatedPhrase)
+	}
+
+	if result.Pivot != language.English {
+		t.Errorf("Pivot should mark pivoted results: got %v", result.Pivot)
+	}
+
+	result = call(pivot, testPhrase, thai, language.German)
+	if result.Error != nil || result.TranslatedPhrase != testPhrase+"|de" || result.Pivot != language.Und {
+		t.Errorf("Pivot should prefer direct translations: got %v via %v (%v)", result.TranslatedPhrase, result.Pivot, result.Error)
+	}
+}
+
+func TestPivot_TranslateNoPivot(t *testing.T) {
+	svc := pairService{thai, language.English}
+	pivot := Pivot{Direct: svc, Handler: svc}
+
+	result := call(pivot, testPhrase, thai, language.English)
+	if result.Error == nil {
+		t.Error("Pivot should not pivot through the target language")
+	}
+
+	pivot = Pivot{Direct: svc, Handler: svc, Via: language.French}
+	result = call(pivot, testPhrase, thai, language.English)
+	if result.Error != nil || result.Pivot != language.French {
+		t.Errorf("Pivot should use the configured language: got %v (%v)", result.Pivot, result.Error)
+	}
+}
+
+func TestPivot_TranslateFailing(t *testing.T) {
+	calls := 0
+	failing := countingService{calls: &calls, err: errors.New("service unavailable")}
+	pivot := Pivot{Direct: failing, Handler: failing}
+
+	result := call(pivot, testPhrase, thai, swahili)
+	if result.Error == nil || calls != 1 {
+		t.Errorf("Pivot should not pivot when the direct translation fails for other reasons: got %v calls (%v)", calls, result.Error)
+	}
+}
+
+// countingService counts its calls, and fails with err
+type countingService struct {
+	calls *int
+	err   error
+}
+
+func (c countingService) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+	*c.calls++
+	sendError(out, c.err)
+}
@@ -0,0 +1,365 @@
+package upstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPluginTimeout        = 5 * time.Second
+	defaultPluginHealthInterval = 30 * time.Second
+	defaultPluginRestartDelay   = time.Second
+)
+
+// PluginRequest is sent to a plugin as a single line of JSON on its standard input.
+// Method is either "translate" or "health".
+type PluginRequest struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+	Text   string `json:"text,omitempty"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// PluginResponse is written by a plugin as a single line of JSON on its standard output.
+// Responses may arrive in any order, and are matched to requests by ID.
+type PluginResponse struct {
+	ID    uint64 `json:"id"`
+	Text  string `json:"text,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Plugin is a upstream.Service implementation backed by an external program, so providers can be added
+// without recompiling translate-server. The program is started on first use, restarted when it exits,
+// and killed when it fails a health check. See plugins/uppercase for a sample.
+type Plugin struct {
+	// Command is the path of the plugin executable.
+	Command string
+	Args    []string
+
+	// Timeout limits how long a single request may take. Defaults to 5 seconds.
+	Timeout time.Duration
+
+	// HealthInterval is the time between health checks. Defaults to 30 seconds.
+	HealthInterval time.Duration
+
+	// RestartDelay is the time to wait before restarting a plugin that exited. Defaults to 1 second.
+	RestartDelay time.Duration
+
+	lock    sync.Mutex
+	current *pluginProcess
+	stopped chan struct{}
+
+	// halted is set by Stop, so requests after it do not start the plugin again
+	halted bool
+}
+
+// ErrPluginStopped is returned for requests to a Plugin after Stop.
+var ErrPluginStopped = errors.New("plugin was stopped")
+
+// pluginProcess is a single run of a plugin executable
+type pluginProcess struct {
+	cmd *exec.Cmd
+
+	// writes are the request lines, written to the plugin one at a time by a writer of their own, so that callers
+	// and the reader never wait for a plugin that does not read its input
+	writes chan []byte
+
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan PluginResponse
+
+	// done is closed once the process exited
+	done chan struct{}
+	err  error
+}
+
+// durationOr returns value, or fallback if value is not set
+func durationOr(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+
+	return value
+}
+
+// Start launches the plugin and its supervisor. It is called implicitly by Translate.
+// A stopped plugin is not started again, and fails with ErrPluginStopped.
+func (p *Plugin) Start() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.halted {
+		return ErrPluginStopped
+	}
+
+	if p.stopped != nil {
+		return nil
+	}
+
+	process, err := p.spawn()
+	if err != nil {
+		return err
+	}
+
+	p.current = process
+	p.stopped = make(chan struct{})
+	go p.supervise(process, p.stopped)
+	go p.checkHealth(p.stopped)
+
+	return nil
+}
+
+// Stop kills the plugin, and prevents it from being restarted or started again.
+func (p *Plugin) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.halted = true
+
+	if p.stopped == nil {
+		return
+	}
+
+	close(p.stopped)
+	p.stopped = nil
+	p.current.kill()
+}
+
+// process returns the currently running process
+func (p *Plugin) process() *pluginProcess {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.current
+}
+
+// spawn starts the plugin executable, and reads its responses in the background
+func (p *Plugin) spawn() (*pluginProcess, error) {
+	cmd := exec.Command(p.Command, p.Args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "plugin %v", p.Command)
+	}
+
+	process := &pluginProcess{
+		cmd:     cmd,
+		writes:  make(chan []byte),
+		pending: make(map[uint64]chan PluginResponse),
+		done:    make(chan struct{}),
+	}
+	go process.read(stdout)
+	go process.write(stdin)
+
+	return process, nil
+}
+
+// supervise restarts the plugin whenever it exits, until the plugin is stopped
+func (p *Plugin) supervise(process *pluginProcess, stopped chan struct{}) {
+	delay := durationOr(p.RestartDelay, defaultPluginRestartDelay)
+
+	for {
+		<-process.done
+
+		for {
+			log.Printf("plugin %v exited (%v), restarting in %v", p.Command, process.err, delay)
+
+			select {
+			case <-stopped:
+				return
+			case <-time.After(delay):
+			}
+
+			next, err := p.spawn()
+			if err == nil {
+				process = next
+				break
+			}
+			log.Print(err)
+		}
+
+		// A plugin stopped while it was restarted has no supervisor left, so the new process is not kept
+		p.lock.Lock()
+		if p.stopped != stopped {
+			p.lock.Unlock()
+			process.kill()
+			return
+		}
+		p.current = process
+		p.lock.Unlock()
+	}
+}
+
+// checkHealth periodically asks the plugin for its health, and kills it if it does not respond.
+// The supervisor then restarts it.
+func (p *Plugin) checkHealth(stopped chan struct{}) {
+	ticker := time.NewTicker(durationOr(p.HealthInterval, defaultPluginHealthInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		process := p.process()
+		response, err := process.call(PluginRequest{Method: "health"}, durationOr(p.Timeout, defaultPluginTimeout))
+		if err == nil && response.Error != "" {
+			err = errors.New(response.Error)
+		}
+
+		if err != nil {
+			log.Printf("plugin %v failed health check: %v", p.Command, err)
+			process.kill()
+		}
+	}
+}
+
+// read dispatches responses to waiting callers, until the process exits
+func (pp *pluginProcess) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		response := PluginResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			log.Printf("plugin %v wrote invalid response: %v", pp.cmd.Path, err)
+			continue
+		}
+
+		pp.lock.Lock()
+		waiting, ok := pp.pending[response.ID]
+		delete(pp.pending, response.ID)
+		pp.lock.Unlock()
+
+		if ok {
+			waiting <- response
+		}
+	}
+
+	pp.err = pp.cmd.Wait()
+	if pp.err == nil {
+		pp.err = errors.New("exited")
+	}
+	close(pp.done)
+}
+
+// write writes request lines to the plugin, until the process exits
+func (pp *pluginProcess) write(stdin io.WriteCloser) {
+	defer stdin.Close()
+
+	for {
+		select {
+		case line := <-pp.writes:
+			if _, err := stdin.Write(line); err != nil {
+				log.Printf("plugin %v failed to read request: %v", pp.cmd.Path, err)
+				pp.kill()
+				return
+			}
+		case <-pp.done:
+			return
+		}
+	}
+}
+
+// call sends a request, and waits for the matching response
+func (pp *pluginProcess) call(request PluginRequest, timeout time.Duration) (PluginResponse, error) {
+	waiting := make(chan PluginResponse, 1)
+
+	pp.lock.Lock()
+	pp.nextID++
+	request.ID = pp.nextID
+	pp.pending[request.ID] = waiting
+	pp.lock.Unlock()
+
+	defer func() {
+		pp.lock.Lock()
+		delete(pp.pending, request.ID)
+		pp.lock.Unlock()
+	}()
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+
+	// Both sending the request and waiting for the response count towards the timeout
+	deadline := time.After(timeout)
+
+	select {
+	case pp.writes <- append(line, '\n'):
+	case <-pp.done:
+		return PluginResponse{}, errors.Wrap(pp.err, "plugin exited")
+	case <-deadline:
+		return PluginResponse{}, errors.Errorf("plugin did not read the request within %v", timeout)
+	}
+
+	select {
+	case response := <-waiting:
+		return response, nil
+	case <-pp.done:
+		return PluginResponse{}, errors.Wrap(pp.err, "plugin exited")
+	case <-deadline:
+		return PluginResponse{}, errors.Errorf("plugin did not respond within %v", timeout)
+	}
+}
+
+// kill terminates the process
+func (pp *pluginProcess) kill() {
+	if pp.cmd.Process != nil {
+		pp.cmd.Process.Kill()
+	}
+}
+
+// Translate sends the phrase to the plugin, starting it if necessary.
+func (p *Plugin) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	if err := p.Start(); err != nil {
+		sendError(out, err)
+		return
+	}
+
+	response, err := p.process().call(PluginRequest{
+		Method: "translate",
+		Text:   givenPhrase,
+		Source: givenLang.String(),
+		Target: targetLang.String(),
+	}, durationOr(p.Timeout, defaultPluginTimeout))
+
+	if err == nil && response.Error != "" {
+		err = errors.New(response.Error)
+	}
+
+	if err != nil {
+		sendError(out, errors.Wrapf(err, "plugin %v", p.Command))
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: response.Text,
+	}
+}
@@ -0,0 +1,156 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildSamplePlugin compiles plugins/uppercase, and returns the path of the executable
+func buildSamplePlugin(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "uppercase")
+	build := exec.Command("go", "build", "-o", path, "../plugins/uppercase")
+	if output, err := build.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("building the sample plugin failed: %v\n%s", err, output)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestPlugin_Translate(t *testing.T) {
+	path, cleanup := buildSamplePlugin(t)
+	defer cleanup()
+
+	plugin := &Plugin{Command: path, RestartDelay: 10 * time.Millisecond}
+	defer plugin.Stop()
+
+	result := call(plugin, "hallo", language.German, language.English)
+	if result.Error != nil || result.TranslatedPhrase != "HALLO" {
+		t.Errorf("Plugin should return the plugin's translation: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	// Crashing fails the request, but the plugin should be restarted for the next one
+	result = call(plugin, "crash", language.German, language.English)
+	if result.Error == nil {
+		t.Error("Plugin should return an error when the plugin crashes")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result = call(plugin, "wieder da", language.German, language.English)
+		if result.Error == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if result.Error != nil || result.TranslatedPhrase != "WIEDER DA" {
+		t.Errorf("Plugin should restart crashed plugins: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+}
+
+func TestPlugin_Stop(t *testing.T) {
+	path, cleanup := buildSamplePlugin(t)
+	defer cleanup()
+
+	plugin := &Plugin{Command: path}
+	if result := call(plugin, "hallo", language.German, language.English); result.Error != nil {
+		t.Fatalf("Plugin returned error when it shouldn't have: %v", result.Error)
+	}
+
+	first := plugin.process()
+	plugin.Stop()
+
+	result := call(plugin, "hallo", language.German, language.English)
+	if result.Error != ErrPluginStopped {
+		t.Errorf("Plugin should fail requests after Stop: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	if plugin.process() != first {
+		t.Error("Plugin should not start a stopped plugin again")
+	}
+
+	if err := plugin.Start(); err != ErrPluginStopped {
+		t.Errorf("Start should fail after Stop: got %v", err)
+	}
+}
+
+func TestPlugin_HealthCheck(t *testing.T) {
+	// sleep never answers health checks
+	plugin := &Plugin{
+		Command:        "sleep",
+		Args:           []string{"60"},
+		Timeout:        50 * time.Millisecond,
+		HealthInterval: 10 * time.Millisecond,
+		RestartDelay:   time.Hour,
+	}
+
+	if err := plugin.Start(); err != nil {
+		t.Skipf("sleep is not available: %v", err)
+	}
+	defer plugin.Stop()
+
+	first := plugin.process()
+	select {
+	case <-first.done:
+	case <-time.After(time.Second):
+		t.Error("Plugin should kill plugins failing health checks")
+	}
+}
+
+func TestPlugin_MissingCommand(t *testing.T) {
+	plugin := &Plugin{Command: "/nonexistent/plugin"}
+
+	result := call(plugin, testPhrase, language.German, language.English)
+	if result.Error == nil {
+		t.Error("Plugin should return an error when the plugin cannot be started")
+	}
+}
+
+func TestPlugin_NotReading(t *testing.T) {
+	// sleep never reads its input, so a request larger than the pipe's buffer cannot be written
+	plugin := &Plugin{
+		Command:        "sleep",
+		Args:           []string{"60"},
+		Timeout:        50 * time.Millisecond,
+		HealthInterval: 20 * time.Millisecond,
+		RestartDelay:   time.Hour,
+	}
+
+	if err := plugin.Start(); err != nil {
+		t.Skipf("sleep is not available: %v", err)
+	}
+	defer plugin.Stop()
+
+	first := plugin.process()
+
+	result := make(chan Result, 1)
+	go func() { result <- call(plugin, strings.Repeat("a", 1024*1024), language.German, language.English) }()
+
+	select {
+	case r := <-result:
+		if r.Error == nil {
+			t.Error("Plugin should return an error when the plugin does not read requests")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Plugin should time out when the plugin does not read requests")
+	}
+
+	// Health checks still get through, and kill the plugin
+	select {
+	case <-first.done:
+	case <-time.After(time.Second):
+		t.Error("Plugin should kill plugins that do not read requests")
+	}
+}
@@ -0,0 +1,192 @@
+package upstream
+
+import (
+	"bufio"
+	"github.com/kuboschek/translate-server/placeholder"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProtectedPatterns are the kinds of tokens Protect knows about, by name.
+var ProtectedPatterns = map[string]*regexp.Regexp{
+	"url":     regexp.MustCompile(`\b(?:https?|ftp)://[^\s<>"]*[^\s<>".,;:!?')\]]`),
+	"email":   regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+	"mention": regexp.MustCompile(`\B@\w+`),
+	"hashtag": regexp.MustCompile(`\B#\w+`),
+	"code":    regexp.MustCompile("`[^`\n]+`"),
+}
+
+// Protect wraps a service to keep tokens that must not be translated, like brand names, usernames or URLs, unchanged.
+// Tokens are replaced by placeholders before translation and restored afterwards. Translations that lost
+// placeholders fail, so the next service is tried.
+type Protect struct {
+	Handler Service
+
+	// Patterns match the tokens to protect. If a pattern has a capturing group, only the first group is protected.
+	Patterns []*regexp.Regexp
+
+	// Terms are protected wherever they appear as whole words, e.g. brand names.
+	Terms []string
+}
+
+// ParseProtection returns the patterns for a comma-separated list of ProtectedPatterns names, or "all" of them.
+func ParseProtection(spec string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, known := range []string{"url", "email", "mention", "hashtag", "code"} {
+				patterns = append(patterns, ProtectedPatterns[known])
+			}
+		case ProtectedPatterns[name] != nil:
+			patterns = append(patterns, ProtectedPatterns[name])
+		default:
+			return nil, errors.Errorf("protect: unknown token pattern %q", name)
+		}
+	}
+
+	return patterns, nil
+}
+
+// LoadProtectedPatterns reads regular expressions from a file, one per line. Empty lines and lines starting with #
+// are ignored.
+func LoadProtectedPatterns(path string) ([]*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pattern, err := regexp.Compile(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v:%d", path, line)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// termSpans returns the occurrences of protected terms in a phrase, as whole words
+func (p Protect) termSpans(givenPhrase string) []placeholder.Span {
+	if len(p.Terms) == 0 {
+		return nil
+	}
+
+	// Alternatives are tried in order, so longer terms need to come first
+	terms := append([]string(nil), p.Terms...)
+	sort.Slice(terms, func(i, j int) bool {
+		return len(terms[i]) > len(terms[j])
+	})
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile(`(?:^|[^\pL\pN])(` + strings.Join(terms, "|") + `)`)
+
+	var spans []placeholder.Span
+	for _, location := range pattern.FindAllStringSubmatchIndex(givenPhrase, -1) {
+		start, end := location[2], location[3]
+		if next, _ := utf8.DecodeRuneInString(givenPhrase[end:]); end < len(givenPhrase) && (unicode.IsLetter(next) || unicode.IsDigit(next)) {
+			continue
+		}
+
+		spans = append(spans, placeholder.Span{Start: start, End: end, Restore: givenPhrase[start:end]})
+	}
+
+	return spans
+}
+
+// spans returns the protected tokens in a phrase
+func (p Protect) spans(givenPhrase string) []placeholder.Span {
+	spans := p.termSpans(givenPhrase)
+
+	for _, pattern := range p.Patterns {
+		for _, location := range pattern.FindAllStringSubmatchIndex(givenPhrase, -1) {
+			start, end := location[0], location[1]
+			if len(location) > 2 && location[2] >= 0 {
+				start, end = location[2], location[3]
+			}
+
+			spans = append(spans, placeholder.Span{Start: start, End: end, Restore: givenPhrase[start:end]})
+		}
+	}
+
+	return spans
+}
+
+// Translate masks protected tokens, and restores them in the translation of the wrapped handler.
+func (p Protect) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	masked := placeholder.Mask(givenPhrase, p.spans(givenPhrase))
+	if masked.Len() == 0 {
+		*out <- call(p.Handler, givenPhrase, givenLang, targetLang)
+		return
+	}
+
+	result := call(p.Handler, masked.Text, givenLang, targetLang)
+	if result.Error != nil {
+		*out <- result
+		return
+	}
+
+	translated, err := masked.Unmask(result.TranslatedPhrase)
+	if err != nil {
+		sendError(out, errors.Wrap(err, "protect"))
+		return
+	}
+
+	result.GivenPhrase = givenPhrase
+	result.TranslatedPhrase = translated
+	*out <- result
+}
+
+// WithGlossary returns a copy of this service whose wrapped handler uses the glossary, if it supports it.
+func (p Protect) WithGlossary(terms map[string]string) (Service, bool) {
+	native, ok := p.Handler.(GlossaryService)
+	if !ok {
+		return nil, false
+	}
+
+	handler, ok := native.WithGlossary(terms)
+	if !ok {
+		return nil, false
+	}
+
+	p.Handler = handler
+	return p, true
+}
+
+// WithHTML returns a copy of this service whose wrapped handler translates HTML, if it supports it. Tokens within
+// tags are protected as well, which keeps them unchanged all the same.
+func (p Protect) WithHTML() (Service, bool) {
+	native, ok := p.Handler.(HTMLService)
+	if !ok {
+		return nil, false
+	}
+
+	handler, ok := native.WithHTML()
+	if !ok {
+		return nil, false
+	}
+
+	p.Handler = handler
+	return p, true
+}
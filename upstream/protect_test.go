@@ -0,0 +1,84 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// upper translates by converting to upper case, which mangles anything not protected
+type upper struct{}
+
+func (upper) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+	*out <- Result{GivenPhrase: givenPhrase, TranslatedPhrase: strings.ToUpper(givenPhrase), TargetLang: targetLang}
+}
+
+func TestProtect_Translate(t *testing.T) {
+	patterns, err := ParseProtection("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protect := Protect{Handler: upper{}, Patterns: patterns, Terms: []string{"Acme", "Acme Cloud"}}
+
+	cases := map[string]string{
+		"ask @jane about #release":                     "ASK @jane ABOUT #release",
+		"see https://acme.example/Docs?a=b.":           "SEE https://acme.example/Docs?a=b.",
+		"mail bob.smith@acme.example now":              "MAIL bob.smith@acme.example NOW",
+		"run `go test` in Acme Cloud":                  "RUN `go test` IN Acme Cloud",
+		"Acme and Acme, but not Acmeware or AcmeCloud": "Acme AND Acme, BUT NOT ACMEWARE OR ACMECLOUD",
+		"nothing to protect":                           "NOTHING TO PROTECT",
+	}
+
+	for given, want := range cases {
+		result := call(protect, given, language.English, language.German)
+		if result.Error != nil || result.TranslatedPhrase != want {
+			t.Errorf("Protect should keep tokens in %q: got %q (%v)", given, result.TranslatedPhrase, result.Error)
+		}
+	}
+
+	protect.Handler = dropping{}
+	result := call(protect, "ask @jane and @joe", language.English, language.German)
+	if result.Error == nil {
+		t.Errorf("Protect should fail when placeholders are lost: got %q", result.TranslatedPhrase)
+	}
+}
+
+func TestProtect_CapturingGroup(t *testing.T) {
+	protect := Protect{Handler: upper{}, Patterns: []*regexp.Regexp{regexp.MustCompile(`user:(\w+)`)}}
+
+	result := call(protect, "user:jane", language.English, language.German)
+	if result.Error != nil || result.TranslatedPhrase != "USER:jane" {
+		t.Errorf("Protect should only protect the first group of patterns: got %q (%v)", result.TranslatedPhrase, result.Error)
+	}
+}
+
+func TestParseProtection(t *testing.T) {
+	if patterns, err := ParseProtection("url, mention"); err != nil || len(patterns) != 2 {
+		t.Errorf("ParseProtection should return the named patterns: got %v (%v)", patterns, err)
+	}
+
+	if _, err := ParseProtection("url,phone"); err == nil {
+		t.Error("ParseProtection should reject unknown patterns")
+	}
+}
+
+func TestLoadProtectedPatterns(t *testing.T) {
+	file, err := ioutil.TempFile("", "patterns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("# ticket numbers\nJIRA-\\d+\n\n[A-Z]{3}\n")
+	file.Close()
+
+	patterns, err := LoadProtectedPatterns(file.Name())
+	if err != nil || len(patterns) != 2 {
+		t.Errorf("LoadProtectedPatterns should skip comments and empty lines: got %v (%v)", patterns, err)
+	}
+}
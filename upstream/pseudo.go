@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultExpansion = 0.3
+
+// pseudoPlaceholder matches text that must survive pseudo-localization unchanged:
+// interpolations ({name}, {{name}}, %{name}), printf verbs (%s, %1$d, %@), markup, entities and URLs.
+// Spaces are not taken as flags, and verbs followed by letters are words, so "100% sure" and "50%off" are prose.
+var pseudoPlaceholder = regexp.MustCompile(`\{\{[^}]*\}\}|%?\{[^{}]*\}|%(\d+\$)?[-+#0]*\d*(\.\d+)?(hh|h|ll|l|z|j|L)?([diouxXeEfFgGaAcspqvtTbU]\b|[@%])|<[^>]+>|&#?\w+;|https?://\S+`)
+
+var pseudoAccents = map[rune]rune{
+	'A': 'Å', 'B': 'Ɓ', 'C': 'Ç', 'D': 'Đ', 'E': 'Ê', 'F': 'Ƒ', 'G': 'Ĝ', 'H': 'Ħ', 'I': 'Î', 'J': 'Ĵ',
+	'K': 'Ķ', 'L': 'Ŀ', 'M': 'Ṁ', 'N': 'Ñ', 'O': 'Ö', 'P': 'Þ', 'Q': 'Ǫ', 'R': 'Ŕ', 'S': 'Š', 'T': 'Ŧ',
+	'U': 'Û', 'V': 'Ṽ', 'W': 'Ŵ', 'X': 'Ẋ', 'Y': 'Ý', 'Z': 'Ž',
+	'a': 'å', 'b': 'ƀ', 'c': 'ç', 'd': 'đ', 'e': 'é', 'f': 'ƒ', 'g': 'ĝ', 'h': 'ħ', 'i': 'î', 'j': 'ĵ',
+	'k': 'ķ', 'l': 'ŀ', 'm': 'ṁ', 'n': 'ñ', 'o': 'ö', 'p': 'þ', 'q': 'ǫ', 'r': 'ŕ', 's': 'ş', 't': 'ŧ',
+	'u': 'û', 'v': 'ṽ', 'w': 'ŵ', 'x': 'ẋ', 'y': 'ý', 'z': 'ž',
+}
+
+// Pseudo is a upstream.Service implementation producing pseudo-translations for testing user interfaces,
+// e.g. "Test text" becomes "[Ŧéşŧ ŧéẋŧ !!!]". Accents reveal hard-coded strings and encoding problems,
+// padding reveals truncation, and brackets reveal concatenated strings. Placeholders and markup are preserved.
+type Pseudo struct {
+	// Expansion is the fraction by which phrases are lengthened. Defaults to 0.3.
+	Expansion float64
+}
+
+// accent replaces ASCII letters with accented look-alikes
+func accent(text string) string {
+	return strings.Map(func(r rune) rune {
+		if accented, ok := pseudoAccents[r]; ok {
+			return accented
+		}
+		return r
+	}, text)
+}
+
+// Localize returns the pseudo-translation of phrase.
+func (p Pseudo) Localize(phrase string) string {
+	expansion := p.Expansion
+	if expansion == 0 {
+		expansion = defaultExpansion
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[")
+
+	last := 0
+	for _, span := range pseudoPlaceholder.FindAllStringIndex(phrase, -1) {
+		builder.WriteString(accent(phrase[last:span[0]]))
+		builder.WriteString(phrase[span[0]:span[1]])
+		last = span[1]
+	}
+	builder.WriteString(accent(phrase[last:]))
+
+	padding := int(math.Ceil(float64(utf8.RuneCountInString(phrase)) * expansion))
+	if padding > 0 {
+		builder.WriteString(" " + strings.Repeat("!", padding))
+	}
+	builder.WriteString("]")
+
+	return builder.String()
+}
+
+// Translate returns the pseudo-translation of the given phrase, regardless of the target language.
+func (p Pseudo) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: p.Localize(givenPhrase),
+	}
+}
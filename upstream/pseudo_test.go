@@ -0,0 +1,38 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"testing"
+)
+
+func TestPseudo_Localize(t *testing.T) {
+	cases := map[string]string{
+		"Test text":                    "[Ŧéşŧ ŧéẋŧ !!!]",
+		"Hello, {name}!":               "[Ħéŀŀö, {name}! !!!!!]",
+		"%1$s of %2$d":                 "[%1$s öƒ %2$d !!!!]",
+		"Click <a href=\"x\">here</a>": "[Çŀîçķ <a href=\"x\">ħéŕé</a> !!!!!!!!]",
+		"{{count}} items &amp; more":   "[{{count}} îŧéṁş &amp; ṁöŕé !!!!!!!!]",
+		"I am 100% sure":               "[Î åṁ 100% şûŕé !!!!!]",
+		"50%off, %d left":              "[50%öƒƒ, %d ŀéƒŧ !!!!!]",
+		"%.2f%% done":                  "[%.2f%% đöñé !!!!]",
+		"%ld files":                    "[%ld ƒîŀéş !!!]",
+		"":                             "[]",
+	}
+
+	for given, want := range cases {
+		if got := (Pseudo{}).Localize(given); got != want {
+			t.Errorf("Localize(%q): want %q, got %q", given, want, got)
+		}
+	}
+
+	if got := (Pseudo{Expansion: 1}).Localize("abc"); got != "[åƀç !!!]" {
+		t.Errorf("Localize should honour the configured expansion: got %q", got)
+	}
+}
+
+func TestPseudo_Translate(t *testing.T) {
+	result := call(Pseudo{}, "Test text", language.English, language.MustParse("ar"))
+	if result.Error != nil || result.TranslatedPhrase != "[Ŧéşŧ ŧéẋŧ !!!]" {
+		t.Errorf("Pseudo should translate to any target language: got %v (%v)", result.TranslatedPhrase, result.Error)
+	}
+}
@@ -0,0 +1,146 @@
+package upstream
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4DateFormat = "20060102T150405Z"
+)
+
+// AWSCredentials holds the keys used to sign requests to Amazon Web Services.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is only required for temporary credentials, e.g. from an assumed role.
+	SessionToken string
+}
+
+// signV4 adds AWS Signature Version 4 headers to request. body must be the exact request payload.
+func signV4(request *http.Request, body []byte, credentials AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(sigV4DateFormat)
+	scope := strings.Join([]string{amzDate[:8], region, service, "aws4_request"}, "/")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers, signedHeaders := canonicalHeaders(request)
+	payloadHash := sha256.Sum256(body)
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI(request.URL.EscapedPath()),
+		canonicalQuery(request),
+		headers,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI returns the escaped path, or "/" for an empty one
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+// canonicalQuery sorts the query parameters by key and value, and encodes them as AWS expects
+func canonicalQuery(request *http.Request) string {
+	var pairs []string
+	for key, values := range request.URL.Query() {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders returns the canonical header block and the list of signed header names.
+// All headers present on the request are signed, as well as the host.
+func canonicalHeaders(request *http.Request) (headers string, signedHeaders string) {
+	values := map[string]string{
+		"host": request.Host,
+	}
+	if values["host"] == "" {
+		values["host"] = request.URL.Host
+	}
+
+	for name, value := range request.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+
+		trimmed := make([]string, len(value))
+		for i := range value {
+			trimmed[i] = strings.Join(strings.Fields(value[i]), " ")
+		}
+		values[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return builder.String(), strings.Join(names, ";")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters of RFC 3986
+func awsEscape(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || strings.IndexByte("-_.~", b) >= 0 {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,145 @@
+package upstream
+
+import (
+	"github.com/kuboschek/translate-server/glossary"
+	"github.com/kuboschek/translate-server/placeholder"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/text/language"
+	"strings"
+)
+
+// GlossaryService is implemented by services that can apply terminology themselves, e.g. as part of a prompt.
+type GlossaryService interface {
+	Service
+
+	// WithGlossary returns a service using the given translations of source terms, or false if this is not supported
+	WithGlossary(terms map[string]string) (Service, bool)
+}
+
+// Terminology wraps a service to enforce the approved translations of a glossary.
+// Services implementing GlossaryService are passed the terms found in a phrase. For all others, the terms are
+// replaced by placeholders before translation, and the placeholders by the approved translations afterwards.
+type Terminology struct {
+	Handler  Service
+	Glossary *glossary.Glossary
+
+	// html is set for copies translating HTML, whose terms are only replaced in text, not in tags
+	html bool
+}
+
+// Translate applies the glossary to a translation by the wrapped handler.
+// Translations that lost placeholders fail, so the next service is tried.
+func (t Terminology) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	var matches []glossary.Match
+	if t.Glossary != nil {
+		matches = t.Glossary.Find(givenPhrase, givenLang, targetLang)
+	}
+	if t.html {
+		matches = inText(givenPhrase, matches)
+	}
+
+	if len(matches) == 0 {
+		*out <- call(t.Handler, givenPhrase, givenLang, targetLang)
+		return
+	}
+
+	if native, ok := t.Handler.(GlossaryService); ok {
+		terms := make(map[string]string, len(matches))
+		for _, match := range matches {
+			terms[givenPhrase[match.Start:match.End]] = match.Term.Target
+		}
+
+		// Language pairs the service does not support may still be pivoted, with the terms as placeholders
+		if handler, ok := native.WithGlossary(terms); ok {
+			result := call(handler, givenPhrase, givenLang, targetLang)
+			if !IsUnsupportedLanguage(result.Error) {
+				*out <- result
+				return
+			}
+		}
+	}
+
+	spans := make([]placeholder.Span, len(matches))
+	for i, match := range matches {
+		spans[i] = placeholder.Span{Start: match.Start, End: match.End, Restore: match.Term.Target}
+	}
+	masked := placeholder.Mask(givenPhrase, spans)
+
+	result := call(t.Handler, masked.Text, givenLang, targetLang)
+	if result.Error != nil {
+		*out <- result
+		return
+	}
+
+	translated, err := masked.Unmask(result.TranslatedPhrase)
+	if err != nil {
+		sendError(out, errors.Wrap(err, "glossary"))
+		return
+	}
+
+	result.GivenPhrase = givenPhrase
+	result.TranslatedPhrase = translated
+	*out <- result
+}
+
+// WithHTML returns a copy of this service whose wrapped handler translates HTML, if it supports it.
+func (t Terminology) WithHTML() (Service, bool) {
+	native, ok := t.Handler.(HTMLService)
+	if !ok {
+		return nil, false
+	}
+
+	handler, ok := native.WithHTML()
+	if !ok {
+		return nil, false
+	}
+
+	t.Handler = handler
+	t.html = true
+	return t, true
+}
+
+// inText returns the matches within the text of an HTML document, leaving out those in tags, comments, scripts
+// and styles
+func inText(document string, matches []glossary.Match) []glossary.Match {
+	var text [][2]int
+
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	offset, code := 0, false
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		length := len(tokenizer.Raw())
+		switch tokenType {
+		case html.TextToken:
+			if !code {
+				text = append(text, [2]int{offset, offset + length})
+			}
+		case html.StartTagToken:
+			// Scripts and styles are read as a single text token following their start tag
+			name, _ := tokenizer.TagName()
+			code = string(name) == "script" || string(name) == "style"
+		default:
+			code = false
+		}
+		offset += length
+	}
+
+	var kept []glossary.Match
+	for _, match := range matches {
+		for _, span := range text {
+			if match.Start >= span[0] && match.End <= span[1] {
+				kept = append(kept, match)
+				break
+			}
+		}
+	}
+
+	return kept
+}
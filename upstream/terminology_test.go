@@ -0,0 +1,142 @@
+package upstream
+
+import (
+	"github.com/kuboschek/translate-server/glossary"
+	"golang.org/x/text/language"
+	"strings"
+	"testing"
+)
+
+// nativeGlossary records the terms it is given, and translates nothing
+type nativeGlossary struct {
+	terms map[string]string
+}
+
+func (n nativeGlossary) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+	*out <- Result{GivenPhrase: givenPhrase, TranslatedPhrase: givenPhrase, TargetLang: targetLang}
+}
+
+func (n nativeGlossary) WithGlossary(terms map[string]string) (Service, bool) {
+	for source, target := range terms {
+		n.terms[source] = target
+	}
+	return n, true
+}
+
+// dropping loses everything after the first placeholder, like a careless service would
+type dropping struct{}
+
+func (dropping) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+	*out <- Result{TranslatedPhrase: strings.SplitAfter(givenPhrase, "⟧")[0]}
+}
+
+// htmlEcho translates nothing, and supports HTML
+type htmlEcho struct{}
+
+func (htmlEcho) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+	*out <- Result{GivenPhrase: givenPhrase, TranslatedPhrase: givenPhrase, TargetLang: targetLang}
+}
+
+func (htmlEcho) WithHTML() (Service, bool) {
+	return htmlEcho{}, true
+}
+
+func testGlossary() *glossary.Glossary {
+	g := &glossary.Glossary{}
+	g.Add(glossary.Term{Source: "dashboard", SourceLang: language.English, Target: "Cockpit", TargetLang: language.German})
+	g.Add(glossary.Term{Source: "Acme", SourceLang: language.English, Target: "ACME", TargetLang: language.German})
+	return g
+}
+
+func TestTerminology_Translate(t *testing.T) {
+	terminology := Terminology{Handler: Mock{}, Glossary: testGlossary()}
+
+	result := call(terminology, "Open the Dashboard of Acme", language.English, language.German)
+	if result.Error != nil || result.TranslatedPhrase != "Open the Cockpit of ACME" {
+		t.Errorf("Terminology should substitute approved translations: got %q (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	if result.GivenPhrase != "Open the Dashboard of Acme" {
+		t.Errorf("Terminology should return the unmasked phrase: got %q", result.GivenPhrase)
+	}
+
+	result = call(terminology, "Open the dashboard", language.English, language.French)
+	if result.Error != nil || result.TranslatedPhrase != "Open the dashboard" {
+		t.Errorf("Terminology should not apply terms of other language pairs: got %q (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	terminology.Handler = dropping{}
+	result = call(terminology, "Open the dashboard of Acme", language.English, language.German)
+	if result.Error == nil {
+		t.Errorf("Terminology should fail when placeholders are lost: got %q", result.TranslatedPhrase)
+	}
+}
+
+func TestTerminology_Native(t *testing.T) {
+	native := nativeGlossary{terms: make(map[string]string)}
+	terminology := Terminology{Handler: native, Glossary: testGlossary()}
+
+	result := call(terminology, "Open the Dashboard", language.English, language.German)
+	if result.Error != nil || result.TranslatedPhrase != "Open the Dashboard" {
+		t.Errorf("Terminology should not mask phrases for services applying glossaries: got %q (%v)", result.TranslatedPhrase, result.Error)
+	}
+
+	if native.terms["Dashboard"] != "Cockpit" || len(native.terms) != 1 {
+		t.Errorf("Terminology should pass the terms found to the service: got %v", native.terms)
+	}
+}
+
+func TestTerminology_NativeThroughWrappers(t *testing.T) {
+	native := nativeGlossary{terms: make(map[string]string)}
+	terminology := Terminology{Handler: Pivot{Direct: native, Handler: native}, Glossary: testGlossary()}
+
+	result := call(terminology, "Open the Dashboard", language.English, language.German)
+	if result.Error != nil || result.TranslatedPhrase != "Open the Dashboard" || native.terms["Dashboard"] != "Cockpit" {
+		t.Errorf("Terminology should pass the terms through Pivot: got %q %v (%v)", result.TranslatedPhrase, native.terms, result.Error)
+	}
+
+	protect := Protect{Handler: native}
+	if _, ok := protect.WithGlossary(map[string]string{"Acme": "ACME"}); !ok || native.terms["Acme"] != "ACME" {
+		t.Error("Protect should pass the terms to the wrapped service")
+	}
+}
+
+func TestLLM_WithGlossary(t *testing.T) {
+	llm := LLM{Glossary: map[string]string{"sign in": "anmelden"}}
+
+	svc, ok := (&CircuitBreaker{Handler: llm}).WithGlossary(map[string]string{"Acme": "ACME"})
+	if !ok {
+		t.Fatal("CircuitBreaker should support glossaries if its handler does")
+	}
+
+	prompt := svc.(*CircuitBreaker).Handler.(LLM).prompt(language.English, language.German)
+	if !strings.Contains(prompt, "Acme => ACME") || !strings.Contains(prompt, "sign in => anmelden") {
+		t.Errorf("LLM should add glossary terms to the prompt: got %q", prompt)
+	}
+
+	if len(llm.Glossary) != 1 {
+		t.Error("WithGlossary should not modify the original service")
+	}
+}
+
+func TestTerminology_HTML(t *testing.T) {
+	terminology := Terminology{Handler: Protect{Handler: Pivot{Direct: htmlEcho{}, Handler: htmlEcho{}}}, Glossary: testGlossary()}
+
+	svc, ok := terminology.WithHTML()
+	if !ok {
+		t.Fatal("Terminology should support HTML through Protect and Pivot if their services do")
+	}
+
+	result := call(svc, `<a title="Dashboard" class="dashboard">Open the Dashboard</a>`, language.English, language.German)
+	want := `<a title="Dashboard" class="dashboard">Open the Cockpit</a>`
+	if result.Error != nil || result.TranslatedPhrase != want {
+		t.Errorf("Terminology should only replace terms in the text of HTML: got %q want %q (%v)", result.TranslatedPhrase, want, result.Error)
+	}
+
+	if _, ok := (Pivot{Direct: htmlEcho{}, Handler: Mock{}}).WithHTML(); ok {
+		t.Error("Pivot should not support HTML if one of its services does not")
+	}
+}
@@ -0,0 +1,292 @@
+package upstream
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMatchThreshold = 0.8
+
+	// maxFuzzyCandidates limits how many entries are compared by edit distance per lookup
+	maxFuzzyCandidates = 50
+)
+
+// ErrNoMatch is returned by services that do not translate everything, like TranslationMemory,
+// when they have no translation for a phrase. This is not considered a failure of the service.
+var ErrNoMatch = errors.New("no matching translation")
+
+// MemoryEntry is a single human translation stored in a TranslationMemory.
+type MemoryEntry struct {
+	Source     string       `json:"source"`
+	SourceLang language.Tag `json:"sourceLang"`
+	Target     string       `json:"target"`
+	TargetLang language.Tag `json:"targetLang"`
+}
+
+type memoryPair struct {
+	sourceLang, targetLang language.Tag
+}
+
+type memoryKey struct {
+	memoryPair
+	source string
+}
+
+type memoryGram struct {
+	memoryPair
+	gram string
+}
+
+// TranslationMemory is a upstream.Service implementation serving professional translations.
+// Phrases are matched exactly, or fuzzily by edit distance. Candidates for fuzzy matching are found
+// through an index of character trigrams. Phrases without a match fail with ErrNoMatch.
+type TranslationMemory struct {
+	// Threshold is the minimum similarity, from 0 to 1, of fuzzy matches. Defaults to 0.8.
+	Threshold float64
+
+	lock    sync.RWMutex
+	entries []MemoryEntry
+	exact   map[memoryKey][]int
+	grams   map[memoryGram][]int
+}
+
+// memoryLanguages returns the language pair translations are indexed by. Regions are dropped, so translations between
+// regional variants like en-US and de-DE are found for en and de, and the other way round. Scripts are kept, as
+// Traditional and Simplified Chinese are written differently.
+func memoryLanguages(sourceLang, targetLang language.Tag) memoryPair {
+	return memoryPair{memoryLanguage(sourceLang), memoryLanguage(targetLang)}
+}
+
+func memoryLanguage(tag language.Tag) language.Tag {
+	base, _ := tag.Base()
+	script, _ := tag.Script()
+
+	normalized, err := language.Compose(base, script)
+	if err != nil {
+		return tag
+	}
+	return normalized
+}
+
+// normalizeMemory collapses whitespace and case, so trivial differences still match exactly
+func normalizeMemory(phrase string) string {
+	return strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+}
+
+// trigrams returns the distinct character trigrams of a normalized phrase
+func trigrams(phrase string) []string {
+	runes := []rune(" " + phrase + " ")
+	seen := make(map[string]bool)
+
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := string(runes[i : i+3])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+
+	return grams
+}
+
+// similarity returns 1 minus the edit distance of a and b relative to the longer one
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+// Add stores a translation. An existing translation of the same phrase between the same languages is replaced.
+func (m *TranslationMemory) Add(entry MemoryEntry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.exact == nil {
+		m.exact = make(map[memoryKey][]int)
+		m.grams = make(map[memoryGram][]int)
+	}
+
+	pair := memoryLanguages(entry.SourceLang, entry.TargetLang)
+	normalized := normalizeMemory(entry.Source)
+	key := memoryKey{pair, normalized}
+
+	for _, index := range m.exact[key] {
+		if m.entries[index].SourceLang == entry.SourceLang && m.entries[index].TargetLang == entry.TargetLang {
+			m.entries[index] = entry
+			return
+		}
+	}
+
+	index := len(m.entries)
+	m.entries = append(m.entries, entry)
+	m.exact[key] = append(m.exact[key], index)
+
+	for _, gram := range trigrams(normalized) {
+		gramKey := memoryGram{pair, gram}
+		m.grams[gramKey] = append(m.grams[gramKey], index)
+	}
+}
+
+// Entries returns all stored translations.
+func (m *TranslationMemory) Entries() []MemoryEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return append([]MemoryEntry(nil), m.entries...)
+}
+
+// Lookup returns the best translation of phrase, and its similarity score. Only identical phrases score 1. Phrases
+// differing in case or whitespace alone are matched regardless of the threshold, but score by their edit distance.
+// Translations between the same regional variants as the request are preferred.
+func (m *TranslationMemory) Lookup(phrase string, sourceLang, targetLang language.Tag) (MemoryEntry, float64, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	pair := memoryLanguages(sourceLang, targetLang)
+	normalized := normalizeMemory(phrase)
+
+	if indexes := m.exact[memoryKey{pair, normalized}]; len(indexes) > 0 {
+		entry := m.entries[indexes[0]]
+		for _, index := range indexes {
+			if m.entries[index].SourceLang == sourceLang && m.entries[index].TargetLang == targetLang {
+				entry = m.entries[index]
+			}
+		}
+
+		if entry.Source == phrase {
+			return entry, 1, true
+		}
+		return entry, similarity(phrase, entry.Source), true
+	}
+
+	threshold := m.Threshold
+	if threshold == 0 {
+		threshold = defaultMatchThreshold
+	}
+
+	// Count shared trigrams, to only compare the most promising entries by edit distance
+	grams := trigrams(normalized)
+	shared := make(map[int]int)
+	for _, gram := range grams {
+		for _, index := range m.grams[memoryGram{pair, gram}] {
+			shared[index]++
+		}
+	}
+
+	candidates := make([]int, 0, len(shared))
+	for index := range shared {
+		candidates = append(candidates, index)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if shared[candidates[i]] != shared[candidates[j]] {
+			return shared[candidates[i]] > shared[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	if len(candidates) > maxFuzzyCandidates {
+		candidates = candidates[:maxFuzzyCandidates]
+	}
+
+	best, bestScore := -1, 0.0
+	for _, index := range candidates {
+		score := similarity(normalized, normalizeMemory(m.entries[index].Source))
+		if score >= threshold && score > bestScore {
+			best, bestScore = index, score
+		}
+	}
+
+	if best < 0 {
+		return MemoryEntry{}, 0, false
+	}
+
+	return m.entries[best], bestScore, true
+}
+
+// Load adds the translations stored in a JSON file, containing an array of MemoryEntry objects.
+func (m *TranslationMemory) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var entries []MemoryEntry
+	if err := json.NewDecoder(file).Decode(&entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		m.Add(entry)
+	}
+
+	return nil
+}
+
+// Save writes all stored translations to a JSON file, in the format read by Load.
+func (m *TranslationMemory) Save(path string) error {
+	data, err := json.MarshalIndent(m.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Translate returns the best stored translation, with its similarity as MatchScore, or fails with ErrNoMatch.
+func (m *TranslationMemory) Translate(givenPhrase string, givenLang, targetLang language.Tag, out *chan Result) {
+	defer close(*out)
+
+	entry, score, ok := m.Lookup(givenPhrase, givenLang, targetLang)
+	if !ok {
+		sendError(out, ErrNoMatch)
+		return
+	}
+
+	*out <- Result{
+		GivenLang:        givenLang,
+		GivenPhrase:      givenPhrase,
+		TargetLang:       targetLang,
+		TranslatedPhrase: entry.Target,
+		MatchScore:       score,
+	}
+}
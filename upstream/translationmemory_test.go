@@ -0,0 +1,128 @@
+package upstream
+
+import (
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testMemory() *TranslationMemory {
+	memory := &TranslationMemory{}
+	memory.Add(MemoryEntry{Source: "Save changes", SourceLang: language.English, Target: "Änderungen speichern", TargetLang: language.German})
+	memory.Add(MemoryEntry{Source: "Delete file", SourceLang: language.English, Target: "Datei löschen", TargetLang: language.German})
+	return memory
+}
+
+func TestTranslationMemory_Lookup(t *testing.T) {
+	memory := testMemory()
+
+	entry, score, ok := memory.Lookup("Save changes", language.English, language.German)
+	if !ok || score != 1 || entry.Target != "Änderungen speichern" {
+		t.Errorf("Lookup should match identical phrases with score 1: got %q (%v, %v)", entry.Target, score, ok)
+	}
+
+	entry, score, ok = memory.Lookup("  save   CHANGES ", language.English, language.German)
+	if !ok || score >= 1 || entry.Target != "Änderungen speichern" {
+		t.Errorf("Lookup should match regardless of case and whitespace, with a score below 1: got %q (%v, %v)", entry.Target, score, ok)
+	}
+
+	entry, score, ok = memory.Lookup("save changes", language.English, language.German)
+	if !ok || score >= 1 {
+		t.Errorf("Lookup should score matches differing in case below 1: got %v (%v)", score, ok)
+	}
+
+	entry, score, ok = memory.Lookup("Save change", language.English, language.German)
+	if !ok || score >= 1 || score < defaultMatchThreshold || entry.Target != "Änderungen speichern" {
+		t.Errorf("Lookup should match similar phrases fuzzily: got %q (%v, %v)", entry.Target, score, ok)
+	}
+
+	if _, _, ok = memory.Lookup("Open settings", language.English, language.German); ok {
+		t.Error("Lookup should not match phrases below the threshold")
+	}
+
+	if _, _, ok = memory.Lookup("Save changes", language.English, language.French); ok {
+		t.Error("Lookup should not match other language pairs")
+	}
+
+	memory.Threshold = 0.99
+	if _, _, ok = memory.Lookup("Save change", language.English, language.German); ok {
+		t.Error("Lookup should honour the configured threshold")
+	}
+}
+
+func TestTranslationMemory_Regions(t *testing.T) {
+	memory := testMemory()
+	memory.Add(MemoryEntry{Source: "Open", SourceLang: language.AmericanEnglish, Target: "Öffnen", TargetLang: language.MustParse("de-DE")})
+	memory.Add(MemoryEntry{Source: "January", SourceLang: language.English, Target: "Januar", TargetLang: language.German})
+	memory.Add(MemoryEntry{Source: "January", SourceLang: language.English, Target: "Jänner", TargetLang: language.MustParse("de-AT")})
+
+	if entry, score, ok := memory.Lookup("Open", language.English, language.German); !ok || score != 1 || entry.Target != "Öffnen" {
+		t.Errorf("Lookup should find translations between regional variants for their languages: got %q (%v, %v)", entry.Target, score, ok)
+	}
+
+	if entry, _, ok := memory.Lookup("Save change", language.BritishEnglish, language.MustParse("de-CH")); !ok || entry.Target != "Änderungen speichern" {
+		t.Errorf("Lookup should find translations between languages for their regional variants: got %q (%v)", entry.Target, ok)
+	}
+
+	if entry, _, _ := memory.Lookup("January", language.English, language.MustParse("de-AT")); entry.Target != "Jänner" {
+		t.Errorf("Lookup should prefer translations into the requested regional variant: got %q", entry.Target)
+	}
+
+	if entry, _, _ := memory.Lookup("January", language.English, language.German); entry.Target != "Januar" {
+		t.Errorf("Add should keep translations into other regional variants: got %q", entry.Target)
+	}
+
+	if _, _, ok := memory.Lookup("Open", language.English, language.MustParse("zh-Hant")); ok {
+		t.Error("Lookup should not match other languages")
+	}
+}
+
+func TestTranslationMemory_Add(t *testing.T) {
+	memory := testMemory()
+	memory.Add(MemoryEntry{Source: "Save Changes", SourceLang: language.English, Target: "Speichern", TargetLang: language.German})
+
+	if len(memory.Entries()) != 2 {
+		t.Errorf("Add should replace existing translations: got %v entries", len(memory.Entries()))
+	}
+
+	entry, _, _ := memory.Lookup("Save changes", language.English, language.German)
+	if entry.Target != "Speichern" {
+		t.Errorf("Lookup should return the replaced translation: got %q", entry.Target)
+	}
+}
+
+func TestTranslationMemory_Translate(t *testing.T) {
+	memory := testMemory()
+
+	result := call(memory, "Delete files", language.English, language.German)
+	if result.Error != nil || result.TranslatedPhrase != "Datei löschen" || result.MatchScore == 0 {
+		t.Errorf("TranslationMemory should return the best match with its score: got %q (%v, %v)", result.TranslatedPhrase, result.MatchScore, result.Error)
+	}
+
+	result = call(memory, testPhrase, language.English, language.German)
+	if result.Error != ErrNoMatch {
+		t.Errorf("TranslationMemory should return ErrNoMatch without a match: got %v", result.Error)
+	}
+}
+
+func TestTranslationMemory_Load(t *testing.T) {
+	file, err := ioutil.TempFile("", "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString(`[{"source": "Yes", "sourceLang": "en", "target": "Oui", "targetLang": "fr"}]`)
+	file.Close()
+
+	memory := &TranslationMemory{}
+	if err := memory.Load(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, score, ok := memory.Lookup("Yes", language.English, language.French)
+	if !ok || score != 1 || entry.Target != "Oui" {
+		t.Errorf("Load should add the stored translations: got %q (%v, %v)", entry.Target, score, ok)
+	}
+}
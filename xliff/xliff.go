@@ -0,0 +1,436 @@
+// Package xliff fills the targets of XLIFF 1.2 and 2.0 documents with translations.
+//
+// Documents are changed by splicing new targets into the original text, so everything else, like formatting,
+// comments and unknown elements, is kept exactly as it was.
+package xliff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/kuboschek/translate-server/placeholder"
+	"golang.org/x/text/language"
+	"io"
+	"strings"
+)
+
+// pairedElements enclose translatable text, like bold text. All other inline elements, like <x/>, <ph> or <bpt>,
+// stand for native code, and are kept as they are with their content.
+var pairedElements = map[string]bool{"g": true, "mrk": true, "pc": true}
+
+// States of machine translated targets. XLIFF 1.2 marks them for review, with a qualifier for machine translation.
+// XLIFF 2.0 has no such state, so they are translated with a custom sub-state.
+const (
+	state12          = "needs-review-translation"
+	stateQualifier12 = "mt-suggestion"
+	state20          = "translated"
+	subState20       = "mt:machine-translation"
+)
+
+// unit is a trans-unit of XLIFF 1.2, or a segment of XLIFF 2.0
+type unit struct {
+	depth int
+	skip  bool
+
+	// startTag is the range of the start tag, to change the state of 2.0 segments
+	startTag   [2]int
+	startToken xml.StartElement
+
+	pieces      []placeholder.Piece
+	hasSource   bool
+	sourceEnd   int
+	indentation string
+
+	target      *[2]int
+	targetToken xml.StartElement
+	targetEmpty bool
+}
+
+// translator holds the state of translating one document
+type translator struct {
+	document   string
+	decoder    *xml.Decoder
+	translate  func(string) (string, error)
+	targetLang language.Tag
+	version    string
+	splices    []placeholder.Splice
+	count      int
+}
+
+// Translate fills the targets of the untranslated units of an XLIFF document, and marks them machine translated.
+// Inline elements are replaced by placeholders for translation. It returns the document and the number of
+// translated units.
+func Translate(document string, targetLang language.Tag, translate func(string) (string, error)) (string, int, error) {
+	t := &translator{
+		document:   document,
+		decoder:    xml.NewDecoder(strings.NewReader(document)),
+		translate:  translate,
+		targetLang: targetLang,
+	}
+
+	if err := t.run(); err != nil {
+		return "", 0, err
+	}
+
+	return placeholder.Apply(document, t.splices), t.count, nil
+}
+
+// attribute returns the value of an attribute, or an empty string
+func attribute(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// unitElement returns true if an element is a unit to translate, in the version of the document
+func (t *translator) unitElement(name string) bool {
+	if strings.HasPrefix(t.version, "1.") {
+		return name == "trans-unit"
+	}
+	return name == "segment"
+}
+
+func (t *translator) run() error {
+	var current *unit
+	skipUnits := 0
+	depth := 0
+
+	for {
+		start := int(t.decoder.InputOffset())
+		token, err := t.decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		end := int(t.decoder.InputOffset())
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			switch {
+			case token.Name.Local == "xliff":
+				t.version = attribute(token, "version")
+				if t.version != "1.2" && !strings.HasPrefix(t.version, "2.") {
+					return fmt.Errorf("xliff: unsupported version %q", t.version)
+				}
+				if strings.HasPrefix(t.version, "2.") && attribute(token, "trgLang") == "" {
+					t.setAttributes(start, end, token, "trgLang", t.targetLang.String())
+				}
+
+			case token.Name.Local == "file" && t.version == "1.2" && attribute(token, "target-language") == "":
+				t.setAttributes(start, end, token, "target-language", t.targetLang.String())
+
+			case token.Name.Local == "unit" && attribute(token, "translate") == "no",
+				token.Name.Local == "group" && attribute(token, "translate") == "no":
+				skipUnits = depth
+
+			case current == nil && t.unitElement(token.Name.Local):
+				current = &unit{
+					depth:      depth,
+					skip:       skipUnits > 0 || attribute(token, "translate") == "no",
+					startTag:   [2]int{start, end},
+					startToken: token.Copy(),
+				}
+
+			case current != nil && depth == current.depth+1 && token.Name.Local == "source":
+				if err := t.readSource(current, end); err != nil {
+					return err
+				}
+				current.sourceEnd = int(t.decoder.InputOffset())
+				current.indentation = indentation(t.document[:start])
+				depth--
+
+			case current != nil && depth == current.depth+1 && token.Name.Local == "target":
+				empty, err := t.skipElement()
+				if err != nil {
+					return err
+				}
+				current.target = &[2]int{start, int(t.decoder.InputOffset())}
+				current.targetToken = token.Copy()
+				current.targetEmpty = empty
+				depth--
+			}
+
+		case xml.EndElement:
+			if current != nil && depth == current.depth {
+				if err := t.translateUnit(current); err != nil {
+					return err
+				}
+				current = nil
+			}
+			if depth == skipUnits {
+				skipUnits = 0
+			}
+			depth--
+		}
+	}
+
+	if t.version == "" {
+		return fmt.Errorf("xliff: not an XLIFF document")
+	}
+
+	return nil
+}
+
+// indentation returns the whitespace at the end of text, up to the last line break
+func indentation(text string) string {
+	trimmed := strings.TrimRight(text, " \t")
+	if !strings.HasSuffix(trimmed, "\n") {
+		return ""
+	}
+	return "\n" + text[len(trimmed):]
+}
+
+// skipElement skips the content of the current element. It returns true if the element has no text or elements.
+func (t *translator) skipElement() (bool, error) {
+	empty := true
+	depth := 1
+
+	for depth > 0 {
+		token, err := t.decoder.Token()
+		if err != nil {
+			return false, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			empty = false
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if strings.TrimSpace(string(token)) != "" {
+				empty = false
+			}
+		}
+	}
+
+	return empty, nil
+}
+
+// readSource reads the content of a source into pieces
+func (t *translator) readSource(u *unit, offset int) error {
+	u.hasSource = true
+	depth := 0
+
+	for {
+		start := offset
+		token, err := t.decoder.Token()
+		if err != nil {
+			return err
+		}
+		offset = int(t.decoder.InputOffset())
+		raw := t.document[start:offset]
+
+		switch token := token.(type) {
+		case xml.CharData:
+			u.pieces = append(u.pieces, placeholder.Piece{Text: string(token)})
+
+		case xml.StartElement:
+			if !pairedElements[token.Name.Local] || strings.HasSuffix(raw, "/>") {
+				if _, err := t.skipElement(); err != nil {
+					return err
+				}
+				offset = int(t.decoder.InputOffset())
+				u.pieces = append(u.pieces, placeholder.Piece{Text: t.document[start:offset], Opaque: true})
+				continue
+			}
+
+			depth++
+			u.pieces = append(u.pieces, placeholder.Piece{Text: raw, Opaque: true, Edge: 1})
+
+		case xml.EndElement:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+			u.pieces = append(u.pieces, placeholder.Piece{Text: raw, Opaque: true, Edge: -1})
+
+		default:
+			// Comments and processing instructions are kept where they are
+			u.pieces = append(u.pieces, placeholder.Piece{Text: raw, Opaque: true})
+		}
+	}
+}
+
+// needsTranslation returns true if a unit has no translation yet
+func (u *unit) needsTranslation() bool {
+	if u.skip || !u.hasSource {
+		return false
+	}
+	if u.target == nil || u.targetEmpty {
+		return true
+	}
+
+	state := attribute(u.targetToken, "state")
+	return state == "new" || state == "needs-translation"
+}
+
+// translateUnit translates the source of a unit, and adds a splice for its target
+func (t *translator) translateUnit(u *unit) error {
+	if !u.needsTranslation() {
+		return nil
+	}
+
+	translated, err := t.translatePieces(u.pieces)
+	if err != nil {
+		return err
+	}
+
+	target := xml.StartElement{Name: xml.Name{Local: "target"}}
+	if u.target != nil {
+		target = u.targetToken
+	}
+
+	name := prefix(t.document[u.startTag[0]:u.startTag[1]]) + "target"
+
+	var tag string
+	if strings.HasPrefix(t.version, "1.") {
+		tag = startTag(name, target, "state", state12, "state-qualifier", stateQualifier12)
+	} else {
+		tag = startTag(name, target)
+		t.setAttributes(u.startTag[0], u.startTag[1], u.startToken, "state", state20, "subState", subState20)
+	}
+	element := tag + translated + "</" + name + ">"
+
+	if u.target != nil {
+		t.splices = append(t.splices, placeholder.Splice{Start: u.target[0], End: u.target[1], Text: element})
+	} else {
+		t.splices = append(t.splices, placeholder.Splice{Start: u.sourceEnd, End: u.sourceEnd, Text: u.indentation + element})
+	}
+
+	t.count++
+	return nil
+}
+
+// translatePieces translates the text of a source
+func (t *translator) translatePieces(pieces []placeholder.Piece) (string, error) {
+	translated, err := placeholder.TranslatePaired(pieces, t.translate)
+	if err != nil {
+		return "", err
+	}
+
+	var target strings.Builder
+	for _, p := range translated {
+		if p.Opaque {
+			target.WriteString(p.Text)
+		} else {
+			xml.EscapeText(&target, []byte(p.Text))
+		}
+	}
+
+	return target.String(), nil
+}
+
+// prefix returns the namespace prefix of an element's start tag, e.g. "xlf:", or an empty string if it has none
+func prefix(tag string) string {
+	colon := strings.Index(tag, ":")
+	space := strings.IndexAny(tag, " \t\r\n>/")
+	if colon > 0 && (space < 0 || colon < space) {
+		return tag[1 : colon+1]
+	}
+	return ""
+}
+
+// startTag writes a start tag, with attributes set to the given name and value pairs
+func startTag(name string, element xml.StartElement, attributes ...string) string {
+	var tag strings.Builder
+	tag.WriteString("<" + name)
+
+	set := make(map[string]bool)
+	for i := 0; i < len(attributes); i += 2 {
+		set[attributes[i]] = true
+	}
+
+	for _, a := range element.Attr {
+		if set[a.Name.Local] && a.Name.Space == "" {
+			continue
+		}
+		name := a.Name.Local
+		if a.Name.Space == "http://www.w3.org/XML/1998/namespace" {
+			name = "xml:" + name
+		} else if a.Name.Space != "" {
+			// Attributes of other namespaces cannot be written back without their prefix, so they are dropped
+			continue
+		}
+		tag.WriteString(" " + name + `="` + escapeAttribute(a.Value) + `"`)
+	}
+
+	for i := 0; i < len(attributes); i += 2 {
+		tag.WriteString(" " + attributes[i] + `="` + escapeAttribute(attributes[i+1]) + `"`)
+	}
+
+	tag.WriteString(">")
+	return tag.String()
+}
+
+func escapeAttribute(value string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
+// setAttributes adds a splice changing attributes of the start tag at document[start:end]. Other attributes are
+// kept as they are written.
+func (t *translator) setAttributes(start, end int, element xml.StartElement, attributes ...string) {
+	tag := t.document[start:end]
+
+	closing := ">"
+	body := strings.TrimSuffix(tag, ">")
+	if strings.HasSuffix(body, "/") {
+		closing = "/>"
+		body = strings.TrimSuffix(body, "/")
+	}
+
+	for i := 0; i < len(attributes); i += 2 {
+		name, value := attributes[i], escapeAttribute(attributes[i+1])
+
+		if hasAttribute(element, name) {
+			body = replaceAttribute(body, name, value)
+		} else {
+			body = strings.TrimRight(body, " \t\r\n") + " " + name + `="` + value + `"`
+		}
+	}
+
+	t.splices = append(t.splices, placeholder.Splice{Start: start, End: end, Text: body + closing})
+}
+
+func hasAttribute(element xml.StartElement, name string) bool {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceAttribute replaces the value of an attribute in the text of a start tag
+func replaceAttribute(tag, name, value string) string {
+	for offset := 0; ; {
+		index := strings.Index(tag[offset:], name)
+		if index < 0 {
+			return tag
+		}
+		index += offset
+
+		// The name must be a whole attribute name, followed by an equals sign and a quoted value
+		before := tag[index-1]
+		rest := strings.TrimLeft(tag[index+len(name):], " \t\r\n")
+		if (before != ' ' && before != '\t' && before != '\r' && before != '\n') || !strings.HasPrefix(rest, "=") {
+			offset = index + len(name)
+			continue
+		}
+
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		quote := rest[0]
+		closing := strings.IndexByte(rest[1:], quote)
+		valueEnd := len(tag) - len(rest) + 1 + closing + 1
+
+		return tag[:index] + name + `="` + value + `"` + tag[valueEnd:]
+	}
+}
@@ -0,0 +1,110 @@
+package xliff
+
+import (
+	"errors"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// upper translates by upper-casing, keeping placeholders unchanged
+func upper(phrase string) (string, error) {
+	return strings.ToUpper(phrase), nil
+}
+
+func translateFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	translated, _, err := Translate(string(content), language.German, upper)
+	if err != nil {
+		t.Fatalf("Translate returned error when it shouldn't have: %v", err)
+	}
+	return translated
+}
+
+func TestTranslate12(t *testing.T) {
+	translated := translateFile(t, "testdata/v12.xlf")
+
+	for _, want := range []string{
+		`<file source-language="en" datatype="html" original="page.html" target-language="de">`,
+		"      <!-- Greeting -->\n",
+		"<source>Hello <g id=\"1\">world</g> &amp; friends</source>\n" +
+			"        <target state=\"needs-review-translation\" state-qualifier=\"mt-suggestion\">HELLO <g id=\"1\">WORLD</g> &amp; FRIENDS</target>\n" +
+			"      </trans-unit>",
+		"<target state=\"needs-review-translation\" state-qualifier=\"mt-suggestion\">CLICK <x id=\"2\"/> TO <ph id=\"3\">&lt;br/&gt;</ph>CONTINUE</target>",
+		"<target state=\"final\">Fertig</target>",
+		"<source>ACME</source>\n      </trans-unit>",
+		"<source>Save</source>\n        <target state=\"needs-review-translation\" state-qualifier=\"mt-suggestion\">SAVE</target>\n        <alt-trans>\n          <source>Save</source>\n          <target>Sichern</target>",
+	} {
+		if !strings.Contains(translated, want) {
+			t.Errorf("translated XLIFF 1.2 should contain %q, got:\n%v", want, translated)
+		}
+	}
+}
+
+func TestTranslate20(t *testing.T) {
+	translated := translateFile(t, "testdata/v20.xlf")
+
+	for _, want := range []string{
+		`<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="de">`,
+		"<segment state=\"translated\" subState=\"mt:machine-translation\">\n" +
+			"        <source>Open <pc id=\"1\">the file</pc><ph id=\"2\"/></source>\n" +
+			"        <target>OPEN <pc id=\"1\">THE FILE</pc><ph id=\"2\"/></target>\n" +
+			"      </segment>",
+		"<segment state=\"final\">\n        <source>Close</source>\n        <target>Schließen</target>",
+		"<segment>\n        <source>ACME</source>\n      </segment>",
+	} {
+		if !strings.Contains(translated, want) {
+			t.Errorf("translated XLIFF 2.0 should contain %q, got:\n%v", want, translated)
+		}
+	}
+}
+
+// TestTranslateUnchanged checks that documents without untranslated units are returned as they are
+func TestTranslateUnchanged(t *testing.T) {
+	document := `<xliff version="1.2"><file target-language="de"><body><trans-unit id="1"><source>a</source><target>b</target></trans-unit></body></file></xliff>`
+
+	translated, count, err := Translate(document, language.German, upper)
+	if err != nil || count != 0 || translated != document {
+		t.Errorf("Translate should keep translated documents unchanged: got %q, %d, %v", translated, count, err)
+	}
+}
+
+func TestTranslateBrokenNesting(t *testing.T) {
+	document := `<xliff version="1.2"><file target-language="de"><body><trans-unit id="1"><source>a <g id="1">b</g></source></trans-unit></body></file></xliff>`
+
+	swap := func(phrase string) (string, error) {
+		if strings.Contains(phrase, "⟦") {
+			return "⟦1⟧B⟦0⟧ A", nil
+		}
+		return strings.ToUpper(phrase), nil
+	}
+
+	translated, _, err := Translate(document, language.German, swap)
+	if err != nil || !strings.Contains(translated, `<target state="needs-review-translation" state-qualifier="mt-suggestion">A <g id="1">B</g></target>`) {
+		t.Errorf("Translate should translate texts separately when nesting breaks: got %q, %v", translated, err)
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	for _, document := range []string{
+		`<xliff version="1.0"></xliff>`,
+		`<html></html>`,
+		`<xliff version="1.2"><file>`,
+	} {
+		if _, _, err := Translate(document, language.German, upper); err == nil {
+			t.Errorf("Translate should reject %q", document)
+		}
+	}
+
+	failing := func(string) (string, error) {
+		return "", errors.New("unavailable")
+	}
+	if _, _, err := Translate(`<xliff version="1.2"><file><body><trans-unit id="1"><source>a</source></trans-unit></body></file></xliff>`, language.German, failing); err == nil {
+		t.Error("Translate should return translation errors")
+	}
+}